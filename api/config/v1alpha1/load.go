@@ -0,0 +1,210 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+)
+
+// LoadInto reads a configuration file over config, so settings missing from the file keep their value.
+// Unknown fields are rejected so typos don't go unnoticed.
+func LoadInto(path string, config *OperatorConfig) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %v", err)
+	}
+	if err := yaml.UnmarshalStrict(b, config); err != nil {
+		return fmt.Errorf("parsing config file %s: %v", path, err)
+	}
+	if config.APIVersion != GroupVersion.String() || config.Kind != Kind {
+		return fmt.Errorf("config file %s must be of apiVersion %s and kind %s, not %s %s",
+			path, GroupVersion, Kind, config.APIVersion, config.Kind)
+	}
+	return nil
+}
+
+// Load reads a configuration file over the defaults and validates it
+func Load(path string) (*OperatorConfig, error) {
+	config := Default()
+	if err := LoadInto(path, config); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate returns every invalid setting at once
+func (c *OperatorConfig) Validate() error {
+	errs := field.ErrorList{}
+
+	manager := field.NewPath("manager")
+	errs = append(errs, validateNamespaces(c.Manager.Namespaces, manager.Child("namespaces"))...)
+	errs = append(errs, validateNamespaces(c.Manager.ExcludedNamespaces, manager.Child("excludedNamespaces"))...)
+	for i, ns := range c.Manager.ExcludedNamespaces {
+		if sets.NewString(c.Manager.Namespaces...).Has(ns) {
+			errs = append(errs, field.Invalid(manager.Child("excludedNamespaces").Index(i), ns, "namespace is also listed in manager.namespaces"))
+		}
+	}
+	errs = append(errs, validateNamespaces(c.Manager.ProtectedNamespaces, manager.Child("protectedNamespaces"))...)
+	errs = append(errs, validatePositiveDuration(c.Manager.SyncPeriod, manager.Child("syncPeriod"))...)
+	errs = append(errs, validatePositive(c.Manager.KubeAPIQPS, manager.Child("kubeAPIQPS"))...)
+	errs = append(errs, validatePositive(float64(c.Manager.KubeAPIBurst), manager.Child("kubeAPIBurst"))...)
+
+	leaderElection := manager.Child("leaderElection")
+	le := c.Manager.LeaderElection
+	if le.ID == "" {
+		errs = append(errs, field.Required(leaderElection.Child("id"), ""))
+	}
+	errs = append(errs, validatePositiveDuration(le.LeaseDuration, leaderElection.Child("leaseDuration"))...)
+	errs = append(errs, validatePositiveDuration(le.RenewDeadline, leaderElection.Child("renewDeadline"))...)
+	errs = append(errs, validatePositiveDuration(le.RetryPeriod, leaderElection.Child("retryPeriod"))...)
+	if le.RenewDeadline.Duration >= le.LeaseDuration.Duration {
+		errs = append(errs, field.Invalid(leaderElection.Child("renewDeadline"), le.RenewDeadline.Duration.String(), "must be shorter than leaseDuration"))
+	}
+	if le.RetryPeriod.Duration >= le.RenewDeadline.Duration {
+		errs = append(errs, field.Invalid(leaderElection.Child("retryPeriod"), le.RetryPeriod.Duration.String(), "must be shorter than renewDeadline"))
+	}
+
+	webhooks := manager.Child("webhooks")
+	if c.Manager.Webhooks.Port <= 0 || c.Manager.Webhooks.Port > 65535 {
+		errs = append(errs, field.Invalid(webhooks.Child("port"), c.Manager.Webhooks.Port, "must be a port number"))
+	}
+	if c.Manager.Webhooks.Enabled && !filepath.IsAbs(c.Manager.Webhooks.CertDir) {
+		errs = append(errs, field.Invalid(webhooks.Child("certDir"), c.Manager.Webhooks.CertDir, "must be an absolute path"))
+	}
+
+	controller := field.NewPath("controller")
+	cc := c.Controller
+	errs = append(errs, validatePositive(float64(cc.MaxConcurrentReconciles), controller.Child("maxConcurrentReconciles"))...)
+	errs = append(errs, validatePositiveDuration(cc.RetryBaseDelay, controller.Child("retryBaseDelay"))...)
+	if cc.RetryMaxDelay.Duration < cc.RetryBaseDelay.Duration {
+		errs = append(errs, field.Invalid(controller.Child("retryMaxDelay"), cc.RetryMaxDelay.Duration.String(), "must not be shorter than retryBaseDelay"))
+	}
+	errs = append(errs, validatePositive(cc.RetryQPS, controller.Child("retryQPS"))...)
+	errs = append(errs, validatePositive(float64(cc.RetryBurst), controller.Child("retryBurst"))...)
+	errs = append(errs, validatePositive(cc.EventQPS, controller.Child("eventQPS"))...)
+	errs = append(errs, validatePositive(float64(cc.EventBurst), controller.Child("eventBurst"))...)
+
+	for i, kind := range cc.SharedResourceKinds {
+		if schema.ParseGroupKind(kind).Kind == "" {
+			errs = append(errs, field.Invalid(controller.Child("sharedResourceKinds").Index(i), kind, "must be of the form Kind or Kind.group"))
+		}
+	}
+
+	if cc.FileSourceDirectory != "" && !filepath.IsAbs(cc.FileSourceDirectory) {
+		errs = append(errs, field.Invalid(controller.Child("fileSourceDirectory"), cc.FileSourceDirectory, "must be an absolute path"))
+	}
+	errs = append(errs, validateHosts(cc.HTTPSourceHosts, controller.Child("httpSourceHosts"))...)
+
+	for i, address := range cc.VaultAddresses {
+		if u, err := url.Parse(address); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.Trim(u.Path, "/") != "" {
+			errs = append(errs, field.Invalid(controller.Child("vaultAddresses").Index(i), address, "must be of the form http(s)://host[:port]"))
+		}
+	}
+
+	for i, prefix := range cc.GitRepositories {
+		if prefix == "" || strings.HasPrefix(prefix, "-") {
+			errs = append(errs, field.Invalid(controller.Child("gitRepositories").Index(i), prefix, "must be the prefix of a repository URL"))
+		}
+	}
+	if cc.GitCacheDirectory != "" && !filepath.IsAbs(cc.GitCacheDirectory) {
+		errs = append(errs, field.Invalid(controller.Child("gitCacheDirectory"), cc.GitCacheDirectory, "must be an absolute path"))
+	}
+	if cc.SigningKeyFile != "" && !filepath.IsAbs(cc.SigningKeyFile) {
+		errs = append(errs, field.Invalid(controller.Child("signingKeyFile"), cc.SigningKeyFile, "must be an absolute path"))
+	}
+
+	notifications := field.NewPath("notifications")
+	for i, sink := range c.Notifications.Sinks {
+		if u, err := url.Parse(sink.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, field.Invalid(notifications.Child("sinks").Index(i).Child("url"), sink.URL, "must be an http(s) URL"))
+		}
+		modes := []string{string(tattletalev1beta1.CloudEventsModeBinary), string(tattletalev1beta1.CloudEventsModeStructured)}
+		if sink.Mode != "" && !sets.NewString(modes...).Has(string(sink.Mode)) {
+			errs = append(errs, field.NotSupported(notifications.Child("sinks").Index(i).Child("mode"), sink.Mode, modes))
+		}
+	}
+	errs = append(errs, validateHosts(c.Notifications.AllowedHosts, notifications.Child("allowedHosts"))...)
+	errs = append(errs, validatePositive(float64(c.Notifications.QueueSize), notifications.Child("queueSize"))...)
+	if c.Notifications.Retries < 0 {
+		errs = append(errs, field.Invalid(notifications.Child("retries"), c.Notifications.Retries, "must not be negative"))
+	}
+
+	if c.Audit.Path != "" && c.Audit.Path != "-" && !filepath.IsAbs(c.Audit.Path) {
+		errs = append(errs, field.Invalid(field.NewPath("audit", "path"), c.Audit.Path, "must be an absolute path or -"))
+	}
+
+	levels := []string{LogLevelDebug, LogLevelInfo, LogLevelError}
+	if !sets.NewString(levels...).Has(c.Logging.Level) {
+		errs = append(errs, field.NotSupported(field.NewPath("logging", "level"), c.Logging.Level, levels))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %v", errs.ToAggregate())
+	}
+	return nil
+}
+
+func validateNamespaces(namespaces []string, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	for i, ns := range namespaces {
+		for _, msg := range validation.IsDNS1123Label(ns) {
+			errs = append(errs, field.Invalid(path.Index(i), ns, msg))
+		}
+	}
+	return errs
+}
+
+func validatePositive(value float64, path *field.Path) field.ErrorList {
+	if value <= 0 {
+		return field.ErrorList{field.Invalid(path, value, "must be greater than 0")}
+	}
+	return nil
+}
+
+func validatePositiveDuration(value metav1.Duration, path *field.Path) field.ErrorList {
+	if value.Duration <= 0 {
+		return field.ErrorList{field.Invalid(path, value.Duration.String(), "must be greater than 0")}
+	}
+	return nil
+}
+
+func validateHosts(hosts []string, path *field.Path) field.ErrorList {
+	errs := field.ErrorList{}
+	for i, host := range hosts {
+		// IPv6 addresses are the only hosts holding a colon
+		if host == "" || strings.Contains(host, "/") || (strings.Contains(host, ":") && net.ParseIP(host) == nil) {
+			errs = append(errs, field.Invalid(path.Index(i), host, "must be a host name or IP address without scheme or port"))
+		}
+	}
+	return errs
+}
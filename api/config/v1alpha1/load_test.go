@@ -0,0 +1,187 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// load writes content to a temporary file and loads it
+func load(t *testing.T, content string) (*OperatorConfig, error) {
+	f, err := ioutil.TempFile("", "tattletale-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return Load(f.Name())
+}
+
+func TestLoadDefaults(t *testing.T) {
+	config, err := load(t, `apiVersion: config.tattletale.dev/v1alpha1
+kind: OperatorConfig
+manager:
+  excludedNamespaces: [legacy]
+  syncPeriod: 1h
+controller:
+  maxConcurrentReconciles: 4
+logging:
+  level: debug
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Settings missing from the file keep their defaults
+	if want := []string{"legacy"}; !reflect.DeepEqual(config.Manager.ExcludedNamespaces, want) {
+		t.Errorf("excludedNamespaces = %v, want %v", config.Manager.ExcludedNamespaces, want)
+	}
+	if want := []string{"kube-system", "kube-public", "kube-node-lease"}; !reflect.DeepEqual(config.Manager.ProtectedNamespaces, want) {
+		t.Errorf("protectedNamespaces = %v, want %v", config.Manager.ProtectedNamespaces, want)
+	}
+	if config.Manager.SyncPeriod.Duration != time.Hour {
+		t.Errorf("syncPeriod = %s, want 1h", config.Manager.SyncPeriod.Duration)
+	}
+	if config.Controller.MaxConcurrentReconciles != 4 {
+		t.Errorf("maxConcurrentReconciles = %d, want 4", config.Controller.MaxConcurrentReconciles)
+	}
+	if config.Controller.RetryBurst != Default().Controller.RetryBurst {
+		t.Errorf("retryBurst = %d, want the default", config.Controller.RetryBurst)
+	}
+	if config.Logging.Level != LogLevelDebug {
+		t.Errorf("logging level = %q, want debug", config.Logging.Level)
+	}
+}
+
+func TestLoadSample(t *testing.T) {
+	config, err := Load(filepath.Join("..", "..", "..", "config", "manager", "operator_config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.Manager.LeaderElection.Enabled {
+		t.Error("the sample configuration doesn't enable leader election")
+	}
+}
+
+func TestLoadRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		// Substrings the error must hold, and must not hold
+		want, notWant []string
+	}{
+		{
+			name:    "another kind",
+			content: "apiVersion: v1\nkind: ConfigMap\n",
+			want:    []string{"must be of apiVersion config.tattletale.dev/v1alpha1 and kind OperatorConfig"},
+		},
+		{
+			name:    "unknown field",
+			content: "apiVersion: config.tattletale.dev/v1alpha1\nkind: OperatorConfig\ncontroller:\n  maxConcurentReconciles: 4\n",
+			want:    []string{"maxConcurentReconciles"},
+		},
+		{
+			// Every invalid setting is reported
+			name: "invalid settings",
+			content: `apiVersion: config.tattletale.dev/v1alpha1
+kind: OperatorConfig
+manager:
+  namespaces: [team-a]
+  excludedNamespaces: [team-a, Not_A_Namespace]
+  protectedNamespaces: [kube-system, "kube-*"]
+  leaderElection:
+    renewDeadline: 20s
+  webhooks:
+    enabled: true
+    port: 0
+    certDir: certs
+controller:
+  retryBurst: 0
+  fileSourceDirectory: sources
+  httpSourceHosts: [config.example.com, "https://config.example.com", "config.example.com:443", "::1"]
+  vaultAddresses: ["https://vault.example.com:8200", "vault.example.com"]
+  signingKeyFile: signing.key
+notifications:
+  sinks:
+  - url: https://deploy.example.com/events
+    mode: Structured
+  - url: deploy.example.com
+    mode: Batched
+  allowedHosts: [events.example.com, "https://events.example.com"]
+  queueSize: 0
+audit:
+  path: audit.log
+logging:
+  level: verbose
+`,
+			want: []string{
+				"manager.excludedNamespaces[0]",
+				"manager.excludedNamespaces[1]",
+				"manager.protectedNamespaces[1]",
+				"manager.leaderElection.renewDeadline",
+				"manager.webhooks.port",
+				"manager.webhooks.certDir",
+				"controller.retryBurst",
+				"controller.fileSourceDirectory",
+				"controller.httpSourceHosts[1]",
+				"controller.httpSourceHosts[2]",
+				"controller.vaultAddresses[1]",
+				"controller.signingKeyFile",
+				"notifications.sinks[1].url",
+				"notifications.sinks[1].mode",
+				"notifications.allowedHosts[1]",
+				"notifications.queueSize",
+				"audit.path",
+				"logging.level",
+			},
+			notWant: []string{
+				"manager.protectedNamespaces[0]",
+				"controller.httpSourceHosts[0]",
+				"controller.httpSourceHosts[3]",
+				"controller.vaultAddresses[0]",
+				"notifications.sinks[0]",
+				"notifications.allowedHosts[0]",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(t, tt.content)
+			if err == nil {
+				t.Fatal("Load() succeeded")
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(err.Error(), s) {
+					t.Errorf("error doesn't report %s: %v", s, err)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(err.Error(), s) {
+					t.Errorf("error reports %s: %v", s, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package v1alpha1 contains the configuration file format of the tattletale manager
+package v1alpha1
+
+import (
+	"time"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	// GroupVersion is the apiVersion configuration files must declare
+	GroupVersion = schema.GroupVersion{Group: "config.tattletale.dev", Version: "v1alpha1"}
+)
+
+// Kind is the kind configuration files must declare
+const Kind = "OperatorConfig"
+
+// Log levels understood by LoggingConfig
+const (
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelError = "error"
+)
+
+// OperatorConfig configures the tattletale manager
+type OperatorConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	Manager       ManagerConfig       `json:"manager,omitempty"`
+	Controller    ControllerConfig    `json:"controller,omitempty"`
+	Notifications NotificationsConfig `json:"notifications,omitempty"`
+	Audit         AuditConfig         `json:"audit,omitempty"`
+	Logging       LoggingConfig       `json:"logging,omitempty"`
+}
+
+// ManagerConfig configures the manager, its caches and its connection to the API server
+type ManagerConfig struct {
+	// The address the metric endpoint binds to
+	MetricsAddr string `json:"metricsAddr,omitempty"`
+	// The address the /healthz and /readyz endpoints bind to, 0 disables them
+	HealthAddr string `json:"healthAddr,omitempty"`
+
+	// Namespaces to restrict the manager to, empty to run cluster wide
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Namespaces the manager ignores, shared objects in them aren't reconciled
+	// and they are never read from or written to
+	ExcludedNamespaces []string `json:"excludedNamespaces,omitempty"`
+	// Namespaces copies are never written to, whatever the shared objects target. The namespace the
+	// manager runs in is always protected as well.
+	ProtectedNamespaces []string `json:"protectedNamespaces,omitempty"`
+
+	// How often every shared object is reconciled even if nothing changed
+	SyncPeriod metav1.Duration `json:"syncPeriod,omitempty"`
+
+	// The sustained number of requests per second sent to the API server
+	KubeAPIQPS float64 `json:"kubeAPIQPS,omitempty"`
+	// The number of requests that can be sent to the API server in a burst
+	KubeAPIBurst int `json:"kubeAPIBurst,omitempty"`
+
+	LeaderElection LeaderElectionConfig `json:"leaderElection,omitempty"`
+	Webhooks       WebhooksConfig       `json:"webhooks,omitempty"`
+}
+
+// LeaderElectionConfig configures leader election between manager replicas
+type LeaderElectionConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// Namespace of the leader election configmap, defaults to the namespace the manager runs in
+	Namespace string `json:"namespace,omitempty"`
+	// Name of the leader election configmap
+	ID string `json:"id,omitempty"`
+
+	LeaseDuration metav1.Duration `json:"leaseDuration,omitempty"`
+	RenewDeadline metav1.Duration `json:"renewDeadline,omitempty"`
+	RetryPeriod   metav1.Duration `json:"retryPeriod,omitempty"`
+}
+
+// WebhooksConfig configures the webhook server, which converts SharedSecrets and SharedConfigMaps between
+// API versions and defaults them
+type WebhooksConfig struct {
+	// Serve webhooks, needed as soon as the CRDs and webhook configurations of config/webhook are installed
+	Enabled bool `json:"enabled,omitempty"`
+	// The port the webhook server binds to
+	Port int `json:"port,omitempty"`
+	// The directory holding the tls.crt and tls.key of the webhook server
+	CertDir string `json:"certDir,omitempty"`
+}
+
+// ControllerConfig configures the shared object controllers
+type ControllerConfig struct {
+	// The number of shared objects of each kind reconciled in parallel
+	MaxConcurrentReconciles int `json:"maxConcurrentReconciles,omitempty"`
+
+	// The delay before the first retry of a failed reconcile, doubled on every further failure
+	RetryBaseDelay metav1.Duration `json:"retryBaseDelay,omitempty"`
+	// The longest delay between retries of a failed reconcile
+	RetryMaxDelay metav1.Duration `json:"retryMaxDelay,omitempty"`
+	// The sustained number of failed reconciles retried per second
+	RetryQPS float64 `json:"retryQPS,omitempty"`
+	// The number of failed reconciles that can be retried in a burst
+	RetryBurst int `json:"retryBurst,omitempty"`
+
+	// The sustained number of events per second emitted for a single shared object
+	EventQPS float64 `json:"eventQPS,omitempty"`
+	// The number of events a single shared object can emit in a burst
+	EventBurst int `json:"eventBurst,omitempty"`
+
+	// Kinds SharedResources may share, as Kind.group e.g. NetworkPolicy.networking.k8s.io,
+	// or Kind for the core group. SharedResources can't share anything when empty.
+	// The manager needs RBAC to read, list, watch and write every kind listed.
+	SharedResourceKinds []string `json:"sharedResourceKinds,omitempty"`
+
+	// The directory SharedSecrets may read file sources from, file sources are disabled when empty
+	FileSourceDirectory string `json:"fileSourceDirectory,omitempty"`
+	// Hosts SharedSecrets may read HTTP sources from, HTTP sources are disabled when empty
+	HTTPSourceHosts []string `json:"httpSourceHosts,omitempty"`
+	// Vault servers SharedSecrets may read from as scheme://host[:port], Vault sources are disabled when empty
+	VaultAddresses []string `json:"vaultAddresses,omitempty"`
+	// URL prefixes of the Git repositories SharedConfigMaps may read from, e.g. https://github.com/acme/.
+	// Git sources are disabled when empty.
+	GitRepositories []string `json:"gitRepositories,omitempty"`
+	// Where Git repositories are mirrored, defaults to a directory below the temporary directory
+	GitCacheDirectory string `json:"gitCacheDirectory,omitempty"`
+
+	// A file holding the base64 encoded ed25519 private key copies of secrets and configmaps are signed with,
+	// usually mounted from a secret. Copies aren't signed when empty.
+	SigningKeyFile string `json:"signingKeyFile,omitempty"`
+
+	// Let SharedSecrets write their copies as configmaps, which hold the values in plaintext and can be read
+	// by anyone allowed to read configmaps. SharedConfigMaps may always write their copies as secrets.
+	AllowSecretToConfigMap bool `json:"allowSecretToConfigMap,omitempty"`
+}
+
+// NotificationsConfig configures the CloudEvents sent about the outcome of syncs
+type NotificationsConfig struct {
+	// Sinks events about every shared object are sent to, unless the shared object sets its own
+	Sinks []tattletalev1beta1.NotificationSink `json:"sinks,omitempty"`
+	// Hosts the sinks set by shared objects may send to, shared objects can't set sinks when empty
+	AllowedHosts []string `json:"allowedHosts,omitempty"`
+	// The number of events waiting to be sent, further events are dropped
+	QueueSize int `json:"queueSize,omitempty"`
+	// How many times sending an event is retried
+	Retries int `json:"retries,omitempty"`
+}
+
+// AuditConfig configures the audit trail of every write to a copy
+type AuditConfig struct {
+	// The file audit records are appended to as JSON lines, - for stdout. Nothing is recorded when empty.
+	Path string `json:"path,omitempty"`
+}
+
+// LoggingConfig configures the manager's logs
+type LoggingConfig struct {
+	// One of debug, info or error
+	Level string `json:"level,omitempty"`
+	// Human readable logs instead of JSON
+	Development bool `json:"development,omitempty"`
+}
+
+// Default returns the configuration used when no file is given
+func Default() *OperatorConfig {
+	return &OperatorConfig{
+		TypeMeta: metav1.TypeMeta{APIVersion: GroupVersion.String(), Kind: Kind},
+		Manager: ManagerConfig{
+			MetricsAddr:         ":8080",
+			HealthAddr:          ":8081",
+			ProtectedNamespaces: []string{"kube-system", "kube-public", "kube-node-lease"},
+			SyncPeriod:          metav1.Duration{Duration: 10 * time.Hour},
+			KubeAPIQPS:          5,
+			KubeAPIBurst:        10,
+			LeaderElection: LeaderElectionConfig{
+				ID:            "controller-leader-election-helper",
+				LeaseDuration: metav1.Duration{Duration: 15 * time.Second},
+				RenewDeadline: metav1.Duration{Duration: 10 * time.Second},
+				RetryPeriod:   metav1.Duration{Duration: 2 * time.Second},
+			},
+			Webhooks: WebhooksConfig{
+				Port:    443,
+				CertDir: "/tmp/k8s-webhook-server/serving-certs",
+			},
+		},
+		Controller: ControllerConfig{
+			MaxConcurrentReconciles: 1,
+			RetryBaseDelay:          metav1.Duration{Duration: 5 * time.Millisecond},
+			RetryMaxDelay:           metav1.Duration{Duration: 1000 * time.Second},
+			RetryQPS:                10,
+			RetryBurst:              100,
+			EventQPS:                1,
+			EventBurst:              25,
+		},
+		Notifications: NotificationsConfig{
+			QueueSize: 1000,
+			Retries:   5,
+		},
+		Logging: LoggingConfig{
+			Level:       LogLevelInfo,
+			Development: true,
+		},
+	}
+}
@@ -0,0 +1,73 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+)
+
+// convertVia copies in to out through their JSON representation, for the parts of the API that have
+// the same shape in every version
+func convertVia(in, out interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		return fmt.Errorf("converting %T to %T: %v", in, out, err)
+	}
+	return nil
+}
+
+// sourceReference returns the v1 reference to the source a v1beta1 shared object names, nil for shared
+// objects without a source in the cluster. The namespace is left out when it is the shared object's own.
+func sourceReference(name, namespace, sharedNamespace string) *SourceReference {
+	if name == "" {
+		return nil
+	}
+	if namespace == sharedNamespace {
+		namespace = ""
+	}
+	return &SourceReference{Name: name, Namespace: namespace}
+}
+
+// sourceNamespace returns the namespace of a v1 source reference, defaulted to the namespace of the
+// shared object because v1beta1 always spells it out
+func sourceNamespace(ref *SourceReference, sharedNamespace string) string {
+	if ref.Namespace != "" {
+		return ref.Namespace
+	}
+	return sharedNamespace
+}
+
+// syncedCopies returns the copies v1beta1 lists in status.targetSecrets and status.targetConfigMaps
+func syncedCopies(targets []tattletalev1beta1.TargetStatus) []string {
+	copies := []string{}
+	for _, t := range targets {
+		if t.State != tattletalev1beta1.TargetStateSynced && t.State != tattletalev1beta1.TargetStateDrifted {
+			continue
+		}
+		name := t.Name
+		if t.CurrentName != "" {
+			name = t.CurrentName
+		}
+		copies = append(copies, t.Namespace+"/"+name)
+	}
+	return copies
+}
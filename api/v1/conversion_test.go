@@ -0,0 +1,275 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Times are serialized with a precision of seconds and read back in the local time zone
+var lastSync = metav1.NewTime(time.Date(2019, 9, 1, 12, 0, 0, 0, time.UTC).Local())
+
+func v1beta1Secret() *tattletalev1beta1.SharedSecret {
+	var keep int32 = 3
+	return &tattletalev1beta1.SharedSecret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "db", Labels: map[string]string{"app": "db"}},
+		Spec: tattletalev1beta1.SharedSecretSpec{
+			SourceSecret:    "db-credentials",
+			SourceNamespace: "team-a",
+			Targets: []tattletalev1beta1.TargetSecret{
+				{Namespace: "team-b"},
+				{Namespace: "team-c", NewName: "team-a-db", DriftPolicy: tattletalev1beta1.DriftPolicyReport,
+					Encryption: &tattletalev1beta1.SecretEncryption{PublicKeyConfigMap: "tattletale-key"}},
+			},
+			DriftPolicy: tattletalev1beta1.DriftPolicyIgnore,
+			Priority:    10,
+			Immutable:   &tattletalev1beta1.ImmutableCopies{KeepGenerations: &keep},
+			Notifications: &tattletalev1beta1.Notifications{Sinks: []tattletalev1beta1.NotificationSink{
+				{URL: "https://events.example.com", Mode: tattletalev1beta1.CloudEventsModeStructured},
+			}},
+		},
+		Status: tattletalev1beta1.SharedSecretStatus{
+			SourceSecret:  "Found",
+			TargetSecrets: []string{"team-b/db-credentials-7d9f", "team-c/team-a-db"},
+			Targets: []tattletalev1beta1.TargetStatus{
+				{Namespace: "team-b", Name: "db-credentials", CurrentName: "db-credentials-7d9f", State: tattletalev1beta1.TargetStateSynced, Hash: "abc", LastSyncTime: &lastSync},
+				{Namespace: "team-c", Name: "team-a-db", State: tattletalev1beta1.TargetStateDrifted, Message: "copy was modified outside of tattletale"},
+				{Namespace: "team-d", Name: "db-credentials", State: tattletalev1beta1.TargetStateNamespaceMissing},
+			},
+			Conditions: []tattletalev1beta1.Condition{
+				{Type: tattletalev1beta1.ConditionDecrypted, Status: corev1.ConditionTrue, Reason: "Decrypted", LastTransitionTime: lastSync},
+			},
+		},
+	}
+}
+
+func v1beta1ConfigMap() *tattletalev1beta1.SharedConfigMap {
+	return &tattletalev1beta1.SharedConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "settings"},
+		Spec: tattletalev1beta1.SharedConfigMapSpec{
+			Source: &tattletalev1beta1.ConfigMapSource{
+				Git:          &tattletalev1beta1.GitSource{URL: "https://github.com/acme/settings", Ref: "main", Path: "prod"},
+				PollInterval: &metav1.Duration{Duration: time.Minute},
+			},
+			Targets: []tattletalev1beta1.TargetConfigMap{
+				{Namespace: "team-b", NewName: "acme-settings"},
+				{Namespace: "team-c", NewName: "acme-settings"},
+			},
+			Priority: -1,
+		},
+		Status: tattletalev1beta1.SharedConfigMapStatus{
+			SourceConfigMap:  "Found",
+			SourceVersion:    "0a1b2c3d",
+			TargetConfigMaps: []string{"team-b/acme-settings"},
+			Targets: []tattletalev1beta1.TargetStatus{
+				{Namespace: "team-b", Name: "acme-settings", State: tattletalev1beta1.TargetStateSynced, Hash: "def", LastSyncTime: &lastSync},
+				{Namespace: "team-c", Name: "acme-settings", State: tattletalev1beta1.TargetStateConflict, Message: "copy is written by SharedConfigMap team-c/settings"},
+			},
+			Conditions: []tattletalev1beta1.Condition{
+				{Type: tattletalev1beta1.ConditionConflict, Status: corev1.ConditionTrue, Reason: "Conflict", LastTransitionTime: lastSync},
+			},
+		},
+	}
+}
+
+func TestSharedSecretConvertFrom(t *testing.T) {
+	original := v1beta1Secret()
+
+	var converted SharedSecret
+	if err := converted.ConvertFrom(original.DeepCopy()); err != nil {
+		t.Fatal(err)
+	}
+	if want := (&SourceReference{Name: "db-credentials"}); !reflect.DeepEqual(converted.Spec.SourceRef, want) {
+		t.Errorf("sourceRef = %+v, want %+v", converted.Spec.SourceRef, want)
+	}
+	if converted.Spec.Targets[1].Name != "team-a-db" {
+		t.Errorf("target name = %q, want the new name", converted.Spec.Targets[1].Name)
+	}
+	if converted.Spec.Priority != 10 {
+		t.Errorf("priority = %d, want 10", converted.Spec.Priority)
+	}
+	if want := (&SecretEncryption{PublicKeyConfigMap: "tattletale-key"}); !reflect.DeepEqual(converted.Spec.Targets[1].Encryption, want) {
+		t.Errorf("encryption = %+v, want %+v", converted.Spec.Targets[1].Encryption, want)
+	}
+	if want := (SourceStatus{State: SourceStateFound}); converted.Status.Source != want {
+		t.Errorf("source status = %+v, want %+v", converted.Status.Source, want)
+	}
+
+	var back tattletalev1beta1.SharedSecret
+	if err := converted.ConvertTo(&back); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&back, original) {
+		t.Errorf("round trip = %+v, want %+v", back, original)
+	}
+}
+
+func TestSharedConfigMapConvertFrom(t *testing.T) {
+	original := v1beta1ConfigMap()
+
+	var converted SharedConfigMap
+	if err := converted.ConvertFrom(original.DeepCopy()); err != nil {
+		t.Fatal(err)
+	}
+	if converted.Spec.SourceRef != nil {
+		t.Errorf("sourceRef = %+v, want none for a source outside of the cluster", converted.Spec.SourceRef)
+	}
+	if converted.Spec.Source.Git.URL != "https://github.com/acme/settings" {
+		t.Errorf("git url = %q", converted.Spec.Source.Git.URL)
+	}
+	if want := (SourceStatus{State: SourceStateFound, Version: "0a1b2c3d"}); converted.Status.Source != want {
+		t.Errorf("source status = %+v, want %+v", converted.Status.Source, want)
+	}
+	if len(converted.Status.Conditions) != 1 {
+		t.Errorf("conditions = %+v, want 1", converted.Status.Conditions)
+	}
+
+	var back tattletalev1beta1.SharedConfigMap
+	if err := converted.ConvertTo(&back); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&back, original) {
+		t.Errorf("round trip = %+v, want %+v", back, original)
+	}
+}
+
+func TestSharedSecretConvertTo(t *testing.T) {
+	original := &SharedSecret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "db"},
+		Spec: SharedSecretSpec{
+			SourceRef: &SourceReference{Name: "db-credentials", Namespace: "platform"},
+			Targets: []SecretTarget{
+				{Namespace: "team-b", Name: "platform-db", DriftPolicy: DriftPolicyOverwrite},
+				{Namespace: "team-b", Name: "platform-db-settings", Kind: TargetKindConfigMap},
+			},
+		},
+		Status: SharedSecretStatus{
+			Source: SourceStatus{State: SourceStateMissing},
+			Targets: []TargetStatus{
+				{Namespace: "team-b", Name: "platform-db", State: TargetStateForbidden},
+				{Namespace: "team-b", Name: "platform-db-settings", Kind: TargetKindConfigMap, State: TargetStateForbidden},
+			},
+		},
+	}
+
+	var hub tattletalev1beta1.SharedSecret
+	if err := original.DeepCopy().ConvertTo(&hub); err != nil {
+		t.Fatal(err)
+	}
+	if hub.Spec.SourceSecret != "db-credentials" || hub.Spec.SourceNamespace != "platform" {
+		t.Errorf("source = %s/%s, want platform/db-credentials", hub.Spec.SourceNamespace, hub.Spec.SourceSecret)
+	}
+	if hub.Status.SourceSecret != "Missing" {
+		t.Errorf("source status = %q, want Missing", hub.Status.SourceSecret)
+	}
+	if hub.Status.TargetSecrets == nil || len(hub.Status.TargetSecrets) != 0 {
+		t.Errorf("target secrets = %#v, want an empty list", hub.Status.TargetSecrets)
+	}
+
+	var back SharedSecret
+	if err := back.ConvertFrom(&hub); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&back, original) {
+		t.Errorf("round trip = %+v, want %+v", back, original)
+	}
+}
+
+func TestSharedConfigMapConvertTo(t *testing.T) {
+	original := &SharedConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "settings"},
+		Spec: SharedConfigMapSpec{
+			SourceRef:   &SourceReference{Name: "settings"},
+			Targets:     []ConfigMapTarget{{Namespace: "team-b"}, {Namespace: "team-c", Name: "acme"}},
+			DriftPolicy: DriftPolicyReport,
+			Immutable:   &ImmutableCopies{MaxAge: &metav1.Duration{Duration: time.Hour}},
+		},
+		Status: SharedConfigMapStatus{
+			Source: SourceStatus{State: SourceStateFound},
+			Targets: []TargetStatus{
+				{Namespace: "team-b", Name: "settings", CurrentName: "settings-5g7h", State: TargetStateSynced, LastSyncTime: &lastSync},
+				{Namespace: "team-c", Name: "acme", State: TargetStateDrifted},
+			},
+		},
+	}
+
+	var hub tattletalev1beta1.SharedConfigMap
+	if err := original.DeepCopy().ConvertTo(&hub); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"team-b/settings-5g7h", "team-c/acme"}; !reflect.DeepEqual(hub.Status.TargetConfigMaps, want) {
+		t.Errorf("target configmaps = %v, want %v", hub.Status.TargetConfigMaps, want)
+	}
+
+	var back SharedConfigMap
+	if err := back.ConvertFrom(&hub); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&back, original) {
+		t.Errorf("round trip = %+v, want %+v", back, original)
+	}
+}
+
+func TestConvertToDefaultsSourceNamespace(t *testing.T) {
+	tests := []struct {
+		name string
+		// Converts the shared object and returns the namespace of its source in v1beta1
+		convert func() (string, error)
+	}{
+		{
+			name: "SharedSecret",
+			convert: func() (string, error) {
+				secret := &SharedSecret{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "db"},
+					Spec:       SharedSecretSpec{SourceRef: &SourceReference{Name: "db-credentials"}},
+				}
+				var hub tattletalev1beta1.SharedSecret
+				err := secret.ConvertTo(&hub)
+				return hub.Spec.SourceNamespace, err
+			},
+		},
+		{
+			name: "SharedConfigMap",
+			convert: func() (string, error) {
+				configmap := &SharedConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "settings"},
+					Spec:       SharedConfigMapSpec{SourceRef: &SourceReference{Name: "settings"}},
+				}
+				var hub tattletalev1beta1.SharedConfigMap
+				err := configmap.ConvertTo(&hub)
+				return hub.Spec.SourceNamespace, err
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			namespace, err := tt.convert()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if namespace != "team-a" {
+				t.Errorf("source namespace = %q, want the namespace of the shared object", namespace)
+			}
+		})
+	}
+}
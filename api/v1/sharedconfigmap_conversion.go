@@ -0,0 +1,98 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// ConvertTo converts this SharedConfigMap to the v1beta1 hub version
+func (c *SharedConfigMap) ConvertTo(hub conversion.Hub) error {
+	dst := hub.(*tattletalev1beta1.SharedConfigMap)
+	dst.ObjectMeta = c.ObjectMeta
+
+	if c.Spec.SourceRef != nil {
+		dst.Spec.SourceConfigMap = c.Spec.SourceRef.Name
+		dst.Spec.SourceNamespace = sourceNamespace(c.Spec.SourceRef, c.Namespace)
+	}
+	dst.Spec.Targets = nil
+	for _, t := range c.Spec.Targets {
+		dst.Spec.Targets = append(dst.Spec.Targets, tattletalev1beta1.TargetConfigMap{
+			Namespace:   t.Namespace,
+			NewName:     t.Name,
+			DriftPolicy: tattletalev1beta1.DriftPolicy(t.DriftPolicy),
+			Kind:        tattletalev1beta1.TargetKind(t.Kind),
+		})
+	}
+	dst.Spec.DriftPolicy = tattletalev1beta1.DriftPolicy(c.Spec.DriftPolicy)
+	dst.Spec.Priority = c.Spec.Priority
+	if err := convertVia(c.Spec.Source, &dst.Spec.Source); err != nil {
+		return err
+	}
+	if err := convertVia(c.Spec.Immutable, &dst.Spec.Immutable); err != nil {
+		return err
+	}
+	if err := convertVia(c.Spec.Notifications, &dst.Spec.Notifications); err != nil {
+		return err
+	}
+
+	dst.Status.SourceConfigMap = string(c.Status.Source.State)
+	dst.Status.SourceVersion = c.Status.Source.Version
+	if err := convertVia(c.Status.Targets, &dst.Status.Targets); err != nil {
+		return err
+	}
+	if err := convertVia(c.Status.Conditions, &dst.Status.Conditions); err != nil {
+		return err
+	}
+	dst.Status.TargetConfigMaps = syncedCopies(dst.Status.Targets)
+	return nil
+}
+
+// ConvertFrom converts the v1beta1 hub version to this SharedConfigMap
+func (c *SharedConfigMap) ConvertFrom(hub conversion.Hub) error {
+	src := hub.(*tattletalev1beta1.SharedConfigMap)
+	c.ObjectMeta = src.ObjectMeta
+
+	c.Spec.SourceRef = sourceReference(src.Spec.SourceConfigMap, src.Spec.SourceNamespace, src.Namespace)
+	c.Spec.Targets = nil
+	for _, t := range src.Spec.Targets {
+		c.Spec.Targets = append(c.Spec.Targets, ConfigMapTarget{
+			Namespace:   t.Namespace,
+			Name:        t.NewName,
+			DriftPolicy: DriftPolicy(t.DriftPolicy),
+			Kind:        TargetKind(t.Kind),
+		})
+	}
+	c.Spec.DriftPolicy = DriftPolicy(src.Spec.DriftPolicy)
+	c.Spec.Priority = src.Spec.Priority
+	if err := convertVia(src.Spec.Source, &c.Spec.Source); err != nil {
+		return err
+	}
+	if err := convertVia(src.Spec.Immutable, &c.Spec.Immutable); err != nil {
+		return err
+	}
+	if err := convertVia(src.Spec.Notifications, &c.Spec.Notifications); err != nil {
+		return err
+	}
+
+	c.Status.Source = SourceStatus{State: SourceState(src.Status.SourceConfigMap), Version: src.Status.SourceVersion}
+	if err := convertVia(src.Status.Targets, &c.Status.Targets); err != nil {
+		return err
+	}
+	return convertVia(src.Status.Conditions, &c.Status.Conditions)
+}
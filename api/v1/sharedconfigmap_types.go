@@ -0,0 +1,130 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConfigMapTarget is a namespace a SharedConfigMap is copied to
+type ConfigMapTarget struct {
+	// The namespace the copy is written to, or a pattern matched against every namespace: * for all
+	// namespaces, a glob such as team-*-prod or a regular expression between slashes such as /team-(a|b)-prod/
+	Namespace string `json:"namespace"`
+
+	// The name of the copy, defaults to the name of the source configmap, or of the SharedConfigMap for
+	// sources outside of the cluster
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Overrides the drift policy of the SharedConfigMap for this target
+	// +optional
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+
+	// The kind of the copy, defaults to ConfigMap
+	// +optional
+	Kind TargetKind `json:"kind,omitempty"`
+}
+
+// ConfigMapSource reads the data of a SharedConfigMap from outside of the cluster
+type ConfigMapSource struct {
+	// Files of a Git repository
+	Git *GitSource `json:"git,omitempty"`
+
+	// How often the source is read again, defaults to 5m
+	PollInterval *metav1.Duration `json:"pollInterval,omitempty"`
+}
+
+// GitSource reads files of a Git repository, one key per file named after the file
+type GitSource struct {
+	// The URL of the repository, it must be one the operator allows
+	URL string `json:"url"`
+
+	// The branch, tag or commit to read, defaults to the default branch of the repository
+	Ref string `json:"ref,omitempty"`
+
+	// A glob matching the paths of the files to read relative to the root of the repository, e.g. config/*.yaml.
+	// Defaults to every file at the root of the repository.
+	Path string `json:"path,omitempty"`
+}
+
+// SharedConfigMapSpec defines the desired state of SharedConfigMap
+type SharedConfigMapSpec struct {
+	// The configmap to share. Exactly one of sourceRef and source must be set.
+	// +optional
+	SourceRef *SourceReference `json:"sourceRef,omitempty"`
+
+	// Reads the data to share from outside of the cluster instead of from a configmap
+	// +optional
+	Source *ConfigMapSource `json:"source,omitempty"`
+
+	// The namespaces to copy the configmap to
+	Targets []ConfigMapTarget `json:"targets"`
+
+	// What to do when a copy is edited outside of tattletale, defaults to Overwrite
+	// +optional
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+
+	// Decides which SharedConfigMap writes a copy several of them target: the highest priority wins, then the
+	// oldest one. Defaults to 0.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+
+	// Write immutable, content-addressed copies instead of updating copies in place
+	// +optional
+	Immutable *ImmutableCopies `json:"immutable,omitempty"`
+
+	// Where CloudEvents about the sync of this SharedConfigMap are sent
+	// +optional
+	Notifications *Notifications `json:"notifications,omitempty"`
+}
+
+// SharedConfigMapStatus defines the observed state of SharedConfigMap
+type SharedConfigMapStatus struct {
+	// The observed state of the source
+	Source SourceStatus `json:"source,omitempty"`
+
+	// The observed state of every copy
+	Targets []TargetStatus `json:"targets,omitempty"`
+
+	// The latest observations of the state of the SharedConfigMap
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// SharedConfigMap is the Schema for the sharedconfigmaps API
+type SharedConfigMap struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SharedConfigMapSpec   `json:"spec,omitempty"`
+	Status SharedConfigMapStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SharedConfigMapList contains a list of SharedConfigMap
+type SharedConfigMapList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SharedConfigMap `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SharedConfigMap{}, &SharedConfigMapList{})
+}
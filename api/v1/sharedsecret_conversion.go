@@ -0,0 +1,112 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// ConvertTo converts this SharedSecret to the v1beta1 hub version
+func (s *SharedSecret) ConvertTo(hub conversion.Hub) error {
+	dst := hub.(*tattletalev1beta1.SharedSecret)
+	dst.ObjectMeta = s.ObjectMeta
+
+	if s.Spec.SourceRef != nil {
+		dst.Spec.SourceSecret = s.Spec.SourceRef.Name
+		dst.Spec.SourceNamespace = sourceNamespace(s.Spec.SourceRef, s.Namespace)
+	}
+	dst.Spec.Targets = nil
+	for _, t := range s.Spec.Targets {
+		target := tattletalev1beta1.TargetSecret{
+			Namespace:   t.Namespace,
+			NewName:     t.Name,
+			DriftPolicy: tattletalev1beta1.DriftPolicy(t.DriftPolicy),
+			Kind:        tattletalev1beta1.TargetKind(t.Kind),
+		}
+		if err := convertVia(t.Encryption, &target.Encryption); err != nil {
+			return err
+		}
+		dst.Spec.Targets = append(dst.Spec.Targets, target)
+	}
+	dst.Spec.DriftPolicy = tattletalev1beta1.DriftPolicy(s.Spec.DriftPolicy)
+	dst.Spec.Priority = s.Spec.Priority
+	if err := convertVia(s.Spec.Source, &dst.Spec.Source); err != nil {
+		return err
+	}
+	if err := convertVia(s.Spec.Immutable, &dst.Spec.Immutable); err != nil {
+		return err
+	}
+	if err := convertVia(s.Spec.Encryption, &dst.Spec.Encryption); err != nil {
+		return err
+	}
+	if err := convertVia(s.Spec.Notifications, &dst.Spec.Notifications); err != nil {
+		return err
+	}
+
+	dst.Status.SourceSecret = string(s.Status.Source.State)
+	dst.Status.SourceVersion = s.Status.Source.Version
+	if err := convertVia(s.Status.Targets, &dst.Status.Targets); err != nil {
+		return err
+	}
+	if err := convertVia(s.Status.Conditions, &dst.Status.Conditions); err != nil {
+		return err
+	}
+	dst.Status.TargetSecrets = syncedCopies(dst.Status.Targets)
+	return nil
+}
+
+// ConvertFrom converts the v1beta1 hub version to this SharedSecret
+func (s *SharedSecret) ConvertFrom(hub conversion.Hub) error {
+	src := hub.(*tattletalev1beta1.SharedSecret)
+	s.ObjectMeta = src.ObjectMeta
+
+	s.Spec.SourceRef = sourceReference(src.Spec.SourceSecret, src.Spec.SourceNamespace, src.Namespace)
+	s.Spec.Targets = nil
+	for _, t := range src.Spec.Targets {
+		target := SecretTarget{
+			Namespace:   t.Namespace,
+			Name:        t.NewName,
+			DriftPolicy: DriftPolicy(t.DriftPolicy),
+			Kind:        TargetKind(t.Kind),
+		}
+		if err := convertVia(t.Encryption, &target.Encryption); err != nil {
+			return err
+		}
+		s.Spec.Targets = append(s.Spec.Targets, target)
+	}
+	s.Spec.DriftPolicy = DriftPolicy(src.Spec.DriftPolicy)
+	s.Spec.Priority = src.Spec.Priority
+	if err := convertVia(src.Spec.Source, &s.Spec.Source); err != nil {
+		return err
+	}
+	if err := convertVia(src.Spec.Immutable, &s.Spec.Immutable); err != nil {
+		return err
+	}
+	if err := convertVia(src.Spec.Encryption, &s.Spec.Encryption); err != nil {
+		return err
+	}
+	if err := convertVia(src.Spec.Notifications, &s.Spec.Notifications); err != nil {
+		return err
+	}
+
+	s.Status.Source = SourceStatus{State: SourceState(src.Status.SourceSecret), Version: src.Status.SourceVersion}
+	if err := convertVia(src.Status.Targets, &s.Status.Targets); err != nil {
+		return err
+	}
+	return convertVia(src.Status.Conditions, &s.Status.Conditions)
+}
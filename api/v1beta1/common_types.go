@@ -0,0 +1,202 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// Annotation set on every copy with the hash of the source data it was last written from
+	SourceHashAnnotation = "tattletale.dev/source-hash"
+	// Annotation set on every copy of a source outside of the cluster with the version it was last written from,
+	// e.g. the commit of a Git repository
+	SourceVersionAnnotation = "tattletale.dev/source-version"
+
+	// Label set on every immutable copy so older generations can be listed
+	ImmutableLabel = "tattletale.dev/immutable"
+	// Annotation set on every immutable copy with the name of the target it is a generation of
+	CopyOfAnnotation = "tattletale.dev/copy-of"
+
+	// Annotation set on every encrypted copy with the hash of the ciphertext written, to detect drift
+	CiphertextHashAnnotation = "tattletale.dev/ciphertext-hash"
+	// Annotation set on every encrypted copy with the fingerprint of the public key it is encrypted to
+	EncryptedToAnnotation = "tattletale.dev/encrypted-to"
+
+	// Annotation set on every signed copy with the shared object that wrote it, as Kind/namespace/name
+	SharedByAnnotation = "tattletale.dev/shared-by"
+	// Annotation set on every signed copy with the source it was written from, e.g. secret:namespace/name
+	SourceAnnotation = "tattletale.dev/source"
+	// Annotation set on every signed copy with the ed25519 signature of its provenance
+	SignatureAnnotation = "tattletale.dev/signature"
+	// Annotation set on every signed copy with the id of the key it is signed with
+	SigningKeyAnnotation = "tattletale.dev/signing-key"
+
+	// Annotation set on every shared object by the defaulting webhook with the user that created it,
+	// it can't be set or changed by users
+	CreatedByAnnotation = "tattletale.dev/created-by"
+)
+
+// AllNamespaces is the target namespace that copies to every namespace
+const AllNamespaces = "*"
+
+// SecretKeyReference points at a key of a secret in the namespace of the shared object
+type SecretKeyReference struct {
+	// The name of the secret
+	Name string `json:"name"`
+
+	// The key of the secret
+	Key string `json:"key"`
+}
+
+// ConditionType is the type of a condition of a shared object
+type ConditionType string
+
+const (
+	// The source was decrypted, only set for encrypted sources
+	ConditionDecrypted ConditionType = "Decrypted"
+	// Other shared objects with precedence write some of the copies, only set while they do
+	ConditionConflict ConditionType = "Conflict"
+	// The source is, through other shared objects, a copy of a copy of the shared object, which isn't synced
+	// while it is
+	ConditionCycle ConditionType = "Cycle"
+	// The kind of a SharedResource may be shared and the operator has RBAC to read and write it
+	ConditionKindAllowed ConditionType = "KindAllowed"
+	// The content of the source or of a copy of a SharedResource can't be hashed, so it isn't synced.
+	// Only set while it can't.
+	ConditionHashFailed ConditionType = "HashFailed"
+)
+
+// Condition is the latest observation of one aspect of the state of a shared object
+type Condition struct {
+	// The type of the condition
+	Type ConditionType `json:"type"`
+
+	// True, False or Unknown
+	Status corev1.ConditionStatus `json:"status"`
+
+	// A machine readable reason for the last transition of the condition
+	Reason string `json:"reason,omitempty"`
+
+	// A human readable message about the last transition of the condition
+	Message string `json:"message,omitempty"`
+
+	// When the status of the condition last changed
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// ImmutableCopies writes every copy as a new object named after a hash of its content,
+// like kustomize's configMapGenerator, instead of updating the copy in place
+type ImmutableCopies struct {
+	// The number of older generations kept besides the current one, defaults to 2
+	// +kubebuilder:validation:Minimum=0
+	KeepGenerations *int32 `json:"keepGenerations,omitempty"`
+
+	// Older generations are deleted once they have existed this long, whatever KeepGenerations says
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+}
+
+// DriftPolicy decides what happens when a copy no longer matches what was last written to it
+// +kubebuilder:validation:Enum=Overwrite;Report;Ignore
+type DriftPolicy string
+
+const (
+	// Copies are always rewritten to match the source
+	DriftPolicyOverwrite DriftPolicy = "Overwrite"
+	// Drifted copies are left alone and the drift is recorded in status
+	DriftPolicyReport DriftPolicy = "Report"
+	// Copies are only written when the source changes
+	DriftPolicyIgnore DriftPolicy = "Ignore"
+)
+
+// TargetKind is the kind of object a copy is written as
+// +kubebuilder:validation:Enum=Secret;ConfigMap
+type TargetKind string
+
+const (
+	TargetKindSecret    TargetKind = "Secret"
+	TargetKindConfigMap TargetKind = "ConfigMap"
+)
+
+// TargetState is the observed sync state of a single copy
+type TargetState string
+
+const (
+	TargetStateSynced           TargetState = "Synced"
+	TargetStateDrifted          TargetState = "Drifted"
+	TargetStateNamespaceMissing TargetState = "NamespaceMissing"
+	TargetStateForbidden        TargetState = "Forbidden"
+	TargetStateKeyMissing       TargetState = "KeyMissing"
+	// The target namespace is a pattern that can't be parsed
+	TargetStateInvalid TargetState = "Invalid"
+	// Another shared object of the same kind with precedence writes the copy
+	TargetStateConflict TargetState = "Conflict"
+)
+
+// Stores the observed state of a single copy in a target namespace
+type TargetStatus struct {
+	// The namespace of the copy
+	Namespace string `json:"namespace"`
+
+	// The name of the copy
+	Name string `json:"name"`
+
+	// The kind of the copy, only set when it isn't the kind of the source
+	Kind TargetKind `json:"kind,omitempty"`
+
+	// The name of the current generation of an immutable copy, pods should mount this one
+	CurrentName string `json:"currentName,omitempty"`
+
+	// The sync state of the copy
+	State TargetState `json:"state"`
+
+	// The hash of the source data last written to the copy
+	Hash string `json:"hash,omitempty"`
+
+	// Human readable detail about the state
+	Message string `json:"message,omitempty"`
+
+	// The last time the copy was written
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+}
+
+// CloudEventsMode is how a CloudEvent is encoded in a request
+// +kubebuilder:validation:Enum=Binary;Structured
+type CloudEventsMode string
+
+const (
+	// The event's attributes are sent as ce- headers and its data as the body
+	CloudEventsModeBinary CloudEventsMode = "Binary"
+	// The whole event is sent as an application/cloudevents+json body
+	CloudEventsModeStructured CloudEventsMode = "Structured"
+)
+
+// NotificationSink is an HTTP endpoint CloudEvents are POSTed to
+type NotificationSink struct {
+	// The URL of the endpoint, its host must be one the operator config allows
+	URL string `json:"url"`
+
+	// How events are encoded, defaults to Binary
+	// +optional
+	Mode CloudEventsMode `json:"mode,omitempty"`
+}
+
+// Notifications configures the CloudEvents sent about the sync of a shared object
+type Notifications struct {
+	// The sinks events are sent to instead of those of the operator config
+	Sinks []NotificationSink `json:"sinks,omitempty"`
+}
@@ -21,20 +21,66 @@ import (
 
 // Stores the namespace of a target and an optional 'NewName' if the configmap will be renamed in the target namespace
 type TargetConfigMap struct {
+	// The namespace to copy to, or a pattern matched against every namespace: * for all namespaces,
+	// a glob such as team-*-prod or a regular expression between slashes such as /team-(a|b)-prod/
 	Namespace string `json:"namespace"`
 	NewName   string `json:"newName,omitempty"`
+
+	// Overrides the drift policy of the SharedConfigMap for this target
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+
+	// The kind of the copy, defaults to ConfigMap
+	Kind TargetKind `json:"kind,omitempty"`
+}
+
+// ConfigMapSource reads the data of a SharedConfigMap from outside of the cluster
+type ConfigMapSource struct {
+	// Files of a Git repository
+	Git *GitSource `json:"git,omitempty"`
+
+	// How often the source is read again, defaults to 5m
+	PollInterval *metav1.Duration `json:"pollInterval,omitempty"`
+}
+
+// GitSource reads files of a Git repository, one key per file named after the file
+type GitSource struct {
+	// The URL of the repository, it must be one the operator allows
+	URL string `json:"url"`
+
+	// The branch, tag or commit to read, defaults to the default branch of the repository
+	Ref string `json:"ref,omitempty"`
+
+	// A glob matching the paths of the files to read relative to the root of the repository, e.g. config/*.yaml.
+	// Defaults to every file at the root of the repository.
+	Path string `json:"path,omitempty"`
 }
 
 // SharedConfigMapSpec defines the desired state of SharedConfigMap
 type SharedConfigMapSpec struct {
 	// The name of the source configmap to be shared
-	SourceConfigMap string `json:"sourceConfigMap"`
+	SourceConfigMap string `json:"sourceConfigMap,omitempty"`
 
 	// The namespace of the source configmap to be shared
-	SourceNamespace string `json:"sourceNamespace"`
+	SourceNamespace string `json:"sourceNamespace,omitempty"`
+
+	// Reads the data to share from outside of the cluster instead of from the source configmap
+	Source *ConfigMapSource `json:"source,omitempty"`
 
 	// The list of target namespaces to sync to
 	Targets []TargetConfigMap `json:"targets"`
+
+	// What to do when a copy is edited outside of tattletale, defaults to Overwrite
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+
+	// Decides which SharedConfigMap writes a copy several of them target: the highest priority wins, then the
+	// oldest one. Defaults to 0.
+	Priority int32 `json:"priority,omitempty"`
+
+	// Write immutable, content-addressed copies instead of updating copies in place
+	Immutable *ImmutableCopies `json:"immutable,omitempty"`
+
+	// Where CloudEvents about the sync of this SharedConfigMap are sent
+	Notifications *Notifications `json:"notifications,omitempty"`
 }
 
 // SharedConfigMapStatus defines the observed state of SharedConfigMap
@@ -42,11 +88,21 @@ type SharedConfigMapStatus struct {
 	// The status of the source configmap to be shared
 	SourceConfigMap string `json:"sourceConfigMap"`
 
+	// The version of the source last read, e.g. the commit of a Git repository, when the source has one
+	SourceVersion string `json:"sourceVersion,omitempty"`
+
 	// The status of target configmap to be synched
 	TargetConfigMaps []string `json:"targetConfigMaps"`
+
+	// The observed state of every copy
+	Targets []TargetStatus `json:"targets,omitempty"`
+
+	// The latest observations of the state of the SharedConfigMap
+	Conditions []Condition `json:"conditions,omitempty"`
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:storageversion
 // +kubebuilder:subresource:status
 
 // SharedConfigMap is the Schema for the sharedconfigmaps API
@@ -67,6 +123,26 @@ type SharedConfigMapList struct {
 	Items           []SharedConfigMap `json:"items"`
 }
 
+// TargetName returns the name of the copy written for a target. Copies of configmaps read from outside of
+// the cluster are named after the SharedConfigMap unless the target renames them.
+func (c *SharedConfigMap) TargetName(t TargetConfigMap) string {
+	if t.NewName != "" {
+		return t.NewName
+	}
+	if c.Spec.Source != nil {
+		return c.Name
+	}
+	return c.Spec.SourceConfigMap
+}
+
+// TargetKind returns the kind of the copy written for a target
+func (c *SharedConfigMap) TargetKind(t TargetConfigMap) TargetKind {
+	if t.Kind != "" {
+		return t.Kind
+	}
+	return TargetKindConfigMap
+}
+
 func init() {
 	SchemeBuilder.Register(&SharedConfigMap{}, &SharedConfigMapList{})
 }
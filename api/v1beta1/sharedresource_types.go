@@ -0,0 +1,91 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Stores the namespace of a target and an optional 'NewName' if the resource will be renamed in the target namespace
+type TargetResource struct {
+	Namespace string `json:"namespace"`
+	NewName   string `json:"newName,omitempty"`
+
+	// Overrides the drift policy of the SharedResource for this target
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+}
+
+// SharedResourceSpec defines the desired state of SharedResource
+type SharedResourceSpec struct {
+	// The apiVersion of the resource to be shared, e.g. networking.k8s.io/v1
+	APIVersion string `json:"apiVersion"`
+
+	// The kind of the resource to be shared, e.g. NetworkPolicy. Must be namespaced and
+	// allowed in the operator configuration.
+	Kind string `json:"kind"`
+
+	// The name of the source resource to be shared
+	SourceName string `json:"sourceName"`
+
+	// The namespace of the source resource to be shared
+	SourceNamespace string `json:"sourceNamespace"`
+
+	// The list of target namespaces to sync to
+	Targets []TargetResource `json:"targets"`
+
+	// What to do when a copy is edited outside of tattletale, defaults to Overwrite
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+}
+
+// SharedResourceStatus defines the observed state of SharedResource
+type SharedResourceStatus struct {
+	// The status of the source resource to be shared
+	Source string `json:"source"`
+
+	// Human readable detail about the status of the source
+	Message string `json:"message,omitempty"`
+
+	// The observed state of every copy
+	Targets []TargetStatus `json:"targets,omitempty"`
+
+	// The latest observations of the state of the sharedresource
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// SharedResource is the Schema for the sharedresources API
+type SharedResource struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SharedResourceSpec   `json:"spec,omitempty"`
+	Status SharedResourceStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// SharedResourceList contains a list of SharedResource
+type SharedResourceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SharedResource `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SharedResource{}, &SharedResourceList{})
+}
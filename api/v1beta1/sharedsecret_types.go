@@ -21,20 +21,142 @@ import (
 
 // Stores the namespace of a target and an optional 'NewName' if the secret will be renamed in the target namespace
 type TargetSecret struct {
+	// The namespace to copy to, or a pattern matched against every namespace: * for all namespaces,
+	// a glob such as team-*-prod or a regular expression between slashes such as /team-(a|b)-prod/
 	Namespace string `json:"namespace"`
 	NewName   string `json:"newName,omitempty"`
+
+	// Overrides the drift policy of the SharedSecret for this target
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+
+	// Overrides the encryption of the SharedSecret for this target
+	Encryption *SecretEncryption `json:"encryption,omitempty"`
+
+	// The kind of the copy, defaults to Secret. ConfigMap copies hold the secret's values in plaintext
+	// and are only written when the operator config allows it.
+	Kind TargetKind `json:"kind,omitempty"`
+}
+
+// SecretEncryption writes copies encrypted to a public key published in the target namespace,
+// so only the holder of the matching private key can read them
+type SecretEncryption struct {
+	// The name of the configmap in the target namespace holding the base64 encoded Curve25519 public key
+	PublicKeyConfigMap string `json:"publicKeyConfigMap"`
+
+	// The key of the public key in the configmap, defaults to publicKey
+	PublicKeyKey string `json:"publicKeyKey,omitempty"`
+}
+
+// SecretSource reads the data of a SharedSecret from outside of the cluster. Exactly one provider must be set.
+type SecretSource struct {
+	// A file mounted into the operator pod
+	File *FileSource `json:"file,omitempty"`
+
+	// An HTTP(S) endpoint
+	HTTP *HTTPSource `json:"http,omitempty"`
+
+	// A secret of a HashiCorp Vault KV version 2 engine
+	Vault *VaultSource `json:"vault,omitempty"`
+
+	// A SOPS encrypted file stored in a configmap
+	SOPS *SOPSSource `json:"sops,omitempty"`
+
+	// How often the source is read again, defaults to 5m
+	PollInterval *metav1.Duration `json:"pollInterval,omitempty"`
+}
+
+// FileSource reads a JSON object of string values from a file, or every file of a directory as a key,
+// below the file source directory of the operator
+type FileSource struct {
+	// The path of the file or directory, relative to the file source directory
+	Path string `json:"path"`
+}
+
+// HTTPSource reads a JSON object of string values from an HTTP(S) endpoint. The endpoint is only downloaded
+// again once its ETag changes.
+type HTTPSource struct {
+	// The URL of the endpoint, its host must be one the operator allows
+	URL string `json:"url"`
+}
+
+// VaultSource reads a secret of a HashiCorp Vault KV version 2 engine. Every value of the secret must be a string.
+type VaultSource struct {
+	// The address of the Vault server, e.g. https://vault.example.com:8200. It must be one the operator allows.
+	Address string `json:"address"`
+
+	// The path the KV engine is mounted at, defaults to secret
+	Mount string `json:"mount,omitempty"`
+
+	// The path of the secret in the KV engine
+	Path string `json:"path"`
+
+	// How the operator authenticates to Vault
+	Auth VaultAuth `json:"auth"`
+}
+
+// VaultAuth configures how the operator logs in to Vault. Exactly one method must be set.
+type VaultAuth struct {
+	// A Vault token read from a secret in the namespace of the SharedSecret
+	TokenSecretRef *SecretKeyReference `json:"tokenSecretRef,omitempty"`
+
+	// The Kubernetes auth method
+	Kubernetes *VaultKubernetesAuth `json:"kubernetes,omitempty"`
+}
+
+// VaultKubernetesAuth logs in to Vault with a service account token
+type VaultKubernetesAuth struct {
+	// The path the auth method is mounted at, defaults to kubernetes
+	Mount string `json:"mount,omitempty"`
+
+	// The Vault role to log in as
+	Role string `json:"role"`
+
+	// The service account token to log in with, read from a secret in the namespace of the SharedSecret
+	ServiceAccountTokenSecretRef SecretKeyReference `json:"serviceAccountTokenSecretRef"`
+}
+
+// SOPSSource reads a file encrypted with SOPS to an age key from a configmap, and decrypts it in the operator.
+// The file holds either a map of values, or a Kubernetes Secret whose data and stringData are shared.
+type SOPSSource struct {
+	// The configmap holding the encrypted file, in the namespace of the SharedSecret
+	ConfigMap string `json:"configMap"`
+
+	// The key of the configmap holding the encrypted file
+	Key string `json:"key"`
+
+	// The age identities to decrypt with, read from a secret in the namespace of the SharedSecret
+	AgeKeySecretRef SecretKeyReference `json:"ageKeySecretRef"`
 }
 
 // SharedSecretSpec defines the desired state of SharedSecret
 type SharedSecretSpec struct {
 	// The name of the source secret to be shared
-	SourceSecret string `json:"sourceSecret"`
+	SourceSecret string `json:"sourceSecret,omitempty"`
 
 	// The namespace of the source secret to be shared
-	SourceNamespace string `json:"sourceNamespace"`
+	SourceNamespace string `json:"sourceNamespace,omitempty"`
+
+	// Reads the data to share from outside of the cluster instead of from the source secret
+	Source *SecretSource `json:"source,omitempty"`
 
 	// The list of target namespaces to sync to
 	Targets []TargetSecret `json:"targets"`
+
+	// What to do when a copy is edited outside of tattletale, defaults to Overwrite
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+
+	// Decides which SharedSecret writes a copy several of them target: the highest priority wins, then the
+	// oldest one. Defaults to 0.
+	Priority int32 `json:"priority,omitempty"`
+
+	// Write immutable, content-addressed copies instead of updating copies in place
+	Immutable *ImmutableCopies `json:"immutable,omitempty"`
+
+	// Encrypt the values of every copy to a public key published in its namespace
+	Encryption *SecretEncryption `json:"encryption,omitempty"`
+
+	// Where CloudEvents about the sync of this SharedSecret are sent
+	Notifications *Notifications `json:"notifications,omitempty"`
 }
 
 // SharedSecretStatus defines the observed state of SharedSecret
@@ -42,11 +164,21 @@ type SharedSecretStatus struct {
 	// The status of the source secret to be shared
 	SourceSecret string `json:"sourceSecret"`
 
+	// The version of the source last read, e.g. the version of a Vault secret, when the source has one
+	SourceVersion string `json:"sourceVersion,omitempty"`
+
 	// The status of target secrets to be synched
 	TargetSecrets []string `json:"targetSecrets"`
+
+	// The observed state of every copy
+	Targets []TargetStatus `json:"targets,omitempty"`
+
+	// The latest observations of the state of the SharedSecret
+	Conditions []Condition `json:"conditions,omitempty"`
 }
 
 // +kubebuilder:object:root=true
+// +kubebuilder:storageversion
 // +kubebuilder:subresource:status
 
 // SharedSecret is the Schema for the sharedsecrets API
@@ -67,6 +199,26 @@ type SharedSecretList struct {
 	Items           []SharedSecret `json:"items"`
 }
 
+// TargetName returns the name of the copy written for a target. Copies of secrets read from outside of
+// the cluster are named after the SharedSecret unless the target renames them.
+func (s *SharedSecret) TargetName(t TargetSecret) string {
+	if t.NewName != "" {
+		return t.NewName
+	}
+	if s.Spec.Source != nil {
+		return s.Name
+	}
+	return s.Spec.SourceSecret
+}
+
+// TargetKind returns the kind of the copy written for a target
+func (s *SharedSecret) TargetKind(t TargetSecret) TargetKind {
+	if t.Kind != "" {
+		return t.Kind
+	}
+	return TargetKindSecret
+}
+
 func init() {
 	SchemeBuilder.Register(&SharedSecret{}, &SharedSecretList{})
 }
@@ -0,0 +1,159 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package audit records every write tattletale makes to a copy, so it can be shown who changed a source
+// and where it was copied to. Records never hold any values.
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Action is what was done to a copy
+type Action string
+
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+)
+
+// Record is a single write to a copy
+type Record struct {
+	Time   time.Time `json:"time"`
+	Action Action    `json:"action"`
+
+	// The shared object the copy was written for
+	SharedObject ObjectRef `json:"sharedObject"`
+	// The source the copy was written from
+	Source Source `json:"source"`
+	// The copy written
+	Target ObjectRef `json:"target"`
+	// The hash of the source data written
+	Hash string `json:"hash,omitempty"`
+	// Who last changed the data of the source, from its managedFields
+	Actor string `json:"actor,omitempty"`
+}
+
+// ObjectRef points at an object in the cluster
+type ObjectRef struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// Source is the source of a copy
+type Source struct {
+	// The source, e.g. secret:namespace/name or http:https://config.example.com/app.json
+	Ref string `json:"ref"`
+	// The resourceVersion of a source in the cluster
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+	// The version of a source outside of the cluster, e.g. the commit of a Git repository
+	Version string `json:"version,omitempty"`
+}
+
+// Writer stores records
+type Writer interface {
+	Write(record Record) error
+}
+
+// JSONLinesWriter writes every record as a line of JSON
+type JSONLinesWriter struct {
+	w io.Writer
+	sync.Mutex
+}
+
+// NewJSONLinesWriter returns a writer of JSON lines to w
+func NewJSONLinesWriter(w io.Writer) *JSONLinesWriter {
+	return &JSONLinesWriter{w: w}
+}
+
+// Open returns a writer appending to the file at path, or writing to stdout when path is -
+func Open(path string) (*JSONLinesWriter, error) {
+	if path == "-" {
+		return NewJSONLinesWriter(os.Stdout), nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return NewJSONLinesWriter(f), nil
+}
+
+func (j *JSONLinesWriter) Write(record Record) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	j.Lock()
+	defer j.Unlock()
+	_, err = j.w.Write(append(b, '\n'))
+	return err
+}
+
+// MultiWriter writes every record to all of its writers
+type MultiWriter []Writer
+
+func (m MultiWriter) Write(record Record) error {
+	var first error
+	for _, w := range m {
+		if err := w.Write(record); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Actor returns the manager that last changed one of the top level fields of an object, e.g. data, or any
+// field when none are given. Managers whose fields aren't known are taken into account for every field.
+func Actor(managedFields []metav1.ManagedFieldsEntry, fields ...string) string {
+	actor := ""
+	var last time.Time
+	for _, entry := range managedFields {
+		if !touches(entry, fields) {
+			continue
+		}
+		// Applied entries have no time, they win over nothing but earlier entries of the list
+		var t time.Time
+		if entry.Time != nil {
+			t = entry.Time.Time
+		}
+		if actor == "" || !t.Before(last) {
+			actor, last = entry.Manager, t
+		}
+	}
+	return actor
+}
+
+func touches(entry metav1.ManagedFieldsEntry, fields []string) bool {
+	if len(fields) == 0 || entry.Fields == nil {
+		return true
+	}
+	for key := range entry.Fields.Map {
+		for _, f := range fields {
+			if strings.TrimPrefix(key, "f:") == f {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write(Record) error {
+	return errors.New("disk full")
+}
+
+var record = Record{
+	Time:         time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC),
+	Action:       ActionUpdate,
+	SharedObject: ObjectRef{Kind: "SharedSecret", Namespace: "default", Name: "db"},
+	Source:       Source{Ref: "secret:default/db", ResourceVersion: "42"},
+	Target:       ObjectRef{Kind: "Secret", Namespace: "team-a", Name: "db"},
+	Hash:         "abc",
+	Actor:        "kubectl",
+}
+
+func lines(s string) []string {
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+func TestJSONLinesWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewJSONLinesWriter(&buf)
+	for i := 0; i < 2; i++ {
+		if err := w.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	written := lines(buf.String())
+	if len(written) != 2 {
+		t.Fatalf("wrote %d lines, want a line per record", len(written))
+	}
+	var got, want interface{}
+	if err := json.Unmarshal([]byte(written[0]), &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(`{
+		"time": "2019-06-01T12:00:00Z",
+		"action": "update",
+		"sharedObject": {"kind": "SharedSecret", "namespace": "default", "name": "db"},
+		"source": {"ref": "secret:default/db", "resourceVersion": "42"},
+		"target": {"kind": "Secret", "namespace": "team-a", "name": "db"},
+		"hash": "abc",
+		"actor": "kubectl"
+	}`), &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrote %s, want %v", written[0], want)
+	}
+}
+
+func TestOpenAppends(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	for i := 0; i < 2; i++ {
+		w, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := lines(string(b))
+	if len(written) != 2 {
+		t.Fatalf("file has %d lines, want 2", len(written))
+	}
+	var decoded Record
+	if err := json.Unmarshal([]byte(written[1]), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, record) {
+		t.Errorf("read back %+v, want %+v", decoded, record)
+	}
+}
+
+func TestMultiWriter(t *testing.T) {
+	var buf bytes.Buffer
+	m := MultiWriter{failingWriter{}, NewJSONLinesWriter(&buf)}
+	if err := m.Write(record); err == nil || err.Error() != "disk full" {
+		t.Errorf("Write() error = %v, want disk full", err)
+	}
+	if buf.Len() == 0 {
+		t.Error("a failing writer kept the record from the next writers")
+	}
+}
+
+func TestActor(t *testing.T) {
+	at := func(h int) *metav1.Time {
+		t := metav1.NewTime(time.Date(2019, 6, 1, h, 0, 0, 0, time.UTC))
+		return &t
+	}
+	fields := func(keys ...string) *metav1.Fields {
+		f := &metav1.Fields{Map: map[string]metav1.Fields{}}
+		for _, k := range keys {
+			f.Map[k] = metav1.Fields{}
+		}
+		return f
+	}
+	managed := []metav1.ManagedFieldsEntry{
+		{Manager: "kubectl", Time: at(10), Fields: fields("f:data")},
+		{Manager: "helm", Time: at(11), Fields: fields("f:data", "f:metadata")},
+		{Manager: "labeler", Time: at(12), Fields: fields("f:metadata")},
+	}
+
+	tests := []struct {
+		name    string
+		managed []metav1.ManagedFieldsEntry
+		fields  []string
+		want    string
+	}{
+		{name: "data", managed: managed, fields: []string{"data", "stringData"}, want: "helm"},
+		{name: "any field", managed: managed, want: "labeler"},
+		{name: "unmanaged field", managed: managed, fields: []string{"binaryData"}},
+		{name: "no managed fields"},
+		{
+			// Entries of API servers whose fields can't be decoded count for every field
+			name:    "undecodable fields",
+			managed: append(managed, metav1.ManagedFieldsEntry{Manager: "argocd", Time: at(13)}),
+			fields:  []string{"data"},
+			want:    "argocd",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Actor(tt.managed, tt.fields...); got != tt.want {
+				t.Errorf("Actor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,605 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-tattletale inspects the sharing relationships managed by tattletale.
+// Installed on the PATH it can be used as a kubectl plugin: kubectl tattletale <command>.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+	"tattletale/inspect"
+	"tattletale/provenance"
+	"tattletale/sources"
+	"tattletale/utils"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/nacl/box"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/yaml"
+)
+
+const usage = `Usage: kubectl tattletale [--kubeconfig PATH] COMMAND [ARGS]
+
+Commands:
+  list                              List every SharedSecret, SharedConfigMap and SharedResource in the cluster
+  status KIND NAMESPACE/NAME        Show the sync state and hashes of every target of a shared object
+  explain KIND NAMESPACE/NAME        Show which shared objects read or write an object, e.g. a secret, a configmap
+                                    or networkpolicies.networking.k8s.io
+  graph [-o table|json|dot]         Print the source to target graph
+  rbac --namespaces NS[,NS...] [--service-account NAME] [--service-account-namespace NS]
+                                    Print the Roles and RoleBindings needed to run the manager with --namespaces
+  keygen --namespace NS --private-key-file PATH [--name NAME]
+                                    Generate a key pair for encrypted SharedSecret copies, write the private key
+                                    to PATH and print the public key ConfigMap to apply in NS
+  signing-keygen --private-key-file PATH
+                                    Generate a key for the manager's --signing-key-file, write it to PATH and
+                                    print the public key copies are verified with
+  verify --public-key-file PATH secret|configmap NAMESPACE/NAME
+                                    Check the signature of a copy with the public keys in PATH, one per line
+  migrate-storage                   Rewrite every SharedSecret and SharedConfigMap in the storage version of its
+                                    CRD, so older versions can be removed from the CRD
+`
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	_ = tattletalev1beta1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+}
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0), flag.Args()[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(command string, args []string, out io.Writer) error {
+	// rbac and keygen only generate manifests and don't need a cluster
+	switch command {
+	case "rbac":
+		return printRBAC(args, out)
+	case "keygen":
+		return keygen(args, out)
+	case "signing-keygen":
+		return signingKeygen(args, out)
+	}
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return err
+	}
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch command {
+	case "list":
+		return list(ctx, c, out)
+	case "status":
+		if len(args) != 2 {
+			return fmt.Errorf("status takes a kind and a NAMESPACE/NAME")
+		}
+		return status(ctx, c, args[0], args[1], out)
+	case "explain":
+		if len(args) != 2 {
+			return fmt.Errorf("explain takes a kind and a NAMESPACE/NAME")
+		}
+		mapper, err := apiutil.NewDiscoveryRESTMapper(cfg)
+		if err != nil {
+			return err
+		}
+		return explain(ctx, c, mapper, args[0], args[1], out)
+	case "graph":
+		fs := flag.NewFlagSet("graph", flag.ExitOnError)
+		format := fs.String("o", inspect.FormatTable, "Output format, one of table, json or dot")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		g, err := loadGraph(ctx, c)
+		if err != nil {
+			return err
+		}
+		return inspect.Render(out, *format, g.Edges)
+	case "verify":
+		return verify(ctx, c, args, out)
+	case "migrate-storage":
+		return migrateStorage(ctx, c, out)
+	}
+	return fmt.Errorf("unknown command %q\n%s", command, usage)
+}
+
+func loadGraph(ctx context.Context, c client.Client) (*inspect.Graph, error) {
+	var secrets tattletalev1beta1.SharedSecretList
+	var configmaps tattletalev1beta1.SharedConfigMapList
+	var resources tattletalev1beta1.SharedResourceList
+	if err := c.List(ctx, &secrets); err != nil {
+		return nil, err
+	}
+	if err := c.List(ctx, &configmaps); err != nil {
+		return nil, err
+	}
+	if err := c.List(ctx, &resources); err != nil {
+		return nil, err
+	}
+	namespaces, err := listNamespaces(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return inspect.NewGraph(secrets.Items, configmaps.Items, resources.Items, namespaces), nil
+}
+
+// listNamespaces returns the namespaces target namespace patterns are matched against, leaving out those
+// being deleted as the controllers do. It returns nil when the user may not list namespaces.
+func listNamespaces(ctx context.Context, c client.Client) ([]string, error) {
+	var list corev1.NamespaceList
+	if err := c.List(ctx, &list); err != nil {
+		if apierrors.IsForbidden(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	namespaces := []string{}
+	for _, ns := range list.Items {
+		if ns.Status.Phase != corev1.NamespaceTerminating {
+			namespaces = append(namespaces, ns.Name)
+		}
+	}
+	return namespaces, nil
+}
+
+func list(ctx context.Context, c client.Client, out io.Writer) error {
+	var secrets tattletalev1beta1.SharedSecretList
+	var configmaps tattletalev1beta1.SharedConfigMapList
+	var resources tattletalev1beta1.SharedResourceList
+	if err := c.List(ctx, &secrets); err != nil {
+		return err
+	}
+	if err := c.List(ctx, &configmaps); err != nil {
+		return err
+	}
+	if err := c.List(ctx, &resources); err != nil {
+		return err
+	}
+	namespaces, err := listNamespaces(ctx, c)
+	if err != nil {
+		return err
+	}
+	// Targets are counted once their namespace patterns are expanded
+	g := inspect.NewGraph(secrets.Items, configmaps.Items, resources.Items, namespaces)
+
+	tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tNAMESPACE\tNAME\tSOURCE\tTARGETS\tSYNCED")
+	for _, s := range secrets.Items {
+		source := s.Spec.SourceNamespace + "/" + s.Spec.SourceSecret
+		if s.Spec.Source != nil {
+			source = sources.Description(s.Spec.Source)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\n", inspect.KindSharedSecret, s.Namespace, s.Name,
+			source, len(g.Targets(inspect.KindSharedSecret, inspect.ObjectRef{Namespace: s.Namespace, Name: s.Name})), synced(s.Status.Targets))
+	}
+	for _, cm := range configmaps.Items {
+		source := cm.Spec.SourceNamespace + "/" + cm.Spec.SourceConfigMap
+		if cm.Spec.Source != nil && cm.Spec.Source.Git != nil {
+			source = sources.GitDescription(cm.Spec.Source.Git)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\n", inspect.KindSharedConfigMap, cm.Namespace, cm.Name,
+			source, len(g.Targets(inspect.KindSharedConfigMap, inspect.ObjectRef{Namespace: cm.Namespace, Name: cm.Name})), synced(cm.Status.Targets))
+	}
+	for _, r := range resources.Items {
+		kind := schema.FromAPIVersionAndKind(r.Spec.APIVersion, r.Spec.Kind).GroupKind()
+		source := fmt.Sprintf("%s %s/%s", kind, r.Spec.SourceNamespace, r.Spec.SourceName)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\n", inspect.KindSharedResource, r.Namespace, r.Name,
+			source, len(g.Targets(inspect.KindSharedResource, inspect.ObjectRef{Namespace: r.Namespace, Name: r.Name})), synced(r.Status.Targets))
+	}
+	return tw.Flush()
+}
+
+func synced(targets []tattletalev1beta1.TargetStatus) int {
+	n := 0
+	for _, t := range targets {
+		if t.State == tattletalev1beta1.TargetStateSynced {
+			n++
+		}
+	}
+	return n
+}
+
+func status(ctx context.Context, c client.Client, kind, name string, out io.Writer) error {
+	key, err := parseKey(name)
+	if err != nil {
+		return err
+	}
+
+	var statuses []tattletalev1beta1.TargetStatus
+	var objectKind schema.GroupVersionKind
+	switch strings.ToLower(kind) {
+	case "sharedsecret", "sharedsecrets":
+		var s tattletalev1beta1.SharedSecret
+		if err := c.Get(ctx, key, &s); err != nil {
+			return err
+		}
+		statuses, objectKind = s.Status.Targets, corev1.SchemeGroupVersion.WithKind("Secret")
+	case "sharedconfigmap", "sharedconfigmaps":
+		var cm tattletalev1beta1.SharedConfigMap
+		if err := c.Get(ctx, key, &cm); err != nil {
+			return err
+		}
+		statuses, objectKind = cm.Status.Targets, corev1.SchemeGroupVersion.WithKind("ConfigMap")
+	case "sharedresource", "sharedresources":
+		var r tattletalev1beta1.SharedResource
+		if err := c.Get(ctx, key, &r); err != nil {
+			return err
+		}
+		statuses, objectKind = r.Status.Targets, schema.FromAPIVersionAndKind(r.Spec.APIVersion, r.Spec.Kind)
+	default:
+		return fmt.Errorf("unknown kind %q, must be sharedsecret, sharedconfigmap or sharedresource", kind)
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAMESPACE\tNAME\tSTATE\tSYNCED-HASH\tLIVE-HASH\tLAST-SYNC\tMESSAGE")
+	for _, t := range statuses {
+		copyKind := objectKind
+		if t.Kind != "" {
+			copyKind = corev1.SchemeGroupVersion.WithKind(string(t.Kind))
+		}
+		// Immutable copies are read from their current generation
+		name := t.Name
+		if t.CurrentName != "" {
+			name = t.CurrentName
+		}
+		live, err := liveHash(ctx, c, copyKind, types.NamespacedName{Namespace: t.Namespace, Name: name})
+		if err != nil {
+			return err
+		}
+		lastSync := "<never>"
+		if t.LastSyncTime != nil {
+			lastSync = t.LastSyncTime.UTC().Format("2006-01-02T15:04:05Z")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", t.Namespace, t.Name, t.State, inspect.ShortHash(t.Hash), inspect.ShortHash(live), lastSync, t.Message)
+	}
+	return tw.Flush()
+}
+
+// liveHash hashes the data a copy holds right now, so it can be compared with the hash last synced. Copies
+// of another kind than their source are hashed in their own kind, as the controller records them: a secret
+// copy of a configmap by its data, a configmap copy of a secret by its data and binaryData. Copies of
+// SharedResources are hashed as a whole.
+func liveHash(ctx context.Context, c client.Client, objectKind schema.GroupVersionKind, key types.NamespacedName) (string, error) {
+	var err error
+	hash := ""
+	switch objectKind.GroupKind() {
+	case schema.GroupKind{Kind: "Secret"}:
+		var s corev1.Secret
+		if err = c.Get(ctx, key, &s); err == nil {
+			hash = utils.HashSecretData(s.Data)
+			// Encryption is randomized, an encrypted copy is only unchanged while it holds the ciphertext
+			// written, whose hash is recorded along with the hash it was written from
+			if _, ok := s.Annotations[tattletalev1beta1.EncryptedToAnnotation]; ok && hash == s.Annotations[tattletalev1beta1.CiphertextHashAnnotation] {
+				hash = s.Annotations[tattletalev1beta1.SourceHashAnnotation]
+			}
+		}
+	case schema.GroupKind{Kind: "ConfigMap"}:
+		var cm corev1.ConfigMap
+		if err = c.Get(ctx, key, &cm); err == nil {
+			hash = utils.HashConfigMapData(cm.Data, cm.BinaryData)
+		}
+	default:
+		u := &unstructured.Unstructured{}
+		u.SetGroupVersionKind(objectKind)
+		if err = c.Get(ctx, key, u); err == nil {
+			hash, err = utils.HashResource(u)
+		}
+	}
+	if apierrors.IsNotFound(err) {
+		return "", nil
+	}
+	return hash, err
+}
+
+// explain reports the shared objects reading or writing an object of any kind, SharedResources along with
+// SharedSecrets and SharedConfigMaps
+func explain(ctx context.Context, c client.Client, mapper meta.RESTMapper, kind, name string, out io.Writer) error {
+	key, err := parseKey(name)
+	if err != nil {
+		return err
+	}
+	gvk, err := kindFor(mapper, kind)
+	if err != nil {
+		return err
+	}
+
+	object := &unstructured.Unstructured{}
+	object.SetGroupVersionKind(gvk)
+	if err := c.Get(ctx, key, object); client.IgnoreNotFound(err) != nil {
+		return err
+	}
+	// Kinds of the core group, Secret and ConfigMap, have no group suffix
+	objectKind, annotations := gvk.GroupKind().String(), object.GetAnnotations()
+
+	g, err := loadGraph(ctx, c)
+	if err != nil {
+		return err
+	}
+	asSource, asTarget := g.Explain(objectKind, inspect.ObjectRef{Namespace: key.Namespace, Name: key.Name})
+
+	for _, e := range asTarget {
+		fmt.Fprintf(out, "%s %s is a copy of %s %s, owned by %s %s (state %s)\n",
+			objectKind, key, e.SourceKind(), e.Source, e.Kind, e.Owner, inspect.OrNone(string(e.State)))
+	}
+	for _, e := range asSource {
+		fmt.Fprintf(out, "%s %s is the source of %s %s, shared by %s %s\n",
+			objectKind, key, e.CopyKind(), e.Target, e.Kind, e.Owner)
+	}
+	if len(asSource) == 0 && len(asTarget) == 0 {
+		if _, ok := annotations[tattletalev1beta1.SourceHashAnnotation]; ok {
+			fmt.Fprintf(out, "%s %s was written by tattletale but no shared object owns it anymore\n", objectKind, key)
+		} else {
+			fmt.Fprintf(out, "%s %s is not managed by tattletale\n", objectKind, key)
+		}
+	}
+	return nil
+}
+
+// kindFor resolves a kind the way kubectl does, as a resource or kind name with an optional version and group,
+// e.g. secret, configmaps or networkpolicies.networking.k8s.io
+func kindFor(mapper meta.RESTMapper, arg string) (schema.GroupVersionKind, error) {
+	gvr, gr := schema.ParseResourceArg(strings.ToLower(arg))
+	if gvr != nil {
+		if gvk, err := mapper.KindFor(*gvr); err == nil {
+			return gvk, nil
+		}
+	}
+	gvk, err := mapper.KindFor(gr.WithVersion(""))
+	if err != nil {
+		return schema.GroupVersionKind{}, fmt.Errorf("unknown kind %q: %v", arg, err)
+	}
+	return gvk, nil
+}
+
+func printRBAC(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("rbac", flag.ExitOnError)
+	namespaces := fs.String("namespaces", "", "Comma separated list of namespaces the manager is restricted to")
+	serviceAccount := fs.String("service-account", "tattletale-default", "Service account the manager runs as")
+	serviceAccountNamespace := fs.String("service-account-namespace", "tattletale-system", "Namespace of the manager's service account")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *namespaces == "" {
+		return fmt.Errorf("rbac needs --namespaces")
+	}
+
+	for _, o := range utils.NamespacedRBAC(strings.Split(*namespaces, ","), *serviceAccount, *serviceAccountNamespace) {
+		b, err := yaml.Marshal(o)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "---\n%s", b)
+	}
+	return nil
+}
+
+func keygen(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	namespace := fs.String("namespace", "", "Namespace the encrypted copies are written to")
+	name := fs.String("name", "tattletale-public-key", "Name of the public key configmap")
+	privateKeyFile := fs.String("private-key-file", "", "File the base64 encoded private key is written to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *namespace == "" || *privateKeyFile == "" {
+		return fmt.Errorf("keygen needs --namespace and --private-key-file")
+	}
+
+	publicKey, privateKey, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(*privateKeyFile, []byte(base64.StdEncoding.EncodeToString(privateKey[:])+"\n"), 0600); err != nil {
+		return err
+	}
+
+	configmap := &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: *namespace, Name: *name},
+		Data:       map[string]string{utils.DefaultPublicKeyKey: base64.StdEncoding.EncodeToString(publicKey[:])},
+	}
+	b, err := yaml.Marshal(configmap)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "---\n%s", b)
+	return nil
+}
+
+func signingKeygen(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("signing-keygen", flag.ExitOnError)
+	privateKeyFile := fs.String("private-key-file", "", "File the base64 encoded private key is written to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *privateKeyFile == "" {
+		return fmt.Errorf("signing-keygen needs --private-key-file")
+	}
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(*privateKeyFile, []byte(base64.StdEncoding.EncodeToString(privateKey.Seed())+"\n"), 0600); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, base64.StdEncoding.EncodeToString(publicKey))
+	return nil
+}
+
+func verify(ctx context.Context, c client.Client, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	publicKeyFile := fs.String("public-key-file", "", "File holding the base64 encoded public keys copies may be signed with, one per line")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *publicKeyFile == "" || fs.NArg() != 2 {
+		return fmt.Errorf("verify needs --public-key-file, secret or configmap and a NAMESPACE/NAME")
+	}
+	b, err := ioutil.ReadFile(*publicKeyFile)
+	if err != nil {
+		return err
+	}
+	var keys []ed25519.PublicKey
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		key, err := provenance.ParsePublicKey(line)
+		if err != nil {
+			return fmt.Errorf("%s: %v", *publicKeyFile, err)
+		}
+		keys = append(keys, key)
+	}
+
+	key, err := parseKey(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	var p *provenance.Provenance
+	switch strings.ToLower(fs.Arg(0)) {
+	case "secret", "secrets":
+		var s corev1.Secret
+		if err := c.Get(ctx, key, &s); err != nil {
+			return err
+		}
+		p, err = provenance.VerifySecret(&s, keys...)
+	case "configmap", "configmaps":
+		var cm corev1.ConfigMap
+		if err := c.Get(ctx, key, &cm); err != nil {
+			return err
+		}
+		p, err = provenance.VerifyConfigMap(&cm, keys...)
+	default:
+		return fmt.Errorf("unknown kind %q, must be secret or configmap", fs.Arg(0))
+	}
+	if err != nil {
+		return fmt.Errorf("%s %s: %v", fs.Arg(0), key, err)
+	}
+
+	fmt.Fprintf(out, "%s %s is signed with key %s\n", fs.Arg(0), key, p.KeyID)
+	fmt.Fprintf(out, "shared by %s from %s (hash %s", p.SharedBy, p.Source, inspect.OrNone(p.SourceHash))
+	if p.SourceVersion != "" {
+		fmt.Fprintf(out, ", version %s", p.SourceVersion)
+	}
+	fmt.Fprintln(out, ")")
+	return nil
+}
+
+// migratedCRDs are the CRDs served in more than one version
+var migratedCRDs = []string{"sharedsecrets.tattletale.tattletale.dev", "sharedconfigmaps.tattletale.tattletale.dev"}
+
+// migrateStorage rewrites every object of the CRDs served in more than one version, which makes the API
+// server store it in the current storage version, then records that version as the only one stored.
+// Objects are read and written as unstructured so fields of versions this binary doesn't know survive.
+func migrateStorage(ctx context.Context, c client.Client, out io.Writer) error {
+	for _, name := range migratedCRDs {
+		crd := &unstructured.Unstructured{}
+		crd.SetGroupVersionKind(schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1beta1", Kind: "CustomResourceDefinition"})
+		if err := c.Get(ctx, client.ObjectKey{Name: name}, crd); err != nil {
+			return err
+		}
+		group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+		storage := ""
+		versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+		for _, v := range versions {
+			if v, ok := v.(map[string]interface{}); ok && v["storage"] == true {
+				storage, _ = v["name"].(string)
+			}
+		}
+		if storage == "" {
+			return fmt.Errorf("CRD %s has no storage version", name)
+		}
+
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(schema.GroupVersionKind{Group: group, Version: storage, Kind: kind + "List"})
+		if err := c.List(ctx, list); err != nil {
+			return err
+		}
+		for i := range list.Items {
+			obj := &list.Items[i]
+			key := client.ObjectKey{Namespace: obj.GetNamespace(), Name: obj.GetName()}
+			err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+				err := c.Update(ctx, obj)
+				if apierrors.IsConflict(err) {
+					// Read the object again to retry with its latest resource version
+					if err := c.Get(ctx, key, obj); err != nil {
+						return err
+					}
+				}
+				return err
+			})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("migrating %s %s: %v", kind, key, err)
+			}
+		}
+
+		if err := unstructured.SetNestedStringSlice(crd.Object, []string{storage}, "status", "storedVersions"); err != nil {
+			return err
+		}
+		if err := c.Status().Update(ctx, crd); err != nil {
+			return fmt.Errorf("recording the stored versions of CRD %s: %v", name, err)
+		}
+		fmt.Fprintf(out, "%s: %d objects stored as %s\n", name, len(list.Items), storage)
+	}
+	return nil
+}
+
+func parseKey(name string) (types.NamespacedName, error) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return types.NamespacedName{}, fmt.Errorf("%q is not of the form NAMESPACE/NAME", name)
+	}
+	return types.NamespacedName{Namespace: parts[0], Name: parts[1]}, nil
+}
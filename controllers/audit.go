@@ -0,0 +1,70 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	"tattletale/audit"
+
+	"github.com/go-logr/logr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// auditTrail records the writes to copies of a single reconcile. It does nothing when auditing is disabled.
+type auditTrail struct {
+	writer audit.Writer
+	log    logr.Logger
+	record audit.Record
+}
+
+// newAuditTrail describes the shared object and its source once. source is nil for sources outside of the
+// cluster, dataFields are the fields of the source its actor is looked up for. hash is the hash recorded on
+// the copies written.
+func newAuditTrail(writer audit.Writer, log logr.Logger, kind string, shared metav1.Object, sourceRef string,
+	source metav1.Object, sourceVersion, hash string, dataFields ...string) *auditTrail {
+	a := &auditTrail{writer: writer, log: log}
+	a.record = audit.Record{
+		SharedObject: audit.ObjectRef{Kind: kind, Namespace: shared.GetNamespace(), Name: shared.GetName()},
+		Source:       audit.Source{Ref: sourceRef, Version: sourceVersion},
+		Hash:         hash,
+	}
+	if source != nil {
+		a.record.Source.ResourceVersion = source.GetResourceVersion()
+		a.record.Actor = audit.Actor(source.GetManagedFields(), dataFields...)
+	}
+	return a
+}
+
+// write records a write to a copy. Failing to record it doesn't fail the reconcile, the copy is written already.
+func (a *auditTrail) write(action audit.Action, kind, namespace, name string) {
+	a.writeHash(action, kind, namespace, name, a.record.Hash)
+}
+
+// writeHash records a write to a copy recorded with another hash, e.g. an encrypted copy or an expired generation
+func (a *auditTrail) writeHash(action audit.Action, kind, namespace, name, hash string) {
+	if a.writer == nil {
+		return
+	}
+	record := a.record
+	record.Time = time.Now().UTC()
+	record.Action = action
+	record.Target = audit.ObjectRef{Kind: kind, Namespace: namespace, Name: name}
+	record.Hash = hash
+	if err := a.writer.Write(record); err != nil {
+		a.log.Error(err, "unable to write audit record", "action", action, "namespace", namespace, "name", name)
+	}
+}
@@ -0,0 +1,468 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+	"tattletale/audit"
+	"tattletale/provenance"
+	"tattletale/utils"
+)
+
+// copyObject is a copy written by a shared object, a secret or a configmap
+type copyObject interface {
+	runtime.Object
+	metav1.Object
+}
+
+// copyTarget is a copy to write, once target namespace patterns are expanded
+type copyTarget struct {
+	namespace   string
+	name        string
+	driftPolicy tattletalev1beta1.DriftPolicy
+	// The public key the copy is encrypted to, nil when it is written in plaintext
+	encryption *tattletalev1beta1.SecretEncryption
+}
+
+// targetCopies writes the copies of one kind of a shared object, whether or not it is the kind of its
+// source. Copies of the other kind, configmaps of a SharedSecret or secrets of a SharedConfigMap, are
+// never immutable and configmaps are never encrypted.
+type targetCopies struct {
+	client.Client
+	log      logr.Logger
+	recorder record.EventRecorder
+
+	allowedNamespaces   sets.String
+	excludedNamespaces  sets.String
+	protectedNamespaces sets.String
+	signer              *provenance.Signer
+
+	// The shared object, its kind and its previously recorded targets
+	object   runtime.Object
+	meta     metav1.Object
+	kind     string
+	previous []tattletalev1beta1.TargetStatus
+	// Copies are written under a new name every time the source changes when set
+	immutable *tattletalev1beta1.ImmutableCopies
+
+	// The kind of the source and of the copies, and the shared objects of every kind writing them
+	sourceKind tattletalev1beta1.TargetKind
+	copyKind   tattletalev1beta1.TargetKind
+	writers    utils.CopyWriterSet
+	// Why copies of this kind may not be written, empty when they may
+	forbidden string
+
+	// The values of the source, as the data of a secret and as the data of a configmap
+	values        map[string][]byte
+	data          map[string]string
+	binaryData    map[string][]byte
+	sourceRef     string
+	sourceVersion string
+
+	trail         *auditTrail
+	notifications *syncNotifications
+
+	// Copies in sync with the source, as namespace/name
+	synced []string
+	// Copies written by other shared objects taking precedence, see setConflictCondition
+	conflicts []string
+}
+
+// ofKind returns the copies of the given kind of the same shared object
+func (c targetCopies) ofKind(copyKind tattletalev1beta1.TargetKind, writers utils.CopyWriterSet) *targetCopies {
+	c.copyKind = copyKind
+	c.writers = writers
+	return &c
+}
+
+// newCopy returns an empty copy of the kind written
+func (c *targetCopies) newCopy() copyObject {
+	if c.copyKind == tattletalev1beta1.TargetKindSecret {
+		return &corev1.Secret{}
+	}
+	return &corev1.ConfigMap{}
+}
+
+// sync writes the copy of a target and returns its status
+func (c *targetCopies) sync(ctx context.Context, t copyTarget) (tattletalev1beta1.TargetStatus, error) {
+	noun := strings.ToLower(string(c.copyKind))
+	crossKind := c.copyKind != c.sourceKind
+	newStatus := func(state tattletalev1beta1.TargetState, hash string, written bool) tattletalev1beta1.TargetStatus {
+		status := utils.NewTargetStatus(c.previous, t.namespace, t.name, state, hash, written)
+		if crossKind {
+			status.Kind = c.copyKind
+		}
+		return status
+	}
+
+	// Skip copies that can't be written as their kind
+	state, reason, message := tattletalev1beta1.TargetStateInvalid, utils.EventReasonInvalid, ""
+	switch {
+	case c.forbidden != "":
+		state, reason, message = tattletalev1beta1.TargetStateForbidden, utils.EventReasonForbidden, c.forbidden
+	case t.encryption != nil && c.copyKind != tattletalev1beta1.TargetKindSecret:
+		message = EncryptedConfigMapMessage
+	case c.immutable != nil && crossKind:
+		message = ImmutableKindMessage
+	}
+	if message != "" {
+		c.log.V(1).Info("copy can't be written. skipping sync", "namespace", t.namespace, "kind", c.copyKind, "reason", message)
+		c.recorder.Eventf(c.object, corev1.EventTypeWarning, reason, "%s %s/%s was not written: %s", noun, t.namespace, t.name, message)
+		status := newStatus(state, "", false)
+		status.Message = message
+		return status, nil
+	}
+
+	// Skip namespaces the operator may not write to
+	if !utils.NamespaceAllowed(c.allowedNamespaces, c.excludedNamespaces, t.namespace) {
+		c.log.V(1).Info("namespace is not allowed. skipping sync", "namespace", t.namespace)
+		c.recorder.Eventf(c.object, corev1.EventTypeWarning, utils.EventReasonForbidden, "target namespace %s is outside of the namespaces the operator may write to", t.namespace)
+		status := newStatus(tattletalev1beta1.TargetStateForbidden, "", false)
+		status.Message = ForbiddenMessage
+		return status, nil
+	}
+
+	// Skip protected namespaces, even when they are targeted explicitly
+	if c.protectedNamespaces.Has(t.namespace) {
+		c.log.V(1).Info("namespace is protected. skipping sync", "namespace", t.namespace)
+		c.recorder.Eventf(c.object, corev1.EventTypeWarning, utils.EventReasonForbidden, "target namespace %s is protected", t.namespace)
+		status := newStatus(tattletalev1beta1.TargetStateForbidden, "", false)
+		status.Message = ProtectedMessage
+		return status, nil
+	}
+
+	// Skip copies written by another shared object taking precedence
+	winner, err := c.writers.Winner(ctx, c.object, t.namespace, t.name)
+	if err != nil {
+		c.log.Error(err, "unable to list shared objects writing the copy")
+		c.recorder.Eventf(c.object, corev1.EventTypeWarning, utils.EventReasonFailed, "unable to list shared objects writing %s %s/%s: %v", noun, t.namespace, t.name, err)
+		return tattletalev1beta1.TargetStatus{}, err
+	}
+	if winner != nil {
+		w := utils.RefOf(winner)
+		c.log.V(1).Info("copy is written by another shared object. skipping sync", "namespace", t.namespace, "writer", w.String())
+		c.recorder.Eventf(c.object, corev1.EventTypeWarning, utils.EventReasonTargetConflict, "%s %s/%s is written by %s %s/%s, which takes precedence", noun, t.namespace, t.name, strings.ToLower(w.Kind), w.Namespace, w.Name)
+		status := newStatus(tattletalev1beta1.TargetStateConflict, "", false)
+		status.Message = conflictMessage(w.Kind, w.Namespace, w.Name)
+		c.conflicts = append(c.conflicts, fmt.Sprintf("%s %s/%s by %s", noun, t.namespace, t.name, w.String()))
+		return status, nil
+	}
+
+	// Skip if namespace does not exist
+	var namespace corev1.Namespace
+	if err := getNamespace(ctx, c, c.allowedNamespaces, t.namespace, &namespace); err != nil {
+		if !apierrors.IsNotFound(err) {
+			c.log.Error(err, "unable to get namespace")
+			c.recorder.Eventf(c.object, corev1.EventTypeWarning, utils.EventReasonFailed, "unable to get target namespace %s: %v", t.namespace, err)
+			return tattletalev1beta1.TargetStatus{}, err
+		}
+		c.log.V(1).Info("namespace does not exist. skipping sync", "namespace", t.namespace)
+		c.recorder.Eventf(c.object, corev1.EventTypeWarning, utils.EventReasonNamespaceMissing, "target namespace %s does not exist", t.namespace)
+		return newStatus(tattletalev1beta1.TargetStateNamespaceMissing, "", false), nil
+	}
+
+	// Copies are hashed as the kind they are written as, so drift is told from the data they hold.
+	// Encrypted copies are hashed with the public key, so rotating the key writes them again.
+	targetHash := c.sourceHash()
+	var publicKey *[32]byte
+	if t.encryption != nil {
+		key, message, err := c.getPublicKey(ctx, t.namespace, t.encryption)
+		if err != nil {
+			c.log.Error(err, "unable to get public key", "namespace", t.namespace)
+			c.recorder.Eventf(c.object, corev1.EventTypeWarning, utils.EventReasonFailed, "unable to get public key configmap %s/%s: %v", t.namespace, t.encryption.PublicKeyConfigMap, err)
+			return tattletalev1beta1.TargetStatus{}, err
+		}
+		if key == nil {
+			c.log.V(1).Info("public key is missing. skipping sync", "namespace", t.namespace, "reason", message)
+			c.recorder.Eventf(c.object, corev1.EventTypeWarning, utils.EventReasonKeyMissing, "%s %s/%s was not written: %s", noun, t.namespace, t.name, message)
+			status := newStatus(tattletalev1beta1.TargetStateKeyMissing, "", false)
+			status.Message = message
+			return status, nil
+		}
+		publicKey = key
+		targetHash = utils.EncryptedHash(targetHash, utils.KeyFingerprint(key))
+	}
+
+	// Immutable copies are written under a new name every time the source changes
+	objectName := t.name
+	generation := 0
+	if c.immutable != nil {
+		if previous := utils.FindTargetStatus(c.previous, t.namespace, t.name); previous != nil {
+			generation = utils.ImmutableGeneration(previous.CurrentName, t.name, targetHash)
+		}
+		objectName = utils.ImmutableGenerationName(t.name, targetHash, generation)
+	}
+
+	var found bool
+	var target copyObject
+	var recordedHash string
+	var decision utils.SyncDecision
+	for {
+		found = true
+		target = c.newCopy()
+		if err := c.Get(ctx, client.ObjectKey{Namespace: t.namespace, Name: objectName}, target); err != nil {
+			if !apierrors.IsNotFound(err) {
+				c.log.Error(err, "unable to get copy", "kind", c.copyKind)
+				c.recorder.Eventf(c.object, corev1.EventTypeWarning, utils.EventReasonFailed, "unable to get %s %s/%s: %v", noun, t.namespace, objectName, err)
+				return tattletalev1beta1.TargetStatus{}, err
+			}
+			found = false
+		}
+
+		annotations := target.GetAnnotations()
+		recordedHash = annotations[tattletalev1beta1.SourceHashAnnotation]
+		currentHash := c.hashCopy(target)
+		if publicKey != nil && currentHash == annotations[tattletalev1beta1.CiphertextHashAnnotation] {
+			// Encryption is randomized, the ciphertext is only compared with what was written
+			currentHash = recordedHash
+		}
+		decision = utils.DecideSync(t.driftPolicy, found, targetHash, recordedHash, currentHash)
+
+		// Generations are never changed in place, a drifted one is replaced by the next generation
+		if c.immutable == nil || !decision.Drifted || !decision.Write {
+			break
+		}
+		c.log.V(1).Info("generation drifted from source. writing the next one", "namespace", t.namespace, "generation", objectName)
+		generation++
+		objectName = utils.ImmutableGenerationName(t.name, targetHash, generation)
+	}
+	// Copies that aren't signed with the current key are signed again, unless they drifted
+	resign := c.signer != nil && found && !decision.Drifted &&
+		target.GetAnnotations()[tattletalev1beta1.SigningKeyAnnotation] != c.signer.KeyID()
+
+	if !decision.Write && !resign {
+		status := newStatus(tattletalev1beta1.TargetStateSynced, recordedHash, false)
+		if c.immutable != nil {
+			status.CurrentName = objectName
+		}
+		if decision.Drifted {
+			c.log.V(1).Info("copy drifted from source. skipping sync", "namespace", t.namespace, "kind", c.copyKind, "driftPolicy", t.driftPolicy)
+			status.State = tattletalev1beta1.TargetStateDrifted
+			status.Message = DriftedMessage
+			c.recorder.Eventf(c.object, corev1.EventTypeWarning, utils.EventReasonSkipped, "%s %s/%s drifted from source and was left as is (driftPolicy %s)", noun, t.namespace, objectName, t.driftPolicy)
+		}
+		if err := c.pruneGenerations(ctx, t.namespace, t.name, objectName); err != nil {
+			return tattletalev1beta1.TargetStatus{}, err
+		}
+		c.synced = append(c.synced, t.namespace+"/"+objectName)
+		return status, nil
+	}
+
+	target.SetNamespace(t.namespace)
+	target.SetName(objectName)
+	annotations := target.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[tattletalev1beta1.SourceHashAnnotation] = targetHash
+	if c.sourceVersion != "" {
+		annotations[tattletalev1beta1.SourceVersionAnnotation] = c.sourceVersion
+	} else {
+		delete(annotations, tattletalev1beta1.SourceVersionAnnotation)
+	}
+	if c.immutable != nil {
+		labels, immutableAnnotations := utils.ImmutableLabels(t.name)
+		if target.GetLabels() == nil {
+			target.SetLabels(map[string]string{})
+		}
+		for k, val := range labels {
+			target.GetLabels()[k] = val
+		}
+		for k, val := range immutableAnnotations {
+			annotations[k] = val
+		}
+	}
+	target.SetAnnotations(annotations)
+	sharedBy := provenance.SharedBy(c.kind, c.meta.GetNamespace(), c.meta.GetName())
+	switch o := target.(type) {
+	case *corev1.Secret:
+		o.Data = c.values
+		delete(annotations, tattletalev1beta1.CiphertextHashAnnotation)
+		delete(annotations, tattletalev1beta1.EncryptedToAnnotation)
+		if publicKey != nil {
+			sealed, err := utils.SealSecretData(c.values, publicKey)
+			if err != nil {
+				c.log.Error(err, "unable to encrypt secret", "namespace", t.namespace)
+				c.recorder.Eventf(c.object, corev1.EventTypeWarning, utils.EventReasonFailed, "unable to encrypt secret %s/%s: %v", t.namespace, objectName, err)
+				return tattletalev1beta1.TargetStatus{}, err
+			}
+			o.Data = sealed
+			annotations[tattletalev1beta1.CiphertextHashAnnotation] = utils.HashSecretData(sealed)
+			annotations[tattletalev1beta1.EncryptedToAnnotation] = utils.KeyFingerprint(publicKey)
+		}
+		if c.signer != nil {
+			c.signer.SignSecret(o, sharedBy, c.sourceRef)
+		}
+	case *corev1.ConfigMap:
+		o.Data, o.BinaryData = c.data, c.binaryData
+		if c.signer != nil {
+			c.signer.SignConfigMap(o, sharedBy, c.sourceRef)
+		}
+	}
+	if c.signer == nil {
+		provenance.Unsign(target.GetAnnotations())
+	}
+
+	c.notifications.start()
+
+	action, reason, verb := audit.ActionCreate, utils.EventReasonCreated, "created"
+	if found {
+		action, reason, verb = audit.ActionUpdate, utils.EventReasonUpdated, "updated"
+		if decision.Drifted {
+			c.log.V(1).Info("copy drifted from source. overwriting", "namespace", t.namespace, "kind", c.copyKind, "driftPolicy", t.driftPolicy)
+		}
+		err = c.Update(ctx, target)
+	} else {
+		err = c.Create(ctx, target)
+	}
+	if err != nil {
+		if !found && apierrors.IsNotFound(err) {
+			// Only reachable when namespaces can't be read up front
+			c.log.V(1).Info("namespace does not exist. skipping sync", "namespace", t.namespace)
+			c.recorder.Eventf(c.object, corev1.EventTypeWarning, utils.EventReasonNamespaceMissing, "target namespace %s does not exist", t.namespace)
+			return newStatus(tattletalev1beta1.TargetStateNamespaceMissing, "", false), nil
+		}
+		c.log.Error(err, "unable to write copy in target namespace", "kind", c.copyKind)
+		if apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) {
+			c.recorder.Eventf(c.object, corev1.EventTypeWarning, utils.EventReasonConflicted, "%s %s/%s was modified concurrently: %v", noun, t.namespace, objectName, err)
+		} else {
+			c.recorder.Eventf(c.object, corev1.EventTypeWarning, utils.EventReasonFailed, "unable to write %s %s/%s: %v", noun, t.namespace, objectName, err)
+		}
+		c.notifications.targetFailed(t.namespace, objectName, err)
+		return tattletalev1beta1.TargetStatus{}, err
+	}
+	c.log.V(1).Info("Succesfully wrote copy", "namespace", t.namespace, "kind", c.copyKind)
+	c.trail.writeHash(action, string(c.copyKind), t.namespace, objectName, targetHash)
+	c.recorder.Eventf(c.object, corev1.EventTypeNormal, reason, "%s %s %s/%s", verb, noun, t.namespace, objectName)
+
+	if err := c.pruneGenerations(ctx, t.namespace, t.name, objectName); err != nil {
+		return tattletalev1beta1.TargetStatus{}, err
+	}
+
+	status := newStatus(tattletalev1beta1.TargetStateSynced, targetHash, true)
+	if c.immutable != nil {
+		status.CurrentName = objectName
+	}
+	c.notifications.targetUpdated(t.namespace, objectName)
+	c.synced = append(c.synced, t.namespace+"/"+objectName)
+	return status, nil
+}
+
+// sourceHash returns the hash of the values of the source as held by a copy of the kind written
+func (c *targetCopies) sourceHash() string {
+	if c.copyKind == tattletalev1beta1.TargetKindSecret {
+		return utils.HashSecretData(c.values)
+	}
+	return utils.HashConfigMapData(c.data, c.binaryData)
+}
+
+// hashCopy returns the hash of the data a copy holds
+func (c *targetCopies) hashCopy(o copyObject) string {
+	switch o := o.(type) {
+	case *corev1.Secret:
+		return utils.HashSecretData(o.Data)
+	case *corev1.ConfigMap:
+		return utils.HashConfigMapData(o.Data, o.BinaryData)
+	}
+	return ""
+}
+
+// pruneGenerations deletes the expired generations of an immutable copy
+func (c *targetCopies) pruneGenerations(ctx context.Context, namespace, name, current string) error {
+	if c.immutable == nil {
+		return nil
+	}
+
+	var list runtime.Object = &corev1.ConfigMapList{}
+	if c.copyKind == tattletalev1beta1.TargetKindSecret {
+		list = &corev1.SecretList{}
+	}
+	noun := strings.ToLower(string(c.copyKind))
+	if err := c.List(ctx, list, client.InNamespace(namespace), client.MatchingLabels{tattletalev1beta1.ImmutableLabel: "true"}); err != nil {
+		c.log.Error(err, "unable to list generations of "+noun, "namespace", namespace, "name", name)
+		return err
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+	generations := []utils.Generation{}
+	hashes := map[string]string{}
+	for _, item := range items {
+		o, err := meta.Accessor(item)
+		if err != nil {
+			return err
+		}
+		if o.GetAnnotations()[tattletalev1beta1.CopyOfAnnotation] == name {
+			generations = append(generations, utils.Generation{Name: o.GetName(), Created: o.GetCreationTimestamp().Time})
+			hashes[o.GetName()] = o.GetAnnotations()[tattletalev1beta1.SourceHashAnnotation]
+		}
+	}
+
+	for _, expired := range utils.ExpiredGenerations(c.immutable, generations, current, time.Now()) {
+		generation := c.newCopy()
+		generation.SetNamespace(namespace)
+		generation.SetName(expired)
+		if err := c.Delete(ctx, generation); client.IgnoreNotFound(err) != nil {
+			c.log.Error(err, "unable to delete expired generation of "+noun, "namespace", namespace, "name", expired)
+			c.recorder.Eventf(c.object, corev1.EventTypeWarning, utils.EventReasonFailed, "unable to delete expired generation %s/%s: %v", namespace, expired, err)
+			return err
+		}
+		c.recorder.Eventf(c.object, corev1.EventTypeNormal, utils.EventReasonDeleted, "deleted expired generation %s/%s of %s %s", namespace, expired, noun, name)
+		c.trail.writeHash(audit.ActionDelete, string(c.copyKind), namespace, expired, hashes[expired])
+	}
+	return nil
+}
+
+// getPublicKey reads the public key copies in a namespace are encrypted to. When the key is missing or
+// invalid it returns a nil key and the reason.
+func (c *targetCopies) getPublicKey(ctx context.Context, namespace string, encryption *tattletalev1beta1.SecretEncryption) (*[32]byte, string, error) {
+	var configmap corev1.ConfigMap
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: encryption.PublicKeyConfigMap}, &configmap); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, "", err
+		}
+		return nil, fmt.Sprintf("public key configmap %s/%s does not exist", namespace, encryption.PublicKeyConfigMap), nil
+	}
+	keyName := encryption.PublicKeyKey
+	if keyName == "" {
+		keyName = utils.DefaultPublicKeyKey
+	}
+	value, ok := configmap.Data[keyName]
+	if !ok {
+		return nil, fmt.Sprintf("public key configmap %s/%s has no key %s", namespace, encryption.PublicKeyConfigMap, keyName), nil
+	}
+	key, err := utils.ParsePublicKey(value)
+	if err != nil {
+		return nil, fmt.Sprintf("public key in configmap %s/%s is invalid: %v", namespace, encryption.PublicKeyConfigMap, err), nil
+	}
+	return key, "", nil
+}
@@ -0,0 +1,204 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+	"tattletale/utils"
+)
+
+// newTestCopies returns the secrets and configmaps written by a SharedSecret, in a cluster holding the
+// namespace team-a and the given objects
+func newTestCopies(t *testing.T, objs ...runtime.Object) (secrets, configmaps *targetCopies) {
+	s := runtime.NewScheme()
+	if err := scheme.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := tattletalev1beta1.AddToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	shared := &tattletalev1beta1.SharedSecret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db"}}
+	objs = append(objs, shared, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}})
+	c := fake.NewFakeClientWithScheme(s, objs...)
+
+	values := map[string][]byte{"password": []byte("hunter2")}
+	copies := targetCopies{
+		Client:        c,
+		log:           ctrl.Log.WithName("test"),
+		recorder:      record.NewFakeRecorder(10),
+		object:        shared,
+		meta:          shared,
+		kind:          "SharedSecret",
+		sourceKind:    tattletalev1beta1.TargetKindSecret,
+		values:        values,
+		sourceRef:     "secret:default/db",
+		trail:         newAuditTrail(nil, ctrl.Log, "SharedSecret", shared, "secret:default/db", nil, "", utils.HashSecretData(values)),
+		notifications: newSyncNotifications(nil, nil, shared, shared, "SharedSecret", "sharedsecrets", nil, "", ""),
+	}
+	copies.data, copies.binaryData = utils.ConfigMapDataFromSecret(values)
+	return copies.ofKind(tattletalev1beta1.TargetKindSecret, utils.NewSecretWriters(c, nil)),
+		copies.ofKind(tattletalev1beta1.TargetKindConfigMap, utils.NewConfigMapWriters(c, nil))
+}
+
+func TestTargetCopiesRefused(t *testing.T) {
+	encryption := &tattletalev1beta1.SecretEncryption{PublicKeyConfigMap: "public-key"}
+
+	// Copies that can't be written are refused the same way whichever kind they are written as
+	tests := []struct {
+		name      string
+		configmap bool
+		forbidden string
+		immutable bool
+		target    copyTarget
+		want      tattletalev1beta1.TargetState
+		message   string
+	}{
+		{
+			name:      "configmaps disabled",
+			configmap: true,
+			forbidden: ConfigMapTargetsDisabledMessage,
+			target:    copyTarget{namespace: "team-a", name: "db"},
+			want:      tattletalev1beta1.TargetStateForbidden,
+			message:   ConfigMapTargetsDisabledMessage,
+		},
+		{
+			name:      "encrypted configmap",
+			configmap: true,
+			target:    copyTarget{namespace: "team-a", name: "db", encryption: encryption},
+			want:      tattletalev1beta1.TargetStateInvalid,
+			message:   EncryptedConfigMapMessage,
+		},
+		{
+			name:      "immutable configmap",
+			configmap: true,
+			immutable: true,
+			target:    copyTarget{namespace: "team-a", name: "db"},
+			want:      tattletalev1beta1.TargetStateInvalid,
+			message:   ImmutableKindMessage,
+		},
+		{
+			name:    "encrypted secret without a public key",
+			target:  copyTarget{namespace: "team-a", name: "db", encryption: encryption},
+			want:    tattletalev1beta1.TargetStateKeyMissing,
+			message: "public key configmap team-a/public-key does not exist",
+		},
+		{
+			name:   "missing namespace",
+			target: copyTarget{namespace: "team-b", name: "db"},
+			want:   tattletalev1beta1.TargetStateNamespaceMissing,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			copies, configmaps := newTestCopies(t)
+			if tt.configmap {
+				copies = configmaps
+			}
+			copies.forbidden = tt.forbidden
+			if tt.immutable {
+				copies.immutable = &tattletalev1beta1.ImmutableCopies{}
+			}
+
+			status, err := copies.sync(context.Background(), tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.State != tt.want || status.Message != tt.message {
+				t.Errorf("sync() = %s %q, want %s %q", status.State, status.Message, tt.want, tt.message)
+			}
+			if len(copies.synced) != 0 {
+				t.Errorf("synced = %v, want none", copies.synced)
+			}
+		})
+	}
+}
+
+func TestTargetCopiesSync(t *testing.T) {
+	secrets, configmaps := newTestCopies(t)
+	ctx := context.Background()
+
+	// Copies of the source kind are listed as synced, copies of the other kind record their kind
+	status, err := secrets.sync(ctx, copyTarget{namespace: "team-a", name: "db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != tattletalev1beta1.TargetStateSynced || status.Kind != "" || len(secrets.synced) != 1 {
+		t.Errorf("secret status = %+v, synced %v", status, secrets.synced)
+	}
+	status, err = configmaps.sync(ctx, copyTarget{namespace: "team-a", name: "settings"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != tattletalev1beta1.TargetStateSynced || status.Kind != tattletalev1beta1.TargetKindConfigMap {
+		t.Errorf("configmap status = %+v", status)
+	}
+
+	var configmap corev1.ConfigMap
+	if err := configmaps.Get(ctx, client.ObjectKey{Namespace: "team-a", Name: "settings"}, &configmap); err != nil {
+		t.Fatal(err)
+	}
+	if configmap.Data["password"] != "hunter2" {
+		t.Errorf("configmap data = %v", configmap.Data)
+	}
+	if got, want := configmap.Annotations[tattletalev1beta1.SourceHashAnnotation], utils.HashConfigMapData(configmap.Data, configmap.BinaryData); got != want {
+		t.Errorf("configmap hash = %q, want %q", got, want)
+	}
+
+	// Copies in sync are left as they are
+	configmaps.previous = []tattletalev1beta1.TargetStatus{status}
+	previous := status.LastSyncTime
+	status, err = configmaps.sync(ctx, copyTarget{namespace: "team-a", name: "settings"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != tattletalev1beta1.TargetStateSynced || status.LastSyncTime != previous {
+		t.Errorf("configmap status = %+v, want synced without a write", status)
+	}
+}
+
+func TestTargetCopiesImmutable(t *testing.T) {
+	secrets, _ := newTestCopies(t)
+	secrets.immutable = &tattletalev1beta1.ImmutableCopies{}
+	ctx := context.Background()
+
+	status, err := secrets.sync(ctx, copyTarget{namespace: "team-a", name: "db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := utils.ImmutableGenerationName("db", utils.HashSecretData(secrets.values), 0)
+	if status.CurrentName != want {
+		t.Fatalf("current name = %q, want %q", status.CurrentName, want)
+	}
+	var secret corev1.Secret
+	if err := secrets.Get(ctx, client.ObjectKey{Namespace: "team-a", Name: want}, &secret); err != nil {
+		t.Fatal(err)
+	}
+	if secret.Labels[tattletalev1beta1.ImmutableLabel] != "true" || secret.Annotations[tattletalev1beta1.CopyOfAnnotation] != "db" {
+		t.Errorf("generation labels = %v, annotations = %v", secret.Labels, secret.Annotations)
+	}
+}
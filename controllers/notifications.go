@@ -0,0 +1,107 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+	"tattletale/notify"
+	"tattletale/utils"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// syncNotifications sends the CloudEvents about a single reconcile of a shared object. It does nothing
+// when the operator sends no notifications.
+type syncNotifications struct {
+	notifier *notify.Notifier
+	sinks    []tattletalev1beta1.NotificationSink
+	source   string
+	data     notify.Data
+	started  bool
+}
+
+// newSyncNotifications works out the sinks of a shared object, reporting the sinks it may not use
+func newSyncNotifications(notifier *notify.Notifier, recorder record.EventRecorder, object runtime.Object, meta metav1.Object,
+	kind, resource string, notifications *tattletalev1beta1.Notifications, sourceHash, sourceVersion string) *syncNotifications {
+	n := &syncNotifications{notifier: notifier}
+	if notifier == nil {
+		return n
+	}
+	var forbidden []tattletalev1beta1.NotificationSink
+	n.sinks, forbidden = notifier.SinksFor(notifications)
+	for _, s := range forbidden {
+		recorder.Eventf(object, corev1.EventTypeWarning, utils.EventReasonForbidden, "notification sink %s is not one the operator may send to", s.URL)
+	}
+	n.source = fmt.Sprintf("/apis/%s/namespaces/%s/%s/%s", tattletalev1beta1.GroupVersion, meta.GetNamespace(), resource, meta.GetName())
+	n.data = notify.Data{Kind: kind, Namespace: meta.GetNamespace(), Name: meta.GetName(), SourceHash: sourceHash, SourceVersion: sourceVersion}
+	return n
+}
+
+func (n *syncNotifications) send(eventType, subject string, data notify.Data) {
+	if len(n.sinks) == 0 {
+		return
+	}
+	n.notifier.Send(n.sinks, notify.NewEvent(eventType, n.source, subject, data))
+}
+
+// start is called before every copy is written, the first call announces the sync
+func (n *syncNotifications) start() {
+	if n.started {
+		return
+	}
+	n.started = true
+	n.send(notify.TypeSyncStarted, "", n.data)
+}
+
+func (n *syncNotifications) targetUpdated(namespace, name string) {
+	data := n.data
+	data.Target = &notify.Target{Namespace: namespace, Name: name, State: tattletalev1beta1.TargetStateSynced}
+	n.send(notify.TypeTargetUpdated, namespace+"/"+name, data)
+}
+
+func (n *syncNotifications) targetFailed(namespace, name string, err error) {
+	data := n.data
+	data.Target = &notify.Target{Namespace: namespace, Name: name}
+	data.Error = err.Error()
+	n.send(notify.TypeTargetFailed, namespace+"/"+name, data)
+}
+
+// finished announces the end of a sync that wrote copies, with the state of every target. It only
+// reports the sync completed when every target is synced.
+func (n *syncNotifications) finished(targets []tattletalev1beta1.TargetStatus) {
+	if !n.started {
+		return
+	}
+	eventType := notify.TypeSynced
+	data := n.data
+	data.Targets = make([]notify.Target, 0, len(targets))
+	for _, t := range targets {
+		if t.State != tattletalev1beta1.TargetStateSynced {
+			eventType = notify.TypeSyncPartial
+		}
+		name := t.Name
+		if t.CurrentName != "" {
+			name = t.CurrentName
+		}
+		data.Targets = append(data.Targets, notify.Target{Namespace: t.Namespace, Name: name, State: t.State})
+	}
+	n.send(eventType, "", data)
+}
@@ -0,0 +1,89 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+	"tattletale/notify"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func TestSyncNotificationsFinished(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []tattletalev1beta1.TargetStatus
+		want    string
+	}{
+		{
+			name: "every target synced",
+			targets: []tattletalev1beta1.TargetStatus{
+				{Namespace: "team-a", Name: "db", State: tattletalev1beta1.TargetStateSynced},
+				{Namespace: "team-b", Name: "db", State: tattletalev1beta1.TargetStateSynced},
+			},
+			want: notify.TypeSynced,
+		},
+		{
+			name: "some targets not synced",
+			targets: []tattletalev1beta1.TargetStatus{
+				{Namespace: "team-a", Name: "db", State: tattletalev1beta1.TargetStateSynced},
+				{Namespace: "team-b", Name: "db", State: tattletalev1beta1.TargetStateNamespaceMissing},
+				{Namespace: "kube-system", Name: "db", State: tattletalev1beta1.TargetStateForbidden},
+			},
+			want: notify.TypeSyncPartial,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			types := make(chan string, 10)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				types <- req.Header.Get("ce-type")
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+			notifier := notify.NewNotifier(ctrl.Log, []tattletalev1beta1.NotificationSink{{URL: server.URL}}, nil, 10, 0)
+			stop := make(chan struct{})
+			defer close(stop)
+			go func() { _ = notifier.Start(stop) }()
+
+			shared := &tattletalev1beta1.SharedSecret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db"}}
+			n := newSyncNotifications(notifier, record.NewFakeRecorder(10), shared, shared, "SharedSecret", "sharedsecrets", nil, "abc", "")
+			n.start()
+			n.finished(tt.targets)
+
+			got := []string{}
+			for len(got) < 2 {
+				select {
+				case eventType := <-types:
+					got = append(got, eventType)
+				case <-time.After(5 * time.Second):
+					t.Fatalf("got events %v, want 2", got)
+				}
+			}
+			if got[0] != notify.TypeSyncStarted || got[1] != tt.want {
+				t.Errorf("got events %v, want %s then %s", got, notify.TypeSyncStarted, tt.want)
+			}
+		})
+	}
+}
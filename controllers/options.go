@@ -0,0 +1,41 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"github.com/go-logr/logr"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"tattletale/utils"
+)
+
+// Options tunes how the shared object controllers work through their queues
+type Options struct {
+	// The number of shared objects reconciled in parallel, defaults to 1
+	MaxConcurrentReconciles int
+
+	// Paces the retries of failed reconciles, defaults to the controller's own rate limiter
+	RateLimiter workqueue.RateLimiter
+}
+
+func (o Options) controllerOptions(r reconcile.Reconciler, log logr.Logger) controller.Options {
+	if o.RateLimiter != nil {
+		r = &utils.RateLimitedReconciler{Reconciler: r, RateLimiter: o.RateLimiter, Log: log}
+	}
+	return controller.Options{MaxConcurrentReconciles: o.MaxConcurrentReconciles, Reconciler: r}
+}
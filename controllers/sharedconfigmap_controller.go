@@ -20,27 +20,61 @@ import (
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 
 	tattletalev1beta1 "tattletale/api/v1beta1"
+	"tattletale/audit"
+	"tattletale/notify"
+	"tattletale/provenance"
+	"tattletale/sources"
+	"tattletale/utils"
 )
 
 // SharedConfigMapReconciler reconciles a SharedConfigMap object
 type SharedConfigMapReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// Namespaces the operator may read and write in, empty when installed cluster wide
+	AllowedNamespaces sets.String
+	// Namespaces the operator ignores
+	ExcludedNamespaces sets.String
+	// Namespaces copies are never written to
+	ProtectedNamespaces sets.String
+
+	// Reads Git sources, nil when they are disabled
+	Git *sources.GitProvider
+
+	// Signs every copy written, copies aren't signed when nil
+	Signer *provenance.Signer
+
+	// Sends CloudEvents about the outcome of syncs, nil when disabled
+	Notifier *notify.Notifier
+
+	// Records every write to a copy, nil when disabled
+	Audit audit.Writer
+
+	// The SharedConfigMaps with a target namespace pattern, their watches map events through it. Not kept when nil
+	Patterns *utils.PatternIndex
 }
 
 // +kubebuilder:rbac:groups=tattletale.tattletale.dev,resources=sharedconfigmaps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=tattletale.tattletale.dev,resources=sharedconfigmaps/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
 // +kubebuilder:rbac:groups=core,resources=namespaces/status,verbs=get
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 // +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
 
 func (r *SharedConfigMapReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
@@ -48,100 +82,267 @@ func (r *SharedConfigMapReconciler) Reconcile(req ctrl.Request) (ctrl.Result, er
 	log.V(1).Info("reconciling sharedconfigmap object")
 
 	var sharedconfigmap tattletalev1beta1.SharedConfigMap
-	var namespace corev1.Namespace
 	var sourceconfigmap corev1.ConfigMap
 
-	if err := r.Get(ctx, req.NamespacedName, &sharedconfigmap); err != nil {
-		log.Error(err, "unable to get sharedconfigmap")
-		return ctrl.Result{}, err
+	// Shared objects in excluded namespaces are left alone
+	if r.ExcludedNamespaces.Has(req.Namespace) {
+		log.V(1).Info("namespace is excluded. skipping reconcile.")
+		return ctrl.Result{}, nil
 	}
 
-	// Check if source configmap actually exists, if not skip
-	if err := r.Get(ctx, client.ObjectKey{Namespace: sharedconfigmap.Spec.SourceNamespace, Name: sharedconfigmap.Spec.SourceConfigMap}, &sourceconfigmap); err != nil {
-		if !apierrors.IsNotFound(err) {
-			log.Error(err, "unable to get configmap")
-			return ctrl.Result{}, err
-		} else {
-			log.V(1).Info("source configmap does not exist. skipping sync.")
+	if err := r.Get(ctx, req.NamespacedName, &sharedconfigmap); err != nil {
+		if apierrors.IsNotFound(err) {
+			// Deleted, nothing is left to sync
+			r.Patterns.Forget(req.NamespacedName)
 			return ctrl.Result{}, nil
 		}
+		log.Error(err, "unable to get sharedconfigmap")
+		return ctrl.Result{}, err
 	}
+	r.Patterns.Update(req.NamespacedName, &sharedconfigmap)
 
-	// Loop through target namespaces and create/update configmaps
-	for _, v := range sharedconfigmap.Spec.Targets {
-		// Try and get namespace
-		if err := r.Get(ctx, client.ObjectKey{Namespace: "", Name: v.Namespace}, &namespace); err != nil {
-			// Error out
-			// TODO: func ignoreNotFound from kubebuilder book, add to utils
-			if !apierrors.IsNotFound(err) {
-				log.Error(err, "unable to get namespace")
-				return ctrl.Result{}, err
-			} else {
-				// Skip if namespace does not exist
-				log.V(1).Info("namespace does not exist. skipping sync", "namespace", v)
-				continue
-			}
-		}
+	status := tattletalev1beta1.SharedConfigMapStatus{TargetConfigMaps: []string{}, Conditions: sharedconfigmap.Status.Conditions}
+	// Only sources in the cluster can take part in a cycle
+	if sharedconfigmap.Spec.Source != nil {
+		status.Conditions = utils.RemoveCondition(status.Conditions, tattletalev1beta1.ConditionCycle)
+	}
 
-		configmapFound := true
-		var targetconfigmap corev1.ConfigMap
+	var sourceRef string
+	result := ctrl.Result{}
+	if sharedconfigmap.Spec.Source != nil {
+		// Sources outside of the cluster are polled, come back once the interval is over
+		result.RequeueAfter = sources.RefreshInterval(sharedconfigmap.Spec.Source.PollInterval, nil)
 
-		configmapName := ""
-		if v.NewName != "" {
-			configmapName = v.NewName
-		} else {
-			configmapName = sharedconfigmap.Spec.SourceConfigMap
+		// Read the source, if it can't be read skip
+		if sharedconfigmap.Spec.Source.Git == nil {
+			log.V(1).Info("source sets no provider. skipping sync.")
+			r.Recorder.Eventf(&sharedconfigmap, corev1.EventTypeWarning, utils.EventReasonFailed, "source is invalid: source must set a provider")
+			status.SourceConfigMap = SourceInvalid
+			status.Targets = sharedconfigmap.Status.Targets
+			return ctrl.Result{}, r.updateStatus(ctx, &sharedconfigmap, status)
 		}
-		// Test if configmap exists
-		if err := r.Get(ctx, client.ObjectKey{Namespace: v.Namespace, Name: configmapName}, &targetconfigmap); err != nil {
-			if !apierrors.IsNotFound(err) {
-				log.Error(err, "unable to get configmap")
+		description := sources.GitDescription(sharedconfigmap.Spec.Source.Git)
+		if r.Git == nil {
+			log.V(1).Info("git sources are not enabled. skipping sync.", "source", description)
+			r.Recorder.Eventf(&sharedconfigmap, corev1.EventTypeWarning, utils.EventReasonForbidden, "source %s can't be read: git sources are not enabled in the operator", description)
+			status.SourceConfigMap = SourceForbidden
+			status.Targets = sharedconfigmap.Status.Targets
+			return ctrl.Result{}, r.updateStatus(ctx, &sharedconfigmap, status)
+		}
+		data, err := r.Git.Fetch(ctx, sharedconfigmap.Spec.Source.Git)
+		if err != nil {
+			status.Targets = sharedconfigmap.Status.Targets
+			switch {
+			case sources.IsForbidden(err):
+				log.V(1).Info("source is not allowed. skipping sync.", "source", description, "reason", err.Error())
+				r.Recorder.Eventf(&sharedconfigmap, corev1.EventTypeWarning, utils.EventReasonForbidden, "source %s can't be read: %v", description, err)
+				status.SourceConfigMap = SourceForbidden
+				return ctrl.Result{}, r.updateStatus(ctx, &sharedconfigmap, status)
+			case sources.IsInvalid(err):
+				log.V(1).Info("source is invalid. skipping sync.", "source", description, "reason", err.Error())
+				r.Recorder.Eventf(&sharedconfigmap, corev1.EventTypeWarning, utils.EventReasonFailed, "source %s is invalid: %v", description, err)
+				status.SourceConfigMap = SourceInvalid
+				return result, r.updateStatus(ctx, &sharedconfigmap, status)
+			case sources.IsNotFound(err):
+				log.V(1).Info("source does not exist. skipping sync.", "source", description)
+				r.Recorder.Eventf(&sharedconfigmap, corev1.EventTypeWarning, utils.EventReasonSourceMissing, "source %s does not exist", description)
+				status.SourceConfigMap = SourceMissing
+				return result, r.updateStatus(ctx, &sharedconfigmap, status)
+			}
+			log.Error(err, "unable to read source", "source", description)
+			r.Recorder.Eventf(&sharedconfigmap, corev1.EventTypeWarning, utils.EventReasonFailed, "unable to read source %s: %v", description, err)
+			status.SourceConfigMap = SourceUnavailable
+			if err := r.updateStatus(ctx, &sharedconfigmap, status); err != nil {
 				return ctrl.Result{}, err
 			}
-			configmapFound = false
+			return ctrl.Result{}, err
+		}
+		sourceconfigmap.Data, sourceconfigmap.BinaryData = utils.ConfigMapDataFromSecret(data.Values)
+		sourceRef = description
+		status.SourceVersion = data.Version
+	} else {
+		// Check if source configmap can be read at all, if not skip
+		if !utils.NamespaceAllowed(r.AllowedNamespaces, r.ExcludedNamespaces, sharedconfigmap.Spec.SourceNamespace) {
+			log.V(1).Info("source namespace is not allowed. skipping sync.", "namespace", sharedconfigmap.Spec.SourceNamespace)
+			r.Recorder.Eventf(&sharedconfigmap, corev1.EventTypeWarning, utils.EventReasonForbidden, "source namespace %s is outside of the namespaces the operator may read", sharedconfigmap.Spec.SourceNamespace)
+			status.SourceConfigMap = SourceForbidden
+			status.Targets = sharedconfigmap.Status.Targets
+			return ctrl.Result{}, r.updateStatus(ctx, &sharedconfigmap, status)
 		}
 
-		temp := corev1.ConfigMap{}
-		temp.Name = configmapName
-		temp.Namespace = v.Namespace
-		temp.Data = sourceconfigmap.Data
-		temp.BinaryData = sourceconfigmap.BinaryData
-		newTargetConfigMap := temp.DeepCopyObject()
-
-		// Creating configmap
-		if !configmapFound {
+		// Refuse to sync while the source is, through other SharedConfigMaps, a copy of a copy written here
+		cycle, err := utils.NewSharingGraph(r, r.ExcludedNamespaces).FindCycle(ctx, utils.SharedObjectRef{Kind: utils.KindSharedConfigMap, Namespace: sharedconfigmap.Namespace, Name: sharedconfigmap.Name})
+		if err != nil {
+			log.Error(err, "unable to walk the sharing graph")
+			return ctrl.Result{}, err
+		}
+		if cycle != nil {
+			path := utils.CyclePath(cycle)
+			log.V(1).Info("sharedconfigmap takes part in a cycle. skipping sync.", "cycle", path)
+			r.Recorder.Eventf(&sharedconfigmap, corev1.EventTypeWarning, utils.EventReasonCycle, "sharedconfigmap takes part in a cycle and isn't synced: %s", path)
+			status.SourceConfigMap = sharedconfigmap.Status.SourceConfigMap
+			status.Targets = sharedconfigmap.Status.Targets
+			status.Conditions = utils.SetCondition(status.Conditions, tattletalev1beta1.Condition{
+				Type:    tattletalev1beta1.ConditionCycle,
+				Status:  corev1.ConditionTrue,
+				Reason:  utils.EventReasonCycle,
+				Message: path,
+			}, metav1.Now())
+			return ctrl.Result{}, r.updateStatus(ctx, &sharedconfigmap, status)
+		}
+		status.Conditions = utils.RemoveCondition(status.Conditions, tattletalev1beta1.ConditionCycle)
 
-			if err := r.Create(ctx, newTargetConfigMap); err != nil {
-				log.Error(err, "unable to create configmap in target namespace")
+		// Check if source configmap actually exists, if not skip
+		if err := r.Get(ctx, client.ObjectKey{Namespace: sharedconfigmap.Spec.SourceNamespace, Name: sharedconfigmap.Spec.SourceConfigMap}, &sourceconfigmap); err != nil {
+			if !apierrors.IsNotFound(err) {
+				log.Error(err, "unable to get configmap")
 				return ctrl.Result{}, err
 			} else {
-				log.V(1).Info("Succesfully created configmap", "namespace", v)
+				log.V(1).Info("source configmap does not exist. skipping sync.")
+				r.Recorder.Eventf(&sharedconfigmap, corev1.EventTypeWarning, utils.EventReasonSourceMissing, "source configmap %s/%s does not exist", sharedconfigmap.Spec.SourceNamespace, sharedconfigmap.Spec.SourceConfigMap)
+				status.SourceConfigMap = SourceMissing
+				status.Targets = sharedconfigmap.Status.Targets
+				return ctrl.Result{}, r.updateStatus(ctx, &sharedconfigmap, status)
 			}
+		}
+		sourceRef = "configmap:" + sharedconfigmap.Spec.SourceNamespace + "/" + sharedconfigmap.Spec.SourceConfigMap
+	}
+	status.SourceConfigMap = SourceFound
+	sourceHash := utils.HashConfigMapData(sourceconfigmap.Data, sourceconfigmap.BinaryData)
+	var auditSource metav1.Object
+	if sharedconfigmap.Spec.Source == nil {
+		auditSource = &sourceconfigmap
+	}
+	trail := newAuditTrail(r.Audit, log, "SharedConfigMap", &sharedconfigmap, sourceRef, auditSource, status.SourceVersion, sourceHash, "data", "binaryData")
+	notifications := newSyncNotifications(r.Notifier, r.Recorder, &sharedconfigmap, &sharedconfigmap, "SharedConfigMap", "sharedconfigmaps",
+		sharedconfigmap.Spec.Notifications, sourceHash, status.SourceVersion)
 
-		} else {
-			// Updating configmap.
-			// ### TODO update only if hashes have changed, downstream repercussions of redundantly updating
-			// ### TODO: Think of updating status, here and in other places
+	targets, err := r.expandTargets(ctx, &sharedconfigmap, &status)
+	if err != nil {
+		log.Error(err, "unable to list target namespaces")
+		r.Recorder.Eventf(&sharedconfigmap, corev1.EventTypeWarning, utils.EventReasonFailed, "unable to list target namespaces: %v", err)
+		return ctrl.Result{}, err
+	}
 
-			if err := r.Update(ctx, newTargetConfigMap); err != nil {
-				log.Error(err, "unable to update configmap in target namespace")
-				return ctrl.Result{}, err
-			} else {
-				log.V(1).Info("Succesfully updated configmap", "namespace", v)
-			}
+	// Copies other shared objects take precedence over are left to them
+	copies := targetCopies{
+		Client:              r.Client,
+		log:                 log,
+		recorder:            r.Recorder,
+		allowedNamespaces:   r.AllowedNamespaces,
+		excludedNamespaces:  r.ExcludedNamespaces,
+		protectedNamespaces: r.ProtectedNamespaces,
+		signer:              r.Signer,
+		object:              &sharedconfigmap,
+		meta:                &sharedconfigmap,
+		kind:                "SharedConfigMap",
+		previous:            sharedconfigmap.Status.Targets,
+		immutable:           sharedconfigmap.Spec.Immutable,
+		sourceKind:          tattletalev1beta1.TargetKindConfigMap,
+		values:              utils.SecretDataFromConfigMap(sourceconfigmap.Data, sourceconfigmap.BinaryData),
+		data:                sourceconfigmap.Data,
+		binaryData:          sourceconfigmap.BinaryData,
+		sourceRef:           sourceRef,
+		sourceVersion:       status.SourceVersion,
+		trail:               trail,
+		notifications:       notifications,
+	}
+	configmaps := copies.ofKind(tattletalev1beta1.TargetKindConfigMap, utils.NewConfigMapWriters(r, r.ExcludedNamespaces))
+	secrets := copies.ofKind(tattletalev1beta1.TargetKindSecret, utils.NewSecretWriters(r, r.ExcludedNamespaces))
 
+	// Loop through target namespaces and create/update configmaps
+	for _, v := range targets {
+		target := copyTarget{
+			namespace:   v.Namespace,
+			name:        sharedconfigmap.TargetName(v),
+			driftPolicy: utils.EffectiveDriftPolicy(sharedconfigmap.Spec.DriftPolicy, v.DriftPolicy),
+		}
+		copies := configmaps
+		if sharedconfigmap.TargetKind(v) == tattletalev1beta1.TargetKindSecret {
+			copies = secrets
 		}
+		targetStatus, err := copies.sync(ctx, target)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		status.Targets = append(status.Targets, targetStatus)
+	}
+	status.TargetConfigMaps = append(status.TargetConfigMaps, configmaps.synced...)
+	notifications.finished(status.Targets)
+	status.Conditions = setConflictCondition(status.Conditions, append(configmaps.conflicts, secrets.conflicts...))
 
+	// Come back to delete generations once they reach their max age
+	if sharedconfigmap.Spec.Immutable != nil && sharedconfigmap.Spec.Immutable.MaxAge != nil {
+		if maxAge := sharedconfigmap.Spec.Immutable.MaxAge.Duration; result.RequeueAfter == 0 || maxAge < result.RequeueAfter {
+			result.RequeueAfter = maxAge
+		}
 	}
 
 	// TODO: should we tolerate 'partial' errors
 	// TODO: dealing with deletion of CRD, what to do with other objects, should be configurable
-	return ctrl.Result{}, nil
+	return result, r.updateStatus(ctx, &sharedconfigmap, status)
+}
+
+// expandTargets replaces every target whose namespace is a pattern with a target per matching namespace.
+// Explicit targets win over pattern matches writing the same copy and patterns never match the source.
+// Invalid patterns are reported in status.
+func (r *SharedConfigMapReconciler) expandTargets(ctx context.Context, sharedconfigmap *tattletalev1beta1.SharedConfigMap, status *tattletalev1beta1.SharedConfigMapStatus) ([]tattletalev1beta1.TargetConfigMap, error) {
+	targets := []tattletalev1beta1.TargetConfigMap{}
+	seen := map[string]bool{}
+	for _, t := range sharedconfigmap.Spec.Targets {
+		if !utils.IsNamespacePattern(t.Namespace) {
+			targets = append(targets, t)
+			seen[targetKey(sharedconfigmap.TargetKind(t), t.Namespace, sharedconfigmap.TargetName(t))] = true
+		}
+	}
+	if sharedconfigmap.Spec.Source == nil {
+		seen[targetKey(tattletalev1beta1.TargetKindConfigMap, sharedconfigmap.Spec.SourceNamespace, sharedconfigmap.Spec.SourceConfigMap)] = true
+	}
 
+	namespaces := &targetNamespaces{reader: r, allowedNamespaces: r.AllowedNamespaces, excludedNamespaces: r.ExcludedNamespaces}
+	for _, t := range sharedconfigmap.Spec.Targets {
+		if !utils.IsNamespacePattern(t.Namespace) {
+			continue
+		}
+		name := sharedconfigmap.TargetName(t)
+		if _, err := utils.NewNamespaceMatcher(t.Namespace); err != nil {
+			r.Recorder.Eventf(sharedconfigmap, corev1.EventTypeWarning, utils.EventReasonInvalid, "target namespace %s is invalid: %v", t.Namespace, err)
+			status.Targets = append(status.Targets, invalidPatternStatus(sharedconfigmap.Status.Targets, t.Namespace, name, err))
+			continue
+		}
+		matched, err := namespaces.match(ctx, t.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range matched {
+			if key := targetKey(sharedconfigmap.TargetKind(t), ns, name); !seen[key] {
+				seen[key] = true
+				target := t
+				target.Namespace = ns
+				targets = append(targets, target)
+			}
+		}
+	}
+	return targets, nil
+}
+
+// updateStatus writes the status of the sharedconfigmap, skipping the write when nothing changed
+func (r *SharedConfigMapReconciler) updateStatus(ctx context.Context, sharedconfigmap *tattletalev1beta1.SharedConfigMap, status tattletalev1beta1.SharedConfigMapStatus) error {
+	if equality.Semantic.DeepEqual(sharedconfigmap.Status, status) {
+		return nil
+	}
+	sharedconfigmap.Status = status
+	if err := r.Status().Update(ctx, sharedconfigmap); err != nil {
+		r.Log.Error(err, "unable to update sharedconfigmap status", "sharedconfigmap", sharedconfigmap.Namespace+"/"+sharedconfigmap.Name)
+		return err
+	}
+	return nil
 }
 
-func (r *SharedConfigMapReconciler) SetupWithManager(mgr ctrl.Manager) (controller.Controller, error) {
+func (r *SharedConfigMapReconciler) SetupWithManager(mgr ctrl.Manager, options Options) (controller.Controller, error) {
+	controllerOptions := options.controllerOptions(r, r.Log)
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&tattletalev1beta1.SharedConfigMap{}).
-		Build(r)
+		WithOptions(controllerOptions).
+		Build(controllerOptions.Reconciler)
 }
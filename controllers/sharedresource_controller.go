@@ -0,0 +1,513 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+	"tattletale/audit"
+	"tattletale/utils"
+)
+
+// SharedResourceReconciler reconciles a SharedResource object
+type SharedResourceReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// Reads shared resources from the watch cache, the client reads unstructured objects from the API server
+	Cache      client.Reader
+	RESTMapper meta.RESTMapper
+	// Starts watching kinds as SharedResources refer to them
+	Watcher *utils.DynamicWatcher
+
+	// Kinds that may be shared as "Kind.group", nothing may be shared when empty
+	AllowedKinds sets.String
+
+	// Namespaces the operator may read and write in, empty when installed cluster wide
+	AllowedNamespaces sets.String
+	// Namespaces the operator ignores
+	ExcludedNamespaces sets.String
+	// Namespaces copies are never written to
+	ProtectedNamespaces sets.String
+
+	// Records every write to a copy, nil when disabled
+	Audit audit.Writer
+
+	// Resources the operator was found to have RBAC for, denials are checked again on every reconcile
+	accessible map[schema.GroupResource]bool
+	mu         sync.Mutex
+}
+
+// The verbs the operator needs on every kind it shares, watching a kind without them never syncs its cache
+var sharedResourceVerbs = []string{"get", "list", "watch", "create", "update"}
+
+// Kinds SharedResources may not share, as other shared objects write their copies
+var sharedByOtherKinds = sets.NewString("Secret", "ConfigMap")
+
+// +kubebuilder:rbac:groups=tattletale.tattletale.dev,resources=sharedresources,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=tattletale.tattletale.dev,resources=sharedresources/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=selfsubjectaccessreviews,verbs=create
+
+// RBAC for the kinds of the default sharedResourceKinds of config/manager/operator_config.yaml, extend it with
+// every kind added there. Sharing Roles needs escalate and bind on top, as they may grant anything.
+// +kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=limitranges,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles,verbs=get;list;watch;create;update;patch;delete;escalate;bind
+
+func (r *SharedResourceReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	log := r.Log.WithValues("sharedresource", req.NamespacedName)
+	log.V(1).Info("reconciling sharedresource object")
+
+	var sharedresource tattletalev1beta1.SharedResource
+	var namespace corev1.Namespace
+
+	// Shared objects in excluded namespaces are left alone
+	if r.ExcludedNamespaces.Has(req.Namespace) {
+		log.V(1).Info("namespace is excluded. skipping reconcile.")
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.Get(ctx, req.NamespacedName, &sharedresource); err != nil {
+		log.Error(err, "unable to get sharedresource")
+		return ctrl.Result{}, err
+	}
+
+	status := tattletalev1beta1.SharedResourceStatus{Conditions: sharedresource.Status.Conditions}
+	gvk := schema.FromAPIVersionAndKind(sharedresource.Spec.APIVersion, sharedresource.Spec.Kind)
+	kind := gvk.GroupKind().String()
+
+	// Check the kind may be shared at all, if not skip
+	if !r.AllowedKinds.Has(kind) {
+		log.V(1).Info("kind is not allowed. skipping sync.", "kind", kind)
+		r.Recorder.Eventf(&sharedresource, corev1.EventTypeWarning, utils.EventReasonForbidden, "kind %s is not in the kinds the operator may share", kind)
+		status.Source = SourceForbidden
+		status.Message = fmt.Sprintf("kind %s is not in the kinds the operator may share", kind)
+		status.Targets = sharedresource.Status.Targets
+		status.Conditions = setKindAllowedCondition(status.Conditions, false, status.Message)
+		return ctrl.Result{}, r.updateStatus(ctx, &sharedresource, status)
+	}
+
+	// Secrets and ConfigMaps are left to SharedSecrets and SharedConfigMaps, which resolve copies written by both
+	if sharedByOtherKinds.Has(kind) {
+		log.V(1).Info("kind is shared by other shared objects. skipping sync.", "kind", kind)
+		r.Recorder.Eventf(&sharedresource, corev1.EventTypeWarning, utils.EventReasonForbidden, "%ss are shared with Shared%ss", kind, kind)
+		status.Source = SourceForbidden
+		status.Message = fmt.Sprintf("%ss are shared with Shared%ss", kind, kind)
+		status.Targets = sharedresource.Status.Targets
+		status.Conditions = setKindAllowedCondition(status.Conditions, false, status.Message)
+		return ctrl.Result{}, r.updateStatus(ctx, &sharedresource, status)
+	}
+
+	// Check the kind exists and is namespaced, if not skip
+	mapping, err := r.RESTMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil && !meta.IsNoMatchError(err) {
+		log.Error(err, "unable to map kind", "kind", gvk.String())
+		return ctrl.Result{}, err
+	}
+	if err != nil || mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		log.V(1).Info("kind is unknown or cluster scoped. skipping sync.", "kind", gvk.String())
+		r.Recorder.Eventf(&sharedresource, corev1.EventTypeWarning, utils.EventReasonFailed, "%s is not a namespaced kind served by the cluster", gvk.String())
+		status.Source = SourceInvalid
+		status.Message = fmt.Sprintf("%s is not a namespaced kind served by the cluster", gvk.String())
+		status.Targets = sharedresource.Status.Targets
+		return ctrl.Result{}, r.updateStatus(ctx, &sharedresource, status)
+	}
+
+	// Check the operator has RBAC for the kind before watching it, an informer without it never syncs
+	denied, err := r.deniedVerbs(ctx, mapping.Resource, sharedresource.Spec.SourceNamespace)
+	if err != nil {
+		log.Error(err, "unable to review access to kind", "kind", gvk.String())
+		return ctrl.Result{}, err
+	}
+	if len(denied) > 0 {
+		log.V(1).Info("kind is forbidden by RBAC. skipping sync.", "kind", kind, "verbs", denied)
+		r.Recorder.Eventf(&sharedresource, corev1.EventTypeWarning, utils.EventReasonForbidden, "the operator's role doesn't allow %s on %s", strings.Join(denied, ", "), mapping.Resource.GroupResource())
+		status.Source = SourceForbidden
+		status.Message = fmt.Sprintf("the operator's role doesn't allow %s on %s", strings.Join(denied, ", "), mapping.Resource.GroupResource())
+		status.Targets = sharedresource.Status.Targets
+		status.Conditions = setKindAllowedCondition(status.Conditions, false, status.Message)
+		return ctrl.Result{}, r.updateStatus(ctx, &sharedresource, status)
+	}
+	status.Conditions = setKindAllowedCondition(status.Conditions, true, "")
+
+	if err := r.Watcher.Watch(gvk); err != nil {
+		log.Error(err, "unable to watch kind", "kind", gvk.String())
+		return ctrl.Result{}, err
+	}
+
+	// Check if source resource can be read at all, if not skip
+	if !utils.NamespaceAllowed(r.AllowedNamespaces, r.ExcludedNamespaces, sharedresource.Spec.SourceNamespace) {
+		log.V(1).Info("source namespace is not allowed. skipping sync.", "namespace", sharedresource.Spec.SourceNamespace)
+		r.Recorder.Eventf(&sharedresource, corev1.EventTypeWarning, utils.EventReasonForbidden, "source namespace %s is outside of the namespaces the operator may read", sharedresource.Spec.SourceNamespace)
+		status.Source = SourceForbidden
+		status.Targets = sharedresource.Status.Targets
+		return ctrl.Result{}, r.updateStatus(ctx, &sharedresource, status)
+	}
+
+	// Refuse to sync while the source is, through other SharedResources, a copy of a copy written here
+	cycle, err := utils.NewSharingGraph(r.Cache, r.ExcludedNamespaces).FindCycle(ctx, utils.SharedObjectRef{Kind: utils.KindSharedResource, Namespace: sharedresource.Namespace, Name: sharedresource.Name})
+	if err != nil {
+		log.Error(err, "unable to walk the sharing graph")
+		return ctrl.Result{}, err
+	}
+	if cycle != nil {
+		path := utils.CyclePath(cycle)
+		log.V(1).Info("sharedresource takes part in a cycle. skipping sync.", "cycle", path)
+		r.Recorder.Eventf(&sharedresource, corev1.EventTypeWarning, utils.EventReasonCycle, "sharedresource takes part in a cycle and isn't synced: %s", path)
+		status.Source = sharedresource.Status.Source
+		status.Message = sharedresource.Status.Message
+		status.Targets = sharedresource.Status.Targets
+		status.Conditions = utils.SetCondition(status.Conditions, tattletalev1beta1.Condition{
+			Type:    tattletalev1beta1.ConditionCycle,
+			Status:  corev1.ConditionTrue,
+			Reason:  utils.EventReasonCycle,
+			Message: path,
+		}, metav1.Now())
+		return ctrl.Result{}, r.updateStatus(ctx, &sharedresource, status)
+	}
+	status.Conditions = utils.RemoveCondition(status.Conditions, tattletalev1beta1.ConditionCycle)
+
+	// Check if source resource actually exists, if not skip
+	source := &unstructured.Unstructured{}
+	source.SetGroupVersionKind(gvk)
+	if err := r.Cache.Get(ctx, client.ObjectKey{Namespace: sharedresource.Spec.SourceNamespace, Name: sharedresource.Spec.SourceName}, source); err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.Error(err, "unable to get resource")
+			return ctrl.Result{}, err
+		} else {
+			log.V(1).Info("source resource does not exist. skipping sync.")
+			r.Recorder.Eventf(&sharedresource, corev1.EventTypeWarning, utils.EventReasonSourceMissing, "source %s %s/%s does not exist", kind, sharedresource.Spec.SourceNamespace, sharedresource.Spec.SourceName)
+			status.Source = SourceMissing
+			status.Targets = sharedresource.Status.Targets
+			return ctrl.Result{}, r.updateStatus(ctx, &sharedresource, status)
+		}
+	}
+	sourceHash, err := utils.HashResource(source)
+	if err != nil {
+		log.V(1).Info("source resource can't be hashed. skipping sync.", "reason", err.Error())
+		r.Recorder.Eventf(&sharedresource, corev1.EventTypeWarning, utils.EventReasonFailed, "unable to hash source %s %s/%s: %v", kind, sharedresource.Spec.SourceNamespace, sharedresource.Spec.SourceName, err)
+		status.Source = SourceInvalid
+		status.Message = fmt.Sprintf("source can't be hashed: %v", err)
+		status.Targets = sharedresource.Status.Targets
+		status.Conditions = setHashFailedCondition(status.Conditions, status.Message)
+		return ctrl.Result{}, r.updateStatus(ctx, &sharedresource, status)
+	}
+	status.Source = SourceFound
+	status.Conditions = utils.RemoveCondition(status.Conditions, tattletalev1beta1.ConditionHashFailed)
+	sourceRef := strings.ToLower(kind) + ":" + sharedresource.Spec.SourceNamespace + "/" + sharedresource.Spec.SourceName
+	trail := newAuditTrail(r.Audit, log, "SharedResource", &sharedresource, sourceRef, source, "", sourceHash)
+	writers := utils.NewSharedResourceWriters(r.Cache, kind, r.ExcludedNamespaces)
+	conflicts := []string{}
+
+	// Loop through target namespaces and create/update resources
+	for _, v := range sharedresource.Spec.Targets {
+		resourceName := ""
+		if v.NewName != "" {
+			resourceName = v.NewName
+		} else {
+			resourceName = sharedresource.Spec.SourceName
+		}
+
+		// Skip namespace patterns, copies of SharedResources are only resolved against explicit targets
+		if utils.IsNamespacePattern(v.Namespace) {
+			log.V(1).Info("namespace is a pattern. skipping sync", "namespace", v)
+			r.Recorder.Eventf(&sharedresource, corev1.EventTypeWarning, utils.EventReasonFailed, "target namespace %s is a pattern, SharedResources only support namespace names", v.Namespace)
+			targetStatus := utils.NewTargetStatus(sharedresource.Status.Targets, v.Namespace, resourceName, tattletalev1beta1.TargetStateInvalid, "", false)
+			targetStatus.Message = PatternUnsupportedMessage
+			status.Targets = append(status.Targets, targetStatus)
+			continue
+		}
+
+		// Skip namespaces the operator may not write to
+		if !utils.NamespaceAllowed(r.AllowedNamespaces, r.ExcludedNamespaces, v.Namespace) {
+			log.V(1).Info("namespace is not allowed. skipping sync", "namespace", v)
+			r.Recorder.Eventf(&sharedresource, corev1.EventTypeWarning, utils.EventReasonForbidden, "target namespace %s is outside of the namespaces the operator may write to", v.Namespace)
+			targetStatus := utils.NewTargetStatus(sharedresource.Status.Targets, v.Namespace, resourceName, tattletalev1beta1.TargetStateForbidden, "", false)
+			targetStatus.Message = ForbiddenMessage
+			status.Targets = append(status.Targets, targetStatus)
+			continue
+		}
+
+		// Skip protected namespaces, even when they are targeted explicitly
+		if r.ProtectedNamespaces.Has(v.Namespace) {
+			log.V(1).Info("namespace is protected. skipping sync", "namespace", v)
+			r.Recorder.Eventf(&sharedresource, corev1.EventTypeWarning, utils.EventReasonForbidden, "target namespace %s is protected", v.Namespace)
+			targetStatus := utils.NewTargetStatus(sharedresource.Status.Targets, v.Namespace, resourceName, tattletalev1beta1.TargetStateForbidden, "", false)
+			targetStatus.Message = ProtectedMessage
+			status.Targets = append(status.Targets, targetStatus)
+			continue
+		}
+
+		// Skip copies written by another SharedResource taking precedence
+		winner, err := writers.Winner(ctx, &sharedresource, v.Namespace, resourceName)
+		if err != nil {
+			log.Error(err, "unable to list sharedresources writing the resource")
+			r.Recorder.Eventf(&sharedresource, corev1.EventTypeWarning, utils.EventReasonFailed, "unable to list sharedresources writing %s %s/%s: %v", kind, v.Namespace, resourceName, err)
+			return ctrl.Result{}, err
+		}
+		if winner != nil {
+			w := utils.RefOf(winner)
+			log.V(1).Info("resource is written by another sharedresource. skipping sync", "namespace", v, "writer", w.String())
+			r.Recorder.Eventf(&sharedresource, corev1.EventTypeWarning, utils.EventReasonTargetConflict, "%s %s/%s is written by sharedresource %s/%s, which takes precedence", kind, v.Namespace, resourceName, w.Namespace, w.Name)
+			targetStatus := utils.NewTargetStatus(sharedresource.Status.Targets, v.Namespace, resourceName, tattletalev1beta1.TargetStateConflict, "", false)
+			targetStatus.Message = conflictMessage(w.Kind, w.Namespace, w.Name)
+			status.Targets = append(status.Targets, targetStatus)
+			conflicts = append(conflicts, fmt.Sprintf("%s %s/%s by %s", strings.ToLower(kind), v.Namespace, resourceName, w.String()))
+			continue
+		}
+
+		// Try and get namespace
+		if err := getNamespace(ctx, r, r.AllowedNamespaces, v.Namespace, &namespace); err != nil {
+			if !apierrors.IsNotFound(err) {
+				log.Error(err, "unable to get namespace")
+				r.Recorder.Eventf(&sharedresource, corev1.EventTypeWarning, utils.EventReasonFailed, "unable to get target namespace %s: %v", v.Namespace, err)
+				return ctrl.Result{}, err
+			} else {
+				// Skip if namespace does not exist
+				log.V(1).Info("namespace does not exist. skipping sync", "namespace", v)
+				r.Recorder.Eventf(&sharedresource, corev1.EventTypeWarning, utils.EventReasonNamespaceMissing, "target namespace %s does not exist", v.Namespace)
+				status.Targets = append(status.Targets, utils.NewTargetStatus(sharedresource.Status.Targets, v.Namespace, resourceName, tattletalev1beta1.TargetStateNamespaceMissing, "", false))
+				continue
+			}
+		}
+
+		// Test if resource exists
+		var existing *unstructured.Unstructured
+		target := &unstructured.Unstructured{}
+		target.SetGroupVersionKind(gvk)
+		if err := r.Cache.Get(ctx, client.ObjectKey{Namespace: v.Namespace, Name: resourceName}, target); err != nil {
+			if !apierrors.IsNotFound(err) {
+				log.Error(err, "unable to get resource")
+				r.Recorder.Eventf(&sharedresource, corev1.EventTypeWarning, utils.EventReasonFailed, "unable to get %s %s/%s: %v", kind, v.Namespace, resourceName, err)
+				return ctrl.Result{}, err
+			}
+		} else {
+			existing = target
+		}
+
+		recordedHash, currentHash := "", ""
+		if existing != nil {
+			recordedHash = existing.GetAnnotations()[tattletalev1beta1.SourceHashAnnotation]
+			if currentHash, err = utils.HashResource(existing); err != nil {
+				log.V(1).Info("resource can't be hashed. skipping sync", "namespace", v, "reason", err.Error())
+				r.Recorder.Eventf(&sharedresource, corev1.EventTypeWarning, utils.EventReasonFailed, "unable to hash %s %s/%s: %v", kind, v.Namespace, resourceName, err)
+				targetStatus := utils.NewTargetStatus(sharedresource.Status.Targets, v.Namespace, resourceName, tattletalev1beta1.TargetStateInvalid, recordedHash, false)
+				targetStatus.Message = fmt.Sprintf("copy can't be hashed: %v", err)
+				status.Targets = append(status.Targets, targetStatus)
+				status.Conditions = setHashFailedCondition(status.Conditions, fmt.Sprintf("%s/%s %s", v.Namespace, resourceName, targetStatus.Message))
+				continue
+			}
+		}
+		policy := utils.EffectiveDriftPolicy(sharedresource.Spec.DriftPolicy, v.DriftPolicy)
+		decision := utils.DecideSync(policy, existing != nil, sourceHash, recordedHash, currentHash)
+
+		if !decision.Write {
+			targetStatus := utils.NewTargetStatus(sharedresource.Status.Targets, v.Namespace, resourceName, tattletalev1beta1.TargetStateSynced, recordedHash, false)
+			if decision.Drifted {
+				log.V(1).Info("resource drifted from source. skipping sync", "namespace", v, "driftPolicy", policy)
+				targetStatus.State = tattletalev1beta1.TargetStateDrifted
+				targetStatus.Message = DriftedMessage
+				r.Recorder.Eventf(&sharedresource, corev1.EventTypeWarning, utils.EventReasonSkipped, "%s %s/%s drifted from source and was left as is (driftPolicy %s)", kind, v.Namespace, resourceName, policy)
+			}
+			status.Targets = append(status.Targets, targetStatus)
+			continue
+		}
+
+		targetresource := utils.BuildResourceCopy(source, existing, v.Namespace, resourceName)
+		annotations := targetresource.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[tattletalev1beta1.SourceHashAnnotation] = sourceHash
+		targetresource.SetAnnotations(annotations)
+
+		// Creating resource
+		if existing == nil {
+
+			if err := r.Create(ctx, targetresource); err != nil {
+				if apierrors.IsNotFound(err) {
+					// Only reachable when namespaces can't be read up front
+					log.V(1).Info("namespace does not exist. skipping sync", "namespace", v)
+					r.Recorder.Eventf(&sharedresource, corev1.EventTypeWarning, utils.EventReasonNamespaceMissing, "target namespace %s does not exist", v.Namespace)
+					status.Targets = append(status.Targets, utils.NewTargetStatus(sharedresource.Status.Targets, v.Namespace, resourceName, tattletalev1beta1.TargetStateNamespaceMissing, "", false))
+					continue
+				}
+				if apierrors.IsForbidden(err) {
+					status.Targets = append(status.Targets, r.forbiddenTarget(&sharedresource, mapping.Resource, err, kind, v.Namespace, resourceName))
+					continue
+				}
+				log.Error(err, "unable to create resource in target namespace")
+				r.recordWriteFailure(&sharedresource, err, kind, v.Namespace, resourceName)
+				return ctrl.Result{}, err
+			} else {
+				log.V(1).Info("Succesfully created resource", "namespace", v)
+				trail.write(audit.ActionCreate, kind, v.Namespace, resourceName)
+				r.Recorder.Eventf(&sharedresource, corev1.EventTypeNormal, utils.EventReasonCreated, "created %s %s/%s", kind, v.Namespace, resourceName)
+			}
+
+		} else {
+			// Updating resource.
+			if decision.Drifted {
+				log.V(1).Info("resource drifted from source. overwriting", "namespace", v, "driftPolicy", policy)
+			}
+
+			if err := r.Update(ctx, targetresource); err != nil {
+				if apierrors.IsForbidden(err) {
+					status.Targets = append(status.Targets, r.forbiddenTarget(&sharedresource, mapping.Resource, err, kind, v.Namespace, resourceName))
+					continue
+				}
+				log.Error(err, "unable to update resource in target namespace")
+				r.recordWriteFailure(&sharedresource, err, kind, v.Namespace, resourceName)
+				return ctrl.Result{}, err
+			} else {
+				log.V(1).Info("Succesfully updated resource", "namespace", v)
+				trail.write(audit.ActionUpdate, kind, v.Namespace, resourceName)
+				r.Recorder.Eventf(&sharedresource, corev1.EventTypeNormal, utils.EventReasonUpdated, "updated %s %s/%s", kind, v.Namespace, resourceName)
+			}
+
+		}
+
+		status.Targets = append(status.Targets, utils.NewTargetStatus(sharedresource.Status.Targets, v.Namespace, resourceName, tattletalev1beta1.TargetStateSynced, sourceHash, true))
+	}
+	status.Conditions = setConflictCondition(status.Conditions, conflicts)
+
+	return ctrl.Result{}, r.updateStatus(ctx, &sharedresource, status)
+}
+
+// deniedVerbs returns the verbs of sharedResourceVerbs the operator's role doesn't allow on a resource, cluster
+// wide or in the namespace when the operator is restricted to a set of namespaces
+func (r *SharedResourceReconciler) deniedVerbs(ctx context.Context, resource schema.GroupVersionResource, namespace string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.accessible[resource.GroupResource()] {
+		return nil, nil
+	}
+	if r.AllowedNamespaces.Len() == 0 {
+		namespace = ""
+	}
+
+	denied := []string{}
+	for _, verb := range sharedResourceVerbs {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace: namespace,
+					Verb:      verb,
+					Group:     resource.Group,
+					Resource:  resource.Resource,
+				},
+			},
+		}
+		if err := r.Create(ctx, review); err != nil {
+			return nil, err
+		}
+		if !review.Status.Allowed {
+			denied = append(denied, verb)
+		}
+	}
+	if len(denied) == 0 {
+		if r.accessible == nil {
+			r.accessible = map[schema.GroupResource]bool{}
+		}
+		r.accessible[resource.GroupResource()] = true
+	}
+	return denied, nil
+}
+
+// forbiddenTarget reports a copy the operator's role doesn't allow to write, e.g. a Role granting more than the
+// operator holds, rather than retrying it forever. The access to the kind is reviewed again on the next reconcile.
+func (r *SharedResourceReconciler) forbiddenTarget(sharedresource *tattletalev1beta1.SharedResource, resource schema.GroupVersionResource, err error, kind, namespace, name string) tattletalev1beta1.TargetStatus {
+	r.mu.Lock()
+	delete(r.accessible, resource.GroupResource())
+	r.mu.Unlock()
+	r.Log.V(1).Info("writing resource is forbidden. skipping sync", "namespace", namespace, "kind", kind, "reason", err.Error())
+	r.Recorder.Eventf(sharedresource, corev1.EventTypeWarning, utils.EventReasonForbidden, "writing %s %s/%s is forbidden: %v", kind, namespace, name, err)
+	targetStatus := utils.NewTargetStatus(sharedresource.Status.Targets, namespace, name, tattletalev1beta1.TargetStateForbidden, "", false)
+	targetStatus.Message = err.Error()
+	return targetStatus
+}
+
+// setKindAllowedCondition records whether the kind of a sharedresource may be shared
+func setKindAllowedCondition(conditions []tattletalev1beta1.Condition, allowed bool, message string) []tattletalev1beta1.Condition {
+	condition := tattletalev1beta1.Condition{Type: tattletalev1beta1.ConditionKindAllowed, Status: corev1.ConditionTrue, Reason: "Allowed"}
+	if !allowed {
+		condition = tattletalev1beta1.Condition{Type: tattletalev1beta1.ConditionKindAllowed, Status: corev1.ConditionFalse, Reason: utils.EventReasonForbidden, Message: message}
+	}
+	return utils.SetCondition(conditions, condition, metav1.Now())
+}
+
+// setHashFailedCondition records content of a sharedresource that can't be hashed, and isn't synced
+func setHashFailedCondition(conditions []tattletalev1beta1.Condition, message string) []tattletalev1beta1.Condition {
+	condition := tattletalev1beta1.Condition{Type: tattletalev1beta1.ConditionHashFailed, Status: corev1.ConditionTrue, Reason: utils.EventReasonFailed, Message: message}
+	return utils.SetCondition(conditions, condition, metav1.Now())
+}
+
+// recordWriteFailure emits a Conflicted event when someone else wrote the resource first and a Failed event otherwise
+func (r *SharedResourceReconciler) recordWriteFailure(sharedresource *tattletalev1beta1.SharedResource, err error, kind, namespace, name string) {
+	if apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) {
+		r.Recorder.Eventf(sharedresource, corev1.EventTypeWarning, utils.EventReasonConflicted, "%s %s/%s was modified concurrently: %v", kind, namespace, name, err)
+		return
+	}
+	r.Recorder.Eventf(sharedresource, corev1.EventTypeWarning, utils.EventReasonFailed, "unable to write %s %s/%s: %v", kind, namespace, name, err)
+}
+
+// updateStatus writes the status of the sharedresource, skipping the write when nothing changed
+func (r *SharedResourceReconciler) updateStatus(ctx context.Context, sharedresource *tattletalev1beta1.SharedResource, status tattletalev1beta1.SharedResourceStatus) error {
+	if equality.Semantic.DeepEqual(sharedresource.Status, status) {
+		return nil
+	}
+	sharedresource.Status = status
+	if err := r.Status().Update(ctx, sharedresource); err != nil {
+		r.Log.Error(err, "unable to update sharedresource status", "sharedresource", sharedresource.Namespace+"/"+sharedresource.Name)
+		return err
+	}
+	return nil
+}
+
+func (r *SharedResourceReconciler) SetupWithManager(mgr ctrl.Manager, options Options) (controller.Controller, error) {
+	controllerOptions := options.controllerOptions(r, r.Log)
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&tattletalev1beta1.SharedResource{}).
+		WithOptions(controllerOptions).
+		Build(controllerOptions.Reconciler)
+}
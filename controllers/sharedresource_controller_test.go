@@ -0,0 +1,147 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+	"tattletale/utils"
+)
+
+// reviewingClient answers SelfSubjectAccessReviews, allowing the given verbs only
+type reviewingClient struct {
+	client.Client
+	allowed sets.String
+}
+
+func (c *reviewingClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	if review, ok := obj.(*authorizationv1.SelfSubjectAccessReview); ok {
+		review.Status.Allowed = c.allowed.Has(review.Spec.ResourceAttributes.Verb)
+		return nil
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestSharedResourceKindNotAllowed(t *testing.T) {
+	tests := []struct {
+		name         string
+		apiVersion   string
+		kind         string
+		allowedKinds sets.String
+		allowedVerbs sets.String
+		message      string
+	}{
+		{
+			name:         "kind missing from the allow list",
+			apiVersion:   "networking.k8s.io/v1",
+			kind:         "NetworkPolicy",
+			allowedKinds: sets.NewString(),
+			allowedVerbs: sets.NewString(sharedResourceVerbs...),
+			message:      "kind NetworkPolicy.networking.k8s.io is not in the kinds the operator may share",
+		},
+		{
+			name:         "kind forbidden by RBAC",
+			apiVersion:   "networking.k8s.io/v1",
+			kind:         "NetworkPolicy",
+			allowedKinds: sets.NewString("NetworkPolicy.networking.k8s.io"),
+			allowedVerbs: sets.NewString("get", "create", "update"),
+			message:      "the operator's role doesn't allow list, watch on networkpolicies.networking.k8s.io",
+		},
+		{
+			// Copies of secrets are left to SharedSecrets, even when the kind is allowed
+			name:         "kind shared by SharedSecrets",
+			apiVersion:   "v1",
+			kind:         "Secret",
+			allowedKinds: sets.NewString("Secret"),
+			allowedVerbs: sets.NewString(sharedResourceVerbs...),
+			message:      "Secrets are shared with SharedSecrets",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			if err := tattletalev1beta1.AddToScheme(scheme); err != nil {
+				t.Fatal(err)
+			}
+			if err := authorizationv1.AddToScheme(scheme); err != nil {
+				t.Fatal(err)
+			}
+			mapper := meta.NewDefaultRESTMapper(nil)
+			mapper.Add(schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "NetworkPolicy"}, meta.RESTScopeNamespace)
+
+			shared := &tattletalev1beta1.SharedResource{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "deny-all"},
+				Spec: tattletalev1beta1.SharedResourceSpec{
+					APIVersion:      tt.apiVersion,
+					Kind:            tt.kind,
+					SourceNamespace: "default",
+					SourceName:      "deny-all",
+					Targets:         []tattletalev1beta1.TargetResource{{Namespace: "team-a"}},
+				},
+			}
+			c := &reviewingClient{Client: fake.NewFakeClientWithScheme(scheme, shared), allowed: tt.allowedVerbs}
+			r := &SharedResourceReconciler{
+				Client:     c,
+				Log:        ctrl.Log.WithName("test"),
+				Recorder:   record.NewFakeRecorder(10),
+				Cache:      c,
+				RESTMapper: mapper,
+				// No watcher, reconciling must stop before the kind is watched
+				AllowedKinds: tt.allowedKinds,
+			}
+
+			key := types.NamespacedName{Namespace: "default", Name: "deny-all"}
+			// Reconciling again doesn't fail either, nothing is retried in a loop
+			for i := 0; i < 2; i++ {
+				if _, err := r.Reconcile(ctrl.Request{NamespacedName: key}); err != nil {
+					t.Fatalf("reconcile failed: %v", err)
+				}
+			}
+
+			var got tattletalev1beta1.SharedResource
+			if err := c.Get(context.Background(), key, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Status.Source != SourceForbidden {
+				t.Errorf("source = %q, want %q", got.Status.Source, SourceForbidden)
+			}
+			condition := utils.FindCondition(got.Status.Conditions, tattletalev1beta1.ConditionKindAllowed)
+			if condition == nil || condition.Status != corev1.ConditionFalse || condition.Reason != utils.EventReasonForbidden {
+				t.Fatalf("KindAllowed condition = %+v, want False", condition)
+			}
+			if !strings.Contains(condition.Message, tt.message) {
+				t.Errorf("message = %q, want %q", condition.Message, tt.message)
+			}
+		})
+	}
+}
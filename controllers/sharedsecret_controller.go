@@ -20,27 +20,63 @@ import (
 
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 
 	tattletalev1beta1 "tattletale/api/v1beta1"
+	"tattletale/audit"
+	"tattletale/notify"
+	"tattletale/provenance"
+	"tattletale/sources"
+	"tattletale/utils"
 )
 
 // SharedSecretReconciler reconciles a SharedSecret object
 type SharedSecretReconciler struct {
 	client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// Namespaces the operator may read and write in, empty when installed cluster wide
+	AllowedNamespaces sets.String
+	// Namespaces the operator ignores
+	ExcludedNamespaces sets.String
+	// Namespaces copies are never written to
+	ProtectedNamespaces sets.String
+	// Whether targets may copy secrets to configmaps, which hold them in plaintext
+	AllowConfigMapTargets bool
+
+	// The providers enabled to read sources outside of the cluster
+	Providers sources.Providers
+
+	// Signs every copy written, copies aren't signed when nil
+	Signer *provenance.Signer
+
+	// Sends CloudEvents about the outcome of syncs, nil when disabled
+	Notifier *notify.Notifier
+
+	// Records every write to a copy, nil when disabled
+	Audit audit.Writer
+
+	// The SharedSecrets with a target namespace pattern, their watches map events through it. Not kept when nil
+	Patterns *utils.PatternIndex
 }
 
 // +kubebuilder:rbac:groups=tattletale.tattletale.dev,resources=sharedsecrets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=tattletale.tattletale.dev,resources=sharedsecrets/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
 // +kubebuilder:rbac:groups=core,resources=namespaces/status,verbs=get
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 // +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 
 func (r *SharedSecretReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
@@ -48,98 +84,282 @@ func (r *SharedSecretReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error
 	log.V(1).Info("reconciling sharedsecret object")
 
 	var sharedsecret tattletalev1beta1.SharedSecret
-	var namespace corev1.Namespace
 	var sourcesecret corev1.Secret
 
+	// Shared objects in excluded namespaces are left alone
+	if r.ExcludedNamespaces.Has(req.Namespace) {
+		log.V(1).Info("namespace is excluded. skipping reconcile.")
+		return ctrl.Result{}, nil
+	}
+
 	if err := r.Get(ctx, req.NamespacedName, &sharedsecret); err != nil {
+		if apierrors.IsNotFound(err) {
+			// Deleted, nothing is left to sync
+			r.Patterns.Forget(req.NamespacedName)
+			return ctrl.Result{}, nil
+		}
 		log.Error(err, "unable to get sharedsecret")
 		return ctrl.Result{}, err
 	}
+	r.Patterns.Update(req.NamespacedName, &sharedsecret)
 
-	// Check if source secret actually exists, if not skip
-	if err := r.Get(ctx, client.ObjectKey{Namespace: sharedsecret.Spec.SourceNamespace, Name: sharedsecret.Spec.SourceSecret}, &sourcesecret); err != nil {
-		if !apierrors.IsNotFound(err) {
-			log.Error(err, "unable to get secret")
-			return ctrl.Result{}, err
-		} else {
-			log.V(1).Info("source secret does not exist. skipping sync.")
-			return ctrl.Result{}, nil
-		}
+	status := tattletalev1beta1.SharedSecretStatus{TargetSecrets: []string{}, Conditions: sharedsecret.Status.Conditions}
+	// Only sources in the cluster can take part in a cycle
+	if sharedsecret.Spec.Source != nil {
+		status.Conditions = utils.RemoveCondition(status.Conditions, tattletalev1beta1.ConditionCycle)
+	}
+	// Only encrypted sources report whether they were decrypted
+	if sharedsecret.Spec.Source == nil || sharedsecret.Spec.Source.SOPS == nil {
+		status.Conditions = utils.RemoveCondition(status.Conditions, tattletalev1beta1.ConditionDecrypted)
 	}
 
-	// Loop through target namespaces and create/update secrets
-	for _, v := range sharedsecret.Spec.Targets {
-		// Try and get namespace
-		if err := r.Get(ctx, client.ObjectKey{Namespace: "", Name: v.Namespace}, &namespace); err != nil {
-			// Error out
-			// TODO: func ignoreNotFound from kubebuilder book, add to utils
-			if !apierrors.IsNotFound(err) {
-				log.Error(err, "unable to get namespace")
+	var sourceData map[string][]byte
+	var sourceRef string
+	result := ctrl.Result{}
+	if sharedsecret.Spec.Source != nil {
+		// Sources outside of the cluster are polled, come back once the interval is over
+		result.RequeueAfter = sources.RefreshInterval(sharedsecret.Spec.Source.PollInterval, nil)
+
+		// Read the source with its provider, if it can't be read skip
+		description := sources.Description(sharedsecret.Spec.Source)
+		data, err := r.Providers.Fetch(ctx, sharedsecret.Namespace, sharedsecret.Spec.Source)
+		if err != nil {
+			status.Targets = sharedsecret.Status.Targets
+			switch {
+			case sources.IsDecryptionFailed(err):
+				log.V(1).Info("source can't be decrypted. skipping sync.", "source", description, "reason", err.Error())
+				r.Recorder.Eventf(&sharedsecret, corev1.EventTypeWarning, utils.EventReasonDecryptionFailed, "source %s can't be decrypted: %v", description, err)
+				status.SourceSecret = SourceInvalid
+				status.Conditions = utils.SetCondition(status.Conditions, tattletalev1beta1.Condition{
+					Type:    tattletalev1beta1.ConditionDecrypted,
+					Status:  corev1.ConditionFalse,
+					Reason:  utils.EventReasonDecryptionFailed,
+					Message: err.Error(),
+				}, metav1.Now())
+				return result, r.updateStatus(ctx, &sharedsecret, status)
+			case sources.IsForbidden(err):
+				log.V(1).Info("source is not allowed. skipping sync.", "source", description, "reason", err.Error())
+				r.Recorder.Eventf(&sharedsecret, corev1.EventTypeWarning, utils.EventReasonForbidden, "source %s can't be read: %v", description, err)
+				status.SourceSecret = SourceForbidden
+				return ctrl.Result{}, r.updateStatus(ctx, &sharedsecret, status)
+			case sources.IsInvalid(err):
+				log.V(1).Info("source is invalid. skipping sync.", "source", description, "reason", err.Error())
+				r.Recorder.Eventf(&sharedsecret, corev1.EventTypeWarning, utils.EventReasonFailed, "source %s is invalid: %v", description, err)
+				status.SourceSecret = SourceInvalid
+				return result, r.updateStatus(ctx, &sharedsecret, status)
+			case sources.IsNotFound(err):
+				log.V(1).Info("source does not exist. skipping sync.", "source", description)
+				r.Recorder.Eventf(&sharedsecret, corev1.EventTypeWarning, utils.EventReasonSourceMissing, "source %s does not exist", description)
+				status.SourceSecret = SourceMissing
+				return result, r.updateStatus(ctx, &sharedsecret, status)
+			}
+			log.Error(err, "unable to read source", "source", description)
+			r.Recorder.Eventf(&sharedsecret, corev1.EventTypeWarning, utils.EventReasonFailed, "unable to read source %s: %v", description, err)
+			status.SourceSecret = SourceUnavailable
+			if err := r.updateStatus(ctx, &sharedsecret, status); err != nil {
 				return ctrl.Result{}, err
-			} else {
-				// Skip if namespace does not exist
-				log.V(1).Info("namespace does not exist. skipping sync", "namespace", v)
-				continue
 			}
+			return ctrl.Result{}, err
+		}
+		sourceData = data.Values
+		sourceRef = description
+		status.SourceVersion = data.Version
+		if sharedsecret.Spec.Source.SOPS != nil {
+			status.Conditions = utils.SetCondition(status.Conditions, tattletalev1beta1.Condition{
+				Type:   tattletalev1beta1.ConditionDecrypted,
+				Status: corev1.ConditionTrue,
+				Reason: "Decrypted",
+			}, metav1.Now())
+		}
+		result.RequeueAfter = sources.RefreshInterval(sharedsecret.Spec.Source.PollInterval, data)
+	} else {
+		// Check if source secret can be read at all, if not skip
+		if !utils.NamespaceAllowed(r.AllowedNamespaces, r.ExcludedNamespaces, sharedsecret.Spec.SourceNamespace) {
+			log.V(1).Info("source namespace is not allowed. skipping sync.", "namespace", sharedsecret.Spec.SourceNamespace)
+			r.Recorder.Eventf(&sharedsecret, corev1.EventTypeWarning, utils.EventReasonForbidden, "source namespace %s is outside of the namespaces the operator may read", sharedsecret.Spec.SourceNamespace)
+			status.SourceSecret = SourceForbidden
+			status.Targets = sharedsecret.Status.Targets
+			return ctrl.Result{}, r.updateStatus(ctx, &sharedsecret, status)
 		}
 
-		secretFound := true
-		var targetsecret corev1.Secret
-
-		secretName := ""
-		if v.NewName != "" {
-			secretName = v.NewName
-		} else {
-			secretName = sharedsecret.Spec.SourceSecret
+		// Refuse to sync while the source is, through other SharedSecrets, a copy of a copy written here
+		cycle, err := utils.NewSharingGraph(r, r.ExcludedNamespaces).FindCycle(ctx, utils.SharedObjectRef{Kind: utils.KindSharedSecret, Namespace: sharedsecret.Namespace, Name: sharedsecret.Name})
+		if err != nil {
+			log.Error(err, "unable to walk the sharing graph")
+			return ctrl.Result{}, err
 		}
-		// Test if secret exists
-		if err := r.Get(ctx, client.ObjectKey{Namespace: v.Namespace, Name: secretName}, &targetsecret); err != nil {
+		if cycle != nil {
+			path := utils.CyclePath(cycle)
+			log.V(1).Info("sharedsecret takes part in a cycle. skipping sync.", "cycle", path)
+			r.Recorder.Eventf(&sharedsecret, corev1.EventTypeWarning, utils.EventReasonCycle, "sharedsecret takes part in a cycle and isn't synced: %s", path)
+			status.SourceSecret = sharedsecret.Status.SourceSecret
+			status.Targets = sharedsecret.Status.Targets
+			status.Conditions = utils.SetCondition(status.Conditions, tattletalev1beta1.Condition{
+				Type:    tattletalev1beta1.ConditionCycle,
+				Status:  corev1.ConditionTrue,
+				Reason:  utils.EventReasonCycle,
+				Message: path,
+			}, metav1.Now())
+			return ctrl.Result{}, r.updateStatus(ctx, &sharedsecret, status)
+		}
+		status.Conditions = utils.RemoveCondition(status.Conditions, tattletalev1beta1.ConditionCycle)
+
+		// Check if source secret actually exists, if not skip
+		if err := r.Get(ctx, client.ObjectKey{Namespace: sharedsecret.Spec.SourceNamespace, Name: sharedsecret.Spec.SourceSecret}, &sourcesecret); err != nil {
 			if !apierrors.IsNotFound(err) {
 				log.Error(err, "unable to get secret")
 				return ctrl.Result{}, err
+			} else {
+				log.V(1).Info("source secret does not exist. skipping sync.")
+				r.Recorder.Eventf(&sharedsecret, corev1.EventTypeWarning, utils.EventReasonSourceMissing, "source secret %s/%s does not exist", sharedsecret.Spec.SourceNamespace, sharedsecret.Spec.SourceSecret)
+				status.SourceSecret = SourceMissing
+				status.Targets = sharedsecret.Status.Targets
+				return ctrl.Result{}, r.updateStatus(ctx, &sharedsecret, status)
 			}
-			secretFound = false
 		}
+		sourceData = sourcesecret.Data
+		sourceRef = "secret:" + sharedsecret.Spec.SourceNamespace + "/" + sharedsecret.Spec.SourceSecret
+	}
+	status.SourceSecret = SourceFound
+	sourceHash := utils.HashSecretData(sourceData)
+	var auditSource metav1.Object
+	if sharedsecret.Spec.Source == nil {
+		auditSource = &sourcesecret
+	}
+	trail := newAuditTrail(r.Audit, log, "SharedSecret", &sharedsecret, sourceRef, auditSource, status.SourceVersion, sourceHash, "data", "stringData")
+	notifications := newSyncNotifications(r.Notifier, r.Recorder, &sharedsecret, &sharedsecret, "SharedSecret", "sharedsecrets",
+		sharedsecret.Spec.Notifications, sourceHash, status.SourceVersion)
 
-		temp := corev1.Secret{}
-		temp.Name = secretName
-		temp.Namespace = v.Namespace
-		temp.Data = sourcesecret.Data
-		newTargetSecret := temp.DeepCopyObject()
+	targets, err := r.expandTargets(ctx, &sharedsecret, &status)
+	if err != nil {
+		log.Error(err, "unable to list target namespaces")
+		r.Recorder.Eventf(&sharedsecret, corev1.EventTypeWarning, utils.EventReasonFailed, "unable to list target namespaces: %v", err)
+		return ctrl.Result{}, err
+	}
 
-		// Creating secret
-		if !secretFound {
+	// Copies other shared objects take precedence over are left to them
+	copies := targetCopies{
+		Client:              r.Client,
+		log:                 log,
+		recorder:            r.Recorder,
+		allowedNamespaces:   r.AllowedNamespaces,
+		excludedNamespaces:  r.ExcludedNamespaces,
+		protectedNamespaces: r.ProtectedNamespaces,
+		signer:              r.Signer,
+		object:              &sharedsecret,
+		meta:                &sharedsecret,
+		kind:                "SharedSecret",
+		previous:            sharedsecret.Status.Targets,
+		immutable:           sharedsecret.Spec.Immutable,
+		sourceKind:          tattletalev1beta1.TargetKindSecret,
+		values:              sourceData,
+		sourceRef:           sourceRef,
+		sourceVersion:       status.SourceVersion,
+		trail:               trail,
+		notifications:       notifications,
+	}
+	copies.data, copies.binaryData = utils.ConfigMapDataFromSecret(sourceData)
+	secrets := copies.ofKind(tattletalev1beta1.TargetKindSecret, utils.NewSecretWriters(r, r.ExcludedNamespaces))
+	// Copies written as configmaps hold the values in plaintext, they are only written when allowed
+	configmaps := copies.ofKind(tattletalev1beta1.TargetKindConfigMap, utils.NewConfigMapWriters(r, r.ExcludedNamespaces))
+	if !r.AllowConfigMapTargets {
+		configmaps.forbidden = ConfigMapTargetsDisabledMessage
+	}
 
-			if err := r.Create(ctx, newTargetSecret); err != nil {
-				log.Error(err, "unable to create secret in target namespace")
-				return ctrl.Result{}, err
-			} else {
-				log.V(1).Info("Succesfully created secret", "namespace", v)
-			}
+	// Loop through target namespaces and create/update secrets
+	for _, v := range targets {
+		target := copyTarget{
+			namespace:   v.Namespace,
+			name:        sharedsecret.TargetName(v),
+			driftPolicy: utils.EffectiveDriftPolicy(sharedsecret.Spec.DriftPolicy, v.DriftPolicy),
+			encryption:  utils.EffectiveEncryption(sharedsecret.Spec.Encryption, v.Encryption),
+		}
+		copies := secrets
+		if sharedsecret.TargetKind(v) == tattletalev1beta1.TargetKindConfigMap {
+			copies = configmaps
+		}
+		targetStatus, err := copies.sync(ctx, target)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		status.Targets = append(status.Targets, targetStatus)
+	}
+	status.TargetSecrets = append(status.TargetSecrets, secrets.synced...)
+	notifications.finished(status.Targets)
+	status.Conditions = setConflictCondition(status.Conditions, append(secrets.conflicts, configmaps.conflicts...))
 
-		} else {
-			// Updating secret.
-			// ### TODO update only if hashes have changed, downstream repercussions of redundantly updating
-			// ### TODO: Think of updating status, here and in other places
+	// Come back to delete generations once they reach their max age
+	if sharedsecret.Spec.Immutable != nil && sharedsecret.Spec.Immutable.MaxAge != nil {
+		if maxAge := sharedsecret.Spec.Immutable.MaxAge.Duration; result.RequeueAfter == 0 || maxAge < result.RequeueAfter {
+			result.RequeueAfter = maxAge
+		}
+	}
 
-			if err := r.Update(ctx, newTargetSecret); err != nil {
-				log.Error(err, "unable to update secret in target namespace")
-				return ctrl.Result{}, err
-			} else {
-				log.V(1).Info("Succesfully updated secret", "namespace", v)
-			}
+	// TODO: should we tolerate 'partial' errors
+	// TODO: dealing with deletion of CRD, what to do with other objects, should be configurable
+	return result, r.updateStatus(ctx, &sharedsecret, status)
+}
 
+// expandTargets replaces every target whose namespace is a pattern with a target per matching namespace.
+// Explicit targets win over pattern matches writing the same copy and patterns never match the source.
+// Invalid patterns are reported in status.
+func (r *SharedSecretReconciler) expandTargets(ctx context.Context, sharedsecret *tattletalev1beta1.SharedSecret, status *tattletalev1beta1.SharedSecretStatus) ([]tattletalev1beta1.TargetSecret, error) {
+	targets := []tattletalev1beta1.TargetSecret{}
+	seen := map[string]bool{}
+	for _, t := range sharedsecret.Spec.Targets {
+		if !utils.IsNamespacePattern(t.Namespace) {
+			targets = append(targets, t)
+			seen[targetKey(sharedsecret.TargetKind(t), t.Namespace, sharedsecret.TargetName(t))] = true
 		}
+	}
+	if sharedsecret.Spec.Source == nil {
+		seen[targetKey(tattletalev1beta1.TargetKindSecret, sharedsecret.Spec.SourceNamespace, sharedsecret.Spec.SourceSecret)] = true
+	}
 
+	namespaces := &targetNamespaces{reader: r, allowedNamespaces: r.AllowedNamespaces, excludedNamespaces: r.ExcludedNamespaces}
+	for _, t := range sharedsecret.Spec.Targets {
+		if !utils.IsNamespacePattern(t.Namespace) {
+			continue
+		}
+		name := sharedsecret.TargetName(t)
+		if _, err := utils.NewNamespaceMatcher(t.Namespace); err != nil {
+			r.Recorder.Eventf(sharedsecret, corev1.EventTypeWarning, utils.EventReasonInvalid, "target namespace %s is invalid: %v", t.Namespace, err)
+			status.Targets = append(status.Targets, invalidPatternStatus(sharedsecret.Status.Targets, t.Namespace, name, err))
+			continue
+		}
+		matched, err := namespaces.match(ctx, t.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range matched {
+			if key := targetKey(sharedsecret.TargetKind(t), ns, name); !seen[key] {
+				seen[key] = true
+				target := t
+				target.Namespace = ns
+				targets = append(targets, target)
+			}
+		}
 	}
+	return targets, nil
+}
 
-	// TODO: should we tolerate 'partial' errors
-	// TODO: dealing with deletion of CRD, what to do with other objects, should be configurable
-	return ctrl.Result{}, nil
+// updateStatus writes the status of the sharedsecret, skipping the write when nothing changed
+func (r *SharedSecretReconciler) updateStatus(ctx context.Context, sharedsecret *tattletalev1beta1.SharedSecret, status tattletalev1beta1.SharedSecretStatus) error {
+	if equality.Semantic.DeepEqual(sharedsecret.Status, status) {
+		return nil
+	}
+	sharedsecret.Status = status
+	if err := r.Status().Update(ctx, sharedsecret); err != nil {
+		r.Log.Error(err, "unable to update sharedsecret status", "sharedsecret", sharedsecret.Namespace+"/"+sharedsecret.Name)
+		return err
+	}
+	return nil
 }
 
-func (r *SharedSecretReconciler) SetupWithManager(mgr ctrl.Manager) (controller.Controller, error) {
+func (r *SharedSecretReconciler) SetupWithManager(mgr ctrl.Manager, options Options) (controller.Controller, error) {
+	controllerOptions := options.controllerOptions(r, r.Log)
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&tattletalev1beta1.SharedSecret{}).
-		Build(r)
+		WithOptions(controllerOptions).
+		Build(controllerOptions.Reconciler)
 }
@@ -0,0 +1,52 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Values of the source field in the status of shared objects
+	SourceFound     = "Found"
+	SourceMissing   = "Missing"
+	SourceForbidden = "Forbidden"
+	SourceInvalid   = "Invalid"
+	// The source outside of the cluster couldn't be read, it is retried
+	SourceUnavailable = "Unavailable"
+
+	DriftedMessage   = "copy was modified outside of tattletale"
+	ForbiddenMessage = "namespace is outside of the namespaces the operator may write to"
+	ProtectedMessage = "namespace is protected, the operator never writes to it"
+
+	ConfigMapTargetsDisabledMessage = "copying secrets to configmaps is disabled in the operator config"
+	EncryptedConfigMapMessage       = "encrypted copies can only be written as secrets"
+	ImmutableKindMessage            = "immutable copies can only be written as the kind of the source"
+	PatternUnsupportedMessage       = "namespace patterns are only supported by SharedSecrets and SharedConfigMaps"
+)
+
+// getNamespace reads a target namespace. Namespaces are cluster scoped and can't be read when the
+// operator is restricted to a set of namespaces, in which case the namespace is assumed to exist.
+func getNamespace(ctx context.Context, c client.Reader, allowed sets.String, name string, namespace *corev1.Namespace) error {
+	if allowed.Len() > 0 {
+		return nil
+	}
+	return c.Get(ctx, client.ObjectKey{Namespace: "", Name: name}, namespace)
+}
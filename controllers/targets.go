@@ -0,0 +1,108 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+	"tattletale/utils"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// targetNamespaces lists the namespaces target namespace patterns are matched against, once per reconcile
+// and only when a shared object has a pattern
+type targetNamespaces struct {
+	reader             client.Reader
+	allowedNamespaces  sets.String
+	excludedNamespaces sets.String
+
+	namespaces []string
+}
+
+// match returns the namespaces the operator may write to that match a target namespace pattern. Namespaces
+// can't be listed when the operator is restricted to a set of namespaces, the set is matched instead.
+func (t *targetNamespaces) match(ctx context.Context, pattern string) ([]string, error) {
+	if t.namespaces == nil {
+		namespaces := []string{}
+		if t.allowedNamespaces.Len() > 0 {
+			namespaces = t.allowedNamespaces.List()
+		} else {
+			var list corev1.NamespaceList
+			if err := t.reader.List(ctx, &list); err != nil {
+				return nil, err
+			}
+			for _, ns := range list.Items {
+				// Nothing can be written to namespaces being deleted
+				if ns.Status.Phase != corev1.NamespaceTerminating {
+					namespaces = append(namespaces, ns.Name)
+				}
+			}
+			sort.Strings(namespaces)
+		}
+		t.namespaces = namespaces
+	}
+
+	matched, err := utils.MatchNamespaces(pattern, t.namespaces)
+	if err != nil {
+		return nil, err
+	}
+	allowed := []string{}
+	for _, ns := range matched {
+		if utils.NamespaceAllowed(t.allowedNamespaces, t.excludedNamespaces, ns) {
+			allowed = append(allowed, ns)
+		}
+	}
+	return allowed, nil
+}
+
+// targetKey tells the copies of a shared object apart, a secret and a configmap may share a namespace and name
+func targetKey(kind tattletalev1beta1.TargetKind, namespace, name string) string {
+	return string(kind) + ":" + utils.IndexKey(namespace, name)
+}
+
+// invalidPatternStatus reports a target whose namespace pattern can't be parsed
+func invalidPatternStatus(previous []tattletalev1beta1.TargetStatus, pattern, name string, err error) tattletalev1beta1.TargetStatus {
+	status := utils.NewTargetStatus(previous, pattern, name, tattletalev1beta1.TargetStateInvalid, "", false)
+	status.Message = err.Error()
+	return status
+}
+
+// conflictMessage reports a copy written by another shared object taking precedence
+func conflictMessage(kind, namespace, name string) string {
+	return fmt.Sprintf("copy is written by %s %s/%s, which takes precedence", kind, namespace, name)
+}
+
+// setConflictCondition records the copies written by other shared objects taking precedence, given as
+// "kind namespace/name by Kind namespace/name", and removes the condition once there are none
+func setConflictCondition(conditions []tattletalev1beta1.Condition, conflicts []string) []tattletalev1beta1.Condition {
+	if len(conflicts) == 0 {
+		return utils.RemoveCondition(conditions, tattletalev1beta1.ConditionConflict)
+	}
+	return utils.SetCondition(conditions, tattletalev1beta1.Condition{
+		Type:    tattletalev1beta1.ConditionConflict,
+		Status:  corev1.ConditionTrue,
+		Reason:  utils.EventReasonTargetConflict,
+		Message: fmt.Sprintf("copies written by other shared objects taking precedence: %s", strings.Join(conflicts, ", ")),
+	}, metav1.Now())
+}
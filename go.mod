@@ -3,13 +3,24 @@ module tattletale
 go 1.12
 
 require (
+	filippo.io/age v1.1.1
+	github.com/getsops/sops/v3 v3.8.1
 	github.com/go-logr/logr v0.1.0
+	github.com/go-logr/zapr v0.1.0
+	github.com/json-iterator/go v1.1.6 // indirect
+	github.com/modern-go/reflect2 v1.0.1 // indirect
 	github.com/onsi/ginkgo v1.8.0
 	github.com/onsi/gomega v1.5.0
-	golang.org/x/net v0.0.0-20190501004415-9ce7a6920f09
+	go.uber.org/zap v1.9.1
+	golang.org/x/crypto v0.14.0
+	golang.org/x/net v0.17.0
+	golang.org/x/time v0.3.0
+	gomodules.xyz/jsonpatch/v2 v2.0.1
+	google.golang.org/grpc v1.58.3
 	k8s.io/api v0.0.0-20190409021203-6e4e0e4f393b
 	k8s.io/apimachinery v0.0.0-20190404173353-6a84e37a896d
 	k8s.io/client-go v11.0.1-0.20190409021438-1a26190bd76a+incompatible
 	sigs.k8s.io/controller-runtime v0.2.0
 	sigs.k8s.io/controller-tools v0.2.0 // indirect
+	sigs.k8s.io/yaml v1.1.0
 )
@@ -0,0 +1,250 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package inspect builds the source to target sharing graph out of shared objects
+// and renders it for the kubectl-tattletale plugin
+package inspect
+
+import (
+	"sort"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+	"tattletale/sources"
+	"tattletale/utils"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	KindSharedSecret    = "SharedSecret"
+	KindSharedConfigMap = "SharedConfigMap"
+	KindSharedResource  = "SharedResource"
+)
+
+// ObjectRef points at a namespaced object
+type ObjectRef struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+func (r ObjectRef) String() string {
+	if r.Namespace == "" {
+		return r.Name
+	}
+	return r.Namespace + "/" + r.Name
+}
+
+// Edge is a single source to target copy made on behalf of a shared object
+type Edge struct {
+	Kind   string    `json:"kind"`
+	Owner  ObjectRef `json:"owner"`
+	Source ObjectRef `json:"source"`
+	Target ObjectRef `json:"target"`
+	// The kind of the copy when it isn't the kind of the source, e.g. a SharedSecret writing a ConfigMap
+	TargetKind string `json:"targetKind,omitempty"`
+	// The kind of the source and copy of a SharedResource, as Kind.group
+	ResourceKind string `json:"resourceKind,omitempty"`
+
+	// Observed state of the copy, as recorded in the owner's status
+	State tattletalev1beta1.TargetState `json:"state,omitempty"`
+	Hash  string                        `json:"hash,omitempty"`
+}
+
+// Graph holds every sharing relationship in a cluster
+type Graph struct {
+	Edges []Edge `json:"edges"`
+}
+
+// NewGraph builds the sharing graph out of lists of shared objects. Targets whose namespace is a pattern
+// get an edge per namespace matching it, like the controllers expand them; they are kept as they are when
+// namespaces is nil, e.g. when they can't be listed. SharedResources don't expand patterns.
+func NewGraph(secrets []tattletalev1beta1.SharedSecret, configmaps []tattletalev1beta1.SharedConfigMap, resources []tattletalev1beta1.SharedResource, namespaces []string) *Graph {
+	g := &Graph{Edges: []Edge{}}
+
+	for _, s := range secrets {
+		owner := ObjectRef{Namespace: s.Namespace, Name: s.Name}
+		source := ObjectRef{Namespace: s.Spec.SourceNamespace, Name: s.Spec.SourceSecret}
+		if s.Spec.Source != nil {
+			// Sources outside of the cluster have no namespace
+			source = ObjectRef{Name: sources.Description(s.Spec.Source)}
+		}
+		targets := newTargets(KindSharedSecret, source, namespaces)
+		for _, t := range s.Spec.Targets {
+			targets.add(t.Namespace, s.TargetName(t), s.TargetKind(t))
+		}
+		for _, t := range targets.expand() {
+			g.Edges = append(g.Edges, newEdge(KindSharedSecret, owner, source, t.ref, t.kind, s.Status.Targets))
+		}
+	}
+
+	for _, c := range configmaps {
+		owner := ObjectRef{Namespace: c.Namespace, Name: c.Name}
+		source := ObjectRef{Namespace: c.Spec.SourceNamespace, Name: c.Spec.SourceConfigMap}
+		if c.Spec.Source != nil && c.Spec.Source.Git != nil {
+			source = ObjectRef{Name: sources.GitDescription(c.Spec.Source.Git)}
+		}
+		targets := newTargets(KindSharedConfigMap, source, namespaces)
+		for _, t := range c.Spec.Targets {
+			targets.add(t.Namespace, c.TargetName(t), c.TargetKind(t))
+		}
+		for _, t := range targets.expand() {
+			g.Edges = append(g.Edges, newEdge(KindSharedConfigMap, owner, source, t.ref, t.kind, c.Status.Targets))
+		}
+	}
+
+	for _, r := range resources {
+		owner := ObjectRef{Namespace: r.Namespace, Name: r.Name}
+		source := ObjectRef{Namespace: r.Spec.SourceNamespace, Name: r.Spec.SourceName}
+		for _, t := range r.Spec.Targets {
+			name := t.NewName
+			if name == "" {
+				name = r.Spec.SourceName
+			}
+			e := newEdge(KindSharedResource, owner, source, ObjectRef{Namespace: t.Namespace, Name: name}, "", r.Status.Targets)
+			e.ResourceKind = schema.FromAPIVersionAndKind(r.Spec.APIVersion, r.Spec.Kind).GroupKind().String()
+			g.Edges = append(g.Edges, e)
+		}
+	}
+
+	sort.SliceStable(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Owner != b.Owner {
+			return a.Owner.String() < b.Owner.String()
+		}
+		return a.Target.String() < b.Target.String()
+	})
+	return g
+}
+
+type target struct {
+	ref  ObjectRef
+	kind tattletalev1beta1.TargetKind
+}
+
+// targets expands the targets of a shared object
+type targets struct {
+	kind       string
+	source     ObjectRef
+	namespaces []string
+
+	explicit []target
+	patterns []target
+}
+
+func newTargets(kind string, source ObjectRef, namespaces []string) *targets {
+	return &targets{kind: kind, source: source, namespaces: namespaces}
+}
+
+func (t *targets) add(namespace, name string, kind tattletalev1beta1.TargetKind) {
+	if utils.IsNamespacePattern(namespace) {
+		t.patterns = append(t.patterns, target{ObjectRef{Namespace: namespace, Name: name}, kind})
+	} else {
+		t.explicit = append(t.explicit, target{ObjectRef{Namespace: namespace, Name: name}, kind})
+	}
+}
+
+// expand returns the explicit targets, then the targets matching a pattern that are neither one of them nor
+// the source. Invalid patterns are kept as they are, the status of the shared object reports them.
+func (t *targets) expand() []target {
+	expanded := append([]target{}, t.explicit...)
+	seen := map[target]bool{{t.source, tattletalev1beta1.TargetKind(ObjectKind(t.kind))}: true}
+	for _, e := range t.explicit {
+		seen[e] = true
+	}
+	for _, p := range t.patterns {
+		matched, err := utils.MatchNamespaces(p.ref.Namespace, t.namespaces)
+		if err != nil || t.namespaces == nil {
+			expanded = append(expanded, p)
+			continue
+		}
+		for _, ns := range matched {
+			e := target{ObjectRef{Namespace: ns, Name: p.ref.Name}, p.kind}
+			if !seen[e] {
+				seen[e] = true
+				expanded = append(expanded, e)
+			}
+		}
+	}
+	return expanded
+}
+
+func newEdge(kind string, owner, source, target ObjectRef, targetKind tattletalev1beta1.TargetKind, statuses []tattletalev1beta1.TargetStatus) Edge {
+	e := Edge{Kind: kind, Owner: owner, Source: source, Target: target}
+	// Statuses only record the kind of copies of the other kind
+	if string(targetKind) == ObjectKind(kind) {
+		targetKind = ""
+	}
+	e.TargetKind = string(targetKind)
+	for _, s := range statuses {
+		if s.Namespace == target.Namespace && s.Name == target.Name && s.Kind == targetKind {
+			e.State = s.State
+			e.Hash = s.Hash
+		}
+	}
+	return e
+}
+
+// ObjectKind returns the kind of object copied by a shared object kind
+func ObjectKind(kind string) string {
+	if kind == KindSharedSecret {
+		return "Secret"
+	}
+	return "ConfigMap"
+}
+
+// SourceKind returns the kind of the source of the edge
+func (e Edge) SourceKind() string {
+	if e.ResourceKind != "" {
+		return e.ResourceKind
+	}
+	return ObjectKind(e.Kind)
+}
+
+// CopyKind returns the kind of the copy made along the edge
+func (e Edge) CopyKind() string {
+	if e.TargetKind != "" {
+		return e.TargetKind
+	}
+	return e.SourceKind()
+}
+
+// Targets returns the edges of the copies of a shared object
+func (g *Graph) Targets(kind string, owner ObjectRef) []Edge {
+	edges := []Edge{}
+	for _, e := range g.Edges {
+		if e.Kind == kind && e.Owner == owner {
+			edges = append(edges, e)
+		}
+	}
+	return edges
+}
+
+// Explain returns the edges an object takes part in, either as the source or as a copy.
+// objectKind is Secret, ConfigMap or the Kind.group of a kind shared by SharedResources.
+func (g *Graph) Explain(objectKind string, object ObjectRef) (asSource, asTarget []Edge) {
+	asSource, asTarget = []Edge{}, []Edge{}
+	for _, e := range g.Edges {
+		if e.SourceKind() == objectKind && e.Source == object {
+			asSource = append(asSource, e)
+		}
+		if e.CopyKind() == objectKind && e.Target == object {
+			asTarget = append(asTarget, e)
+		}
+	}
+	return
+}
@@ -0,0 +1,249 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inspect
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestGraph() *Graph {
+	secrets := []tattletalev1beta1.SharedSecret{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "tattletale-test", Name: "sharedsecret-sample1"},
+		Spec: tattletalev1beta1.SharedSecretSpec{
+			SourceSecret:    "tattletale-secret-sample1",
+			SourceNamespace: "tattletale-test",
+			Targets: []tattletalev1beta1.TargetSecret{
+				{Namespace: "tattletale-test2"},
+				{Namespace: "tattletale-test1", NewName: "renamed"},
+			},
+		},
+		Status: tattletalev1beta1.SharedSecretStatus{
+			Targets: []tattletalev1beta1.TargetStatus{
+				{Namespace: "tattletale-test1", Name: "renamed", State: tattletalev1beta1.TargetStateSynced, Hash: "abc"},
+			},
+		},
+	}}
+	configmaps := []tattletalev1beta1.SharedConfigMap{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "tattletale-test", Name: "sharedconfigmap-sample1"},
+		Spec: tattletalev1beta1.SharedConfigMapSpec{
+			SourceConfigMap: "tattletale-secret-sample1",
+			SourceNamespace: "tattletale-test",
+			Targets: []tattletalev1beta1.TargetConfigMap{
+				{Namespace: "tattletale-test1", NewName: "renamed"},
+				{Namespace: "tattletale-test1", NewName: "settings", Kind: tattletalev1beta1.TargetKindSecret},
+			},
+		},
+		Status: tattletalev1beta1.SharedConfigMapStatus{
+			Targets: []tattletalev1beta1.TargetStatus{
+				{Namespace: "tattletale-test1", Name: "settings", Kind: tattletalev1beta1.TargetKindSecret, State: tattletalev1beta1.TargetStateSynced},
+			},
+		},
+	}}
+	resources := []tattletalev1beta1.SharedResource{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "tattletale-test", Name: "sharedresource-sample1"},
+		Spec: tattletalev1beta1.SharedResourceSpec{
+			APIVersion:      "networking.k8s.io/v1",
+			Kind:            "NetworkPolicy",
+			SourceName:      "deny-all",
+			SourceNamespace: "tattletale-test",
+			Targets:         []tattletalev1beta1.TargetResource{{Namespace: "tattletale-test1"}},
+		},
+		Status: tattletalev1beta1.SharedResourceStatus{
+			Targets: []tattletalev1beta1.TargetStatus{
+				{Namespace: "tattletale-test1", Name: "deny-all", State: tattletalev1beta1.TargetStateSynced, Hash: "def"},
+			},
+		},
+	}}
+	return NewGraph(secrets, configmaps, resources, nil)
+}
+
+func TestGraphEdges(t *testing.T) {
+	g := newTestGraph()
+
+	// One edge per target, sorted
+	want := []Edge{
+		{Kind: KindSharedConfigMap, Owner: ObjectRef{Namespace: "tattletale-test", Name: "sharedconfigmap-sample1"}, Source: ObjectRef{Namespace: "tattletale-test", Name: "tattletale-secret-sample1"}, Target: ObjectRef{Namespace: "tattletale-test1", Name: "renamed"}},
+		{Kind: KindSharedConfigMap, Owner: ObjectRef{Namespace: "tattletale-test", Name: "sharedconfigmap-sample1"}, Source: ObjectRef{Namespace: "tattletale-test", Name: "tattletale-secret-sample1"}, Target: ObjectRef{Namespace: "tattletale-test1", Name: "settings"}, TargetKind: "Secret", State: tattletalev1beta1.TargetStateSynced},
+		{Kind: KindSharedResource, Owner: ObjectRef{Namespace: "tattletale-test", Name: "sharedresource-sample1"}, Source: ObjectRef{Namespace: "tattletale-test", Name: "deny-all"}, Target: ObjectRef{Namespace: "tattletale-test1", Name: "deny-all"}, ResourceKind: "NetworkPolicy.networking.k8s.io", State: tattletalev1beta1.TargetStateSynced, Hash: "def"},
+		{Kind: KindSharedSecret, Owner: ObjectRef{Namespace: "tattletale-test", Name: "sharedsecret-sample1"}, Source: ObjectRef{Namespace: "tattletale-test", Name: "tattletale-secret-sample1"}, Target: ObjectRef{Namespace: "tattletale-test1", Name: "renamed"}, State: tattletalev1beta1.TargetStateSynced, Hash: "abc"},
+		{Kind: KindSharedSecret, Owner: ObjectRef{Namespace: "tattletale-test", Name: "sharedsecret-sample1"}, Source: ObjectRef{Namespace: "tattletale-test", Name: "tattletale-secret-sample1"}, Target: ObjectRef{Namespace: "tattletale-test2", Name: "tattletale-secret-sample1"}},
+	}
+	if !reflect.DeepEqual(g.Edges, want) {
+		t.Errorf("edges = %+v, want %+v", g.Edges, want)
+	}
+}
+
+func TestGraphTargetPatterns(t *testing.T) {
+	secrets := []tattletalev1beta1.SharedSecret{{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "ca"},
+		Spec: tattletalev1beta1.SharedSecretSpec{
+			SourceSecret:    "ca",
+			SourceNamespace: "team-a",
+			Targets: []tattletalev1beta1.TargetSecret{
+				{Namespace: "team-b", NewName: "ca"},
+				{Namespace: "team-*"},
+				{Namespace: "/team-(b|c)/", NewName: "other"},
+				{Namespace: "team-[a"},
+			},
+		},
+	}}
+
+	tests := []struct {
+		name       string
+		namespaces []string
+		want       []ObjectRef
+	}{
+		{
+			// The source is never a target, and the explicit target is only listed once
+			name:       "expanded",
+			namespaces: []string{"default", "team-a", "team-b", "team-c"},
+			want: []ObjectRef{
+				{Namespace: "team-[a", Name: "ca"},
+				{Namespace: "team-b", Name: "ca"},
+				{Namespace: "team-b", Name: "other"},
+				{Namespace: "team-c", Name: "ca"},
+				{Namespace: "team-c", Name: "other"},
+			},
+		},
+		{
+			// Patterns are kept as they are when the namespaces are unknown
+			name:       "unknown namespaces",
+			namespaces: nil,
+			want: []ObjectRef{
+				{Namespace: "/team-(b|c)/", Name: "other"},
+				{Namespace: "team-*", Name: "ca"},
+				{Namespace: "team-[a", Name: "ca"},
+				{Namespace: "team-b", Name: "ca"},
+			},
+		},
+		{
+			name:       "no namespaces",
+			namespaces: []string{},
+			want:       []ObjectRef{{Namespace: "team-[a", Name: "ca"}, {Namespace: "team-b", Name: "ca"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refs := []ObjectRef{}
+			for _, e := range NewGraph(secrets, nil, nil, tt.namespaces).Targets(KindSharedSecret, ObjectRef{Namespace: "default", Name: "ca"}) {
+				refs = append(refs, e.Target)
+			}
+			if !reflect.DeepEqual(refs, tt.want) {
+				t.Errorf("targets = %v, want %v", refs, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphExplain(t *testing.T) {
+	g := newTestGraph()
+
+	tests := []struct {
+		name       string
+		objectKind string
+		ref        ObjectRef
+		asSource   int
+		// The owners of the edges writing the object
+		asTarget []ObjectRef
+	}{
+		{
+			name:       "copy",
+			objectKind: "Secret",
+			ref:        ObjectRef{Namespace: "tattletale-test1", Name: "renamed"},
+			asTarget:   []ObjectRef{{Namespace: "tattletale-test", Name: "sharedsecret-sample1"}},
+		},
+		{
+			name:       "source",
+			objectKind: "Secret",
+			ref:        ObjectRef{Namespace: "tattletale-test", Name: "tattletale-secret-sample1"},
+			asSource:   2,
+		},
+		{
+			// Copies of the other kind are explained as the kind they are written as
+			name:       "copy of the other kind",
+			objectKind: "Secret",
+			ref:        ObjectRef{Namespace: "tattletale-test1", Name: "settings"},
+			asTarget:   []ObjectRef{{Namespace: "tattletale-test", Name: "sharedconfigmap-sample1"}},
+		},
+		{
+			name:       "copy of another kind",
+			objectKind: "NetworkPolicy.networking.k8s.io",
+			ref:        ObjectRef{Namespace: "tattletale-test1", Name: "deny-all"},
+			asTarget:   []ObjectRef{{Namespace: "tattletale-test", Name: "sharedresource-sample1"}},
+		},
+		{
+			// Resources of other kinds sharing a namespace and name aren't mixed up
+			name:       "source of another kind",
+			objectKind: "ConfigMap",
+			ref:        ObjectRef{Namespace: "tattletale-test", Name: "deny-all"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asSource, asTarget := g.Explain(tt.objectKind, tt.ref)
+			if len(asSource) != tt.asSource {
+				t.Errorf("explained as the source of %d edges, want %d", len(asSource), tt.asSource)
+			}
+			owners := []ObjectRef{}
+			for _, e := range asTarget {
+				owners = append(owners, e.Owner)
+			}
+			if len(owners) != len(tt.asTarget) || (len(owners) > 0 && !reflect.DeepEqual(owners, tt.asTarget)) {
+				t.Errorf("explained as written by %v, want %v", owners, tt.asTarget)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	g := newTestGraph()
+
+	tests := []struct {
+		name    string
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "dot",
+			format: FormatDOT,
+			want: `digraph tattletale {
+  rankdir=LR;
+  "ConfigMap tattletale-test/tattletale-secret-sample1" -> "ConfigMap tattletale-test1/renamed" [label="SharedConfigMap tattletale-test/sharedconfigmap-sample1"];
+}
+`,
+		},
+		{name: "unknown format", format: "yaml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := Render(&buf, tt.format, g.Edges[:1])
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Render() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && buf.String() != tt.want {
+				t.Errorf("Render() = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package inspect
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+)
+
+// Output formats understood by Render
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatDOT   = "dot"
+)
+
+// Render writes the edges in the given format
+func Render(w io.Writer, format string, edges []Edge) error {
+	switch format {
+	case FormatTable, "":
+		return WriteTable(w, edges)
+	case FormatJSON:
+		return WriteJSON(w, edges)
+	case FormatDOT:
+		return WriteDOT(w, edges)
+	}
+	return fmt.Errorf("unknown output format %q, must be one of %s, %s or %s", format, FormatTable, FormatJSON, FormatDOT)
+}
+
+// WriteTable writes one row per edge
+func WriteTable(w io.Writer, edges []Edge) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tOWNER\tSOURCE\tTARGET\tSTATE\tHASH")
+	for _, e := range edges {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Kind, e.Owner, e.Source, e.Target, OrNone(string(e.State)), ShortHash(e.Hash))
+	}
+	return tw.Flush()
+}
+
+// WriteJSON writes the edges as an indented JSON array
+func WriteJSON(w io.Writer, edges []Edge) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(edges)
+}
+
+// WriteDOT writes the edges as a Graphviz digraph, one node per object
+func WriteDOT(w io.Writer, edges []Edge) error {
+	if _, err := fmt.Fprintln(w, "digraph tattletale {"); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "  rankdir=LR;")
+	for _, e := range edges {
+		fmt.Fprintf(w, "  %s -> %s [label=%s];\n",
+			strconv.Quote(e.SourceKind()+" "+e.Source.String()),
+			strconv.Quote(e.CopyKind()+" "+e.Target.String()),
+			strconv.Quote(e.Kind+" "+e.Owner.String()))
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// OrNone renders empty values as <none>
+func OrNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
+
+// ShortHash truncates a hash for display
+func ShortHash(h string) string {
+	if len(h) > 12 {
+		return h[:12]
+	}
+	return OrNone(h)
+}
@@ -17,17 +17,29 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
+	configv1alpha1 "tattletale/api/config/v1alpha1"
+	tattletalev1 "tattletale/api/v1"
 	tattletalev1beta1 "tattletale/api/v1beta1"
+	"tattletale/audit"
 	"tattletale/controllers"
+	"tattletale/notify"
+	"tattletale/provenance"
+	"tattletale/sources"
 	"tattletale/utils"
+	"tattletale/webhooks"
 
+	authorizationv1 "k8s.io/api/authorization/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -39,58 +51,313 @@ var (
 func init() {
 
 	_ = tattletalev1beta1.AddToScheme(scheme)
+	_ = tattletalev1.AddToScheme(scheme)
 	_ = corev1.AddToScheme(scheme)
+	_ = authorizationv1.AddToScheme(scheme)
 	// +kubebuilder:scaffold:scheme
 }
 
+// commaSeparated is a flag holding a comma separated list, replaced rather than appended to when set again
+type commaSeparated struct {
+	values *[]string
+}
+
+func (c commaSeparated) String() string {
+	if c.values == nil {
+		return ""
+	}
+	return strings.Join(*c.values, ",")
+}
+
+func (c commaSeparated) Set(value string) error {
+	*c.values = nil
+	if value != "" {
+		*c.values = strings.Split(value, ",")
+	}
+	return nil
+}
+
 func main() {
-	var metricsAddr string
-	var enableLeaderElection bool
-	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
-	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
+	var configFile string
+	config := configv1alpha1.Default()
+	manager, controller := &config.Manager, &config.Controller
+
+	flag.StringVar(&configFile, "config", "",
+		"A configuration file of kind OperatorConfig. Flags given on the command line override the settings of the file.")
+	flag.StringVar(&manager.MetricsAddr, "metrics-addr", manager.MetricsAddr, "The address the metric endpoint binds to.")
+	flag.BoolVar(&manager.LeaderElection.Enabled, "enable-leader-election", manager.LeaderElection.Enabled,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&manager.LeaderElection.Namespace, "leader-election-namespace", manager.LeaderElection.Namespace,
+		"The namespace of the leader election configmap. Defaults to the namespace the manager runs in.")
+	flag.StringVar(&manager.LeaderElection.ID, "leader-election-id", manager.LeaderElection.ID, "The name of the leader election configmap.")
+	flag.DurationVar(&manager.LeaderElection.LeaseDuration.Duration, "leader-election-lease-duration", manager.LeaderElection.LeaseDuration.Duration,
+		"The duration standby managers wait before forcing a takeover of leadership.")
+	flag.DurationVar(&manager.LeaderElection.RenewDeadline.Duration, "leader-election-renew-deadline", manager.LeaderElection.RenewDeadline.Duration,
+		"The duration the leader retries renewing leadership before giving it up.")
+	flag.DurationVar(&manager.LeaderElection.RetryPeriod.Duration, "leader-election-retry-period", manager.LeaderElection.RetryPeriod.Duration,
+		"The duration managers wait between attempts to acquire or renew leadership.")
+	flag.BoolVar(&manager.Webhooks.Enabled, "enable-webhooks", manager.Webhooks.Enabled,
+		"Serve webhooks. Needed to convert SharedSecrets and SharedConfigMaps between the v1beta1 and v1 APIs and to default them.")
+	flag.IntVar(&manager.Webhooks.Port, "webhook-port", manager.Webhooks.Port, "The port the webhook server binds to.")
+	flag.StringVar(&manager.Webhooks.CertDir, "webhook-cert-dir", manager.Webhooks.CertDir, "The directory holding the tls.crt and tls.key of the webhook server.")
+	flag.StringVar(&manager.HealthAddr, "health-addr", manager.HealthAddr, "The address the /healthz and /readyz endpoints bind to. Set to 0 to disable them.")
+	flag.DurationVar(&manager.SyncPeriod.Duration, "sync-period", manager.SyncPeriod.Duration, "How often every shared object is reconciled even if nothing changed.")
+	flag.Float64Var(&controller.EventQPS, "event-qps", controller.EventQPS, "The sustained number of events per second emitted for a single shared object.")
+	flag.IntVar(&controller.EventBurst, "event-burst", controller.EventBurst, "The number of events a single shared object can emit in a burst.")
+	flag.IntVar(&controller.MaxConcurrentReconciles, "max-concurrent-reconciles", controller.MaxConcurrentReconciles, "The number of shared objects of each kind reconciled in parallel.")
+	flag.DurationVar(&controller.RetryBaseDelay.Duration, "retry-base-delay", controller.RetryBaseDelay.Duration, "The delay before the first retry of a failed reconcile, doubled on every further failure.")
+	flag.DurationVar(&controller.RetryMaxDelay.Duration, "retry-max-delay", controller.RetryMaxDelay.Duration, "The longest delay between retries of a failed reconcile.")
+	flag.Float64Var(&controller.RetryQPS, "retry-qps", controller.RetryQPS, "The sustained number of failed reconciles retried per second across all shared objects.")
+	flag.IntVar(&controller.RetryBurst, "retry-burst", controller.RetryBurst, "The number of failed reconciles that can be retried in a burst.")
+	flag.Float64Var(&manager.KubeAPIQPS, "kube-api-qps", manager.KubeAPIQPS, "The sustained number of requests per second the manager sends to the API server.")
+	flag.IntVar(&manager.KubeAPIBurst, "kube-api-burst", manager.KubeAPIBurst, "The number of requests the manager can send to the API server in a burst.")
+	flag.Var(commaSeparated{&manager.Namespaces}, "namespaces",
+		"A comma separated list of namespaces to restrict the manager to. Enabling this will only read and write shared objects, secrets and configmaps in those namespaces.")
+	flag.Var(commaSeparated{&manager.ExcludedNamespaces}, "excluded-namespaces",
+		"A comma separated list of namespaces the manager ignores. Shared objects in them aren't reconciled and they are never read from or written to.")
+	flag.Var(commaSeparated{&manager.ProtectedNamespaces}, "protected-namespaces",
+		"A comma separated list of namespaces copies are never written to. The namespace the manager runs in is always protected.")
+	flag.Var(commaSeparated{&controller.SharedResourceKinds}, "shared-resource-kinds",
+		"A comma separated list of kinds SharedResources may share, as Kind.group or Kind for the core group.")
+	flag.StringVar(&controller.FileSourceDirectory, "file-source-directory", controller.FileSourceDirectory,
+		"The directory SharedSecrets may read file sources from. File sources are disabled when empty.")
+	flag.Var(commaSeparated{&controller.HTTPSourceHosts}, "http-source-hosts",
+		"A comma separated list of hosts SharedSecrets may read HTTP sources from. HTTP sources are disabled when empty.")
+	flag.Var(commaSeparated{&controller.VaultAddresses}, "vault-addresses",
+		"A comma separated list of Vault servers SharedSecrets may read from, as scheme://host[:port]. Vault sources are disabled when empty.")
+	flag.Var(commaSeparated{&controller.GitRepositories}, "git-repositories",
+		"A comma separated list of URL prefixes of the Git repositories SharedConfigMaps may read from. Git sources are disabled when empty.")
+	flag.StringVar(&controller.GitCacheDirectory, "git-cache-directory", controller.GitCacheDirectory, "Where Git repositories are mirrored.")
+	flag.StringVar(&controller.SigningKeyFile, "signing-key-file", controller.SigningKeyFile,
+		"A file holding the ed25519 private key copies are signed with. Copies aren't signed when empty.")
+	flag.BoolVar(&controller.AllowSecretToConfigMap, "allow-secret-to-configmap", controller.AllowSecretToConfigMap,
+		"Let SharedSecrets write copies as configmaps, which hold the values in plaintext.")
+	flag.StringVar(&config.Audit.Path, "audit-log", config.Audit.Path,
+		"The file every write to a copy is recorded in as JSON lines, - for stdout. Nothing is recorded when empty.")
+	flag.StringVar(&config.Logging.Level, "log-level", config.Logging.Level, "The minimum level of the logs, one of debug, info or error.")
+	flag.BoolVar(&config.Logging.Development, "log-development", config.Logging.Development, "Write human readable logs instead of JSON.")
 	flag.Parse()
 
-	ctrl.SetLogger(zap.Logger(true))
+	if configFile != "" {
+		if err := configv1alpha1.LoadInto(configFile, config); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		// Parse again so flags given on the command line win over the file
+		flag.Parse()
+	}
+	if err := config.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	ctrl.SetLogger(utils.NewLogger(os.Stderr, config.Logging.Level, config.Logging.Development))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	// Reads are served from the cache, so this budget is mostly spent on writing copies and status
+	cfg := ctrl.GetConfigOrDie()
+	cfg.QPS = float32(manager.KubeAPIQPS)
+	cfg.Burst = manager.KubeAPIBurst
+
+	options := ctrl.Options{
 		Scheme:             scheme,
-		MetricsBindAddress: metricsAddr,
-		LeaderElection:     enableLeaderElection,
-	})
+		MetricsBindAddress: manager.MetricsAddr,
+		LeaderElection:     manager.LeaderElection.Enabled,
+		SyncPeriod:         &manager.SyncPeriod.Duration,
+
+		LeaderElectionNamespace: manager.LeaderElection.Namespace,
+		LeaderElectionID:        manager.LeaderElection.ID,
+		LeaseDuration:           &manager.LeaderElection.LeaseDuration.Duration,
+		RenewDeadline:           &manager.LeaderElection.RenewDeadline.Duration,
+		RetryPeriod:             &manager.LeaderElection.RetryPeriod.Duration,
+		Port:                    manager.Webhooks.Port,
+	}
+	allowedNamespaces := manager.Namespaces
+	if len(allowedNamespaces) > 0 {
+		options.NewCache = cache.MultiNamespacedCacheBuilder(allowedNamespaces)
+		setupLog.Info("restricting manager to namespaces", "namespaces", allowedNamespaces)
+	}
+	excludedNamespaces := sets.NewString(manager.ExcludedNamespaces...)
+	protectedNamespaces := sets.NewString(manager.ProtectedNamespaces...)
+	if ns := utils.OperatorNamespace(); ns != "" {
+		protectedNamespaces.Insert(ns)
+	}
+	setupLog.Info("protecting namespaces", "namespaces", protectedNamespaces.List())
+
+	mgr, err := ctrl.NewManager(cfg, options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	controllerOptions := controllers.Options{
+		MaxConcurrentReconciles: controller.MaxConcurrentReconciles,
+		RateLimiter: utils.NewRateLimiter(controller.RetryBaseDelay.Duration, controller.RetryMaxDelay.Duration,
+			controller.RetryQPS, controller.RetryBurst),
+	}
+
+	var signer *provenance.Signer
+	if controller.SigningKeyFile != "" {
+		signer, err = provenance.LoadSigner(controller.SigningKeyFile)
+		if err != nil {
+			setupLog.Error(err, "unable to load signing key")
+			os.Exit(1)
+		}
+		setupLog.Info("signing copies", "key", signer.KeyID())
+	}
+
+	var auditWriter audit.Writer
+	if config.Audit.Path != "" {
+		auditWriter, err = audit.Open(config.Audit.Path)
+		if err != nil {
+			setupLog.Error(err, "unable to open audit log")
+			os.Exit(1)
+		}
+	}
+
+	var notifier *notify.Notifier
+	if len(config.Notifications.Sinks) > 0 || len(config.Notifications.AllowedHosts) > 0 {
+		notifier = notify.NewNotifier(ctrl.Log.WithName("notify"), config.Notifications.Sinks, config.Notifications.AllowedHosts,
+			config.Notifications.QueueSize, config.Notifications.Retries)
+		if err := mgr.Add(notifier); err != nil {
+			setupLog.Error(err, "unable to add notifier")
+			os.Exit(1)
+		}
+	}
+
+	var git *sources.GitProvider
+	if len(controller.GitRepositories) > 0 {
+		git = &sources.GitProvider{Directory: controller.GitCacheDirectory, AllowedRepositories: controller.GitRepositories}
+		if git.Directory == "" {
+			git.Directory = filepath.Join(os.TempDir(), "tattletale-git")
+		}
+	}
+
+	// Shared objects with a target namespace pattern are indexed as they are reconciled, their watches map
+	// events through the index instead of listing them
+	sharedConfigMapPatterns := utils.NewSharedConfigMapPatternIndex()
 	sharedConfigMapController, err := (&controllers.SharedConfigMapReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("SharedConfigMap"),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr)
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("SharedConfigMap"),
+		Scheme:   mgr.GetScheme(),
+		Recorder: utils.NewRateLimitedRecorder(mgr.GetEventRecorderFor("sharedconfigmap-controller"), float32(controller.EventQPS), controller.EventBurst),
+
+		AllowedNamespaces:   sets.NewString(allowedNamespaces...),
+		ExcludedNamespaces:  excludedNamespaces,
+		ProtectedNamespaces: protectedNamespaces,
+		Git:                 git,
+		Signer:              signer,
+		Notifier:            notifier,
+		Audit:               auditWriter,
+		Patterns:            sharedConfigMapPatterns,
+	}).SetupWithManager(mgr, controllerOptions)
 	if err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "SharedConfigMap")
 		os.Exit(1)
 	}
 
-	utils.InitSharedConfigMapWatchers(sharedConfigMapController)
+	utils.InitSharedConfigMapWatchers(mgr, sharedConfigMapController, allowedNamespaces, sharedConfigMapPatterns)
 
+	// Sources outside of the cluster are only read from where the operator config allows
+	providers := sources.Providers{
+		// Encrypted sources are read from the namespace of the SharedSecret
+		sources.TypeSOPS: &sources.SOPSProvider{Reader: mgr.GetClient()},
+	}
+	if controller.FileSourceDirectory != "" {
+		providers[sources.TypeFile] = &sources.FileProvider{Directory: controller.FileSourceDirectory}
+	}
+	if len(controller.HTTPSourceHosts) > 0 {
+		providers[sources.TypeHTTP] = sources.NewHTTPProvider(controller.HTTPSourceHosts)
+	}
+	if len(controller.VaultAddresses) > 0 {
+		providers[sources.TypeVault] = sources.NewVaultProvider(mgr.GetClient(), controller.VaultAddresses)
+	}
+
+	sharedSecretPatterns := utils.NewSharedSecretPatternIndex()
 	sharedSecretController, err := (&controllers.SharedSecretReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("SharedSecret"),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr)
+		Client:   mgr.GetClient(),
+		Log:      ctrl.Log.WithName("controllers").WithName("SharedSecret"),
+		Scheme:   mgr.GetScheme(),
+		Recorder: utils.NewRateLimitedRecorder(mgr.GetEventRecorderFor("sharedsecret-controller"), float32(controller.EventQPS), controller.EventBurst),
+
+		AllowedNamespaces:     sets.NewString(allowedNamespaces...),
+		ExcludedNamespaces:    excludedNamespaces,
+		ProtectedNamespaces:   protectedNamespaces,
+		AllowConfigMapTargets: controller.AllowSecretToConfigMap,
+		Providers:             providers,
+		Signer:                signer,
+		Notifier:              notifier,
+		Audit:                 auditWriter,
+		Patterns:              sharedSecretPatterns,
+	}).SetupWithManager(mgr, controllerOptions)
 	if err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "SharedSecret")
 		os.Exit(1)
 	}
 
-	utils.InitSharedSecretWatchers(sharedSecretController)
+	utils.InitSharedSecretWatchers(mgr, sharedSecretController, allowedNamespaces, sharedSecretPatterns)
+
+	sharedResourceReconciler := &controllers.SharedResourceReconciler{
+		Client:     mgr.GetClient(),
+		Log:        ctrl.Log.WithName("controllers").WithName("SharedResource"),
+		Scheme:     mgr.GetScheme(),
+		Recorder:   utils.NewRateLimitedRecorder(mgr.GetEventRecorderFor("sharedresource-controller"), float32(controller.EventQPS), controller.EventBurst),
+		Cache:      mgr.GetCache(),
+		RESTMapper: mgr.GetRESTMapper(),
 
+		AllowedKinds:        sets.NewString(controller.SharedResourceKinds...),
+		AllowedNamespaces:   sets.NewString(allowedNamespaces...),
+		ExcludedNamespaces:  excludedNamespaces,
+		ProtectedNamespaces: protectedNamespaces,
+		Audit:               auditWriter,
+	}
+	sharedResourceController, err := sharedResourceReconciler.SetupWithManager(mgr, controllerOptions)
+	if err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "SharedResource")
+		os.Exit(1)
+	}
+
+	sharedResourceReconciler.Watcher = utils.InitSharedResourceWatchers(mgr, sharedResourceController, allowedNamespaces)
+
+	if manager.Webhooks.Enabled {
+		mgr.GetWebhookServer().CertDir = manager.Webhooks.CertDir
+		// Registers the conversion webhook, v1beta1 is the hub every other version converts through
+		if err := ctrl.NewWebhookManagedBy(mgr).For(&tattletalev1.SharedSecret{}).Complete(); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "SharedSecret")
+			os.Exit(1)
+		}
+		if err := ctrl.NewWebhookManagedBy(mgr).For(&tattletalev1.SharedConfigMap{}).Complete(); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "SharedConfigMap")
+			os.Exit(1)
+		}
+		webhooks.Register(mgr.GetWebhookServer())
+	}
 	// +kubebuilder:scaffold:builder
 
+	// Ready once the caches have synced and the indexes used to map watch events answer
+	warmup := &utils.IndexWarmup{
+		Reader:  mgr.GetCache(),
+		Lists:   []runtime.Object{&tattletalev1beta1.SharedSecretList{}, &tattletalev1beta1.SharedConfigMapList{}, &tattletalev1beta1.SharedResourceList{}},
+		Indexes: []string{utils.SourceIndex, utils.TargetIndex, utils.TargetNamespaceIndex},
+	}
+	if err := mgr.Add(warmup); err != nil {
+		setupLog.Error(err, "unable to add index warm-up")
+		os.Exit(1)
+	}
+
+	probes := utils.NewHealthProbes(manager.HealthAddr)
+	probes.AddHealthCheck("ping", utils.Ping)
+	probes.AddReadyCheck("informers", warmup.Check)
+
+	stop := ctrl.SetupSignalHandler()
+	go func() {
+		if err := probes.Start(stop); err != nil {
+			setupLog.Error(err, "problem serving health probes")
+			os.Exit(1)
+		}
+	}()
+
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	if err := mgr.Start(stop); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
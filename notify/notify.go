@@ -0,0 +1,309 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package notify sends CloudEvents about the outcome of syncs to HTTP sinks
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// The types of the events sent
+const (
+	// Copies of a shared object are about to be written
+	TypeSyncStarted = "dev.tattletale.sync.started"
+	// A copy was created or updated
+	TypeTargetUpdated = "dev.tattletale.target.updated"
+	// A copy couldn't be written
+	TypeTargetFailed = "dev.tattletale.target.failed"
+	// Every copy a sync wrote was written, and every target is synced
+	TypeSynced = "dev.tattletale.sync.completed"
+	// A sync wrote copies, but some targets aren't synced, e.g. their namespace is missing or forbidden
+	TypeSyncPartial = "dev.tattletale.sync.partial"
+)
+
+const specVersion = "1.0"
+
+// Event is a CloudEvent about a shared object
+type Event struct {
+	ID      string
+	Type    string
+	Source  string
+	Subject string
+	Time    time.Time
+	Data    interface{}
+}
+
+// Data is the data of every event
+type Data struct {
+	// The shared object synced
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+
+	// The source data synced
+	SourceHash    string `json:"sourceHash"`
+	SourceVersion string `json:"sourceVersion,omitempty"`
+
+	// The copy of target events
+	Target *Target `json:"target,omitempty"`
+	// Why the copy of a target.failed event couldn't be written
+	Error string `json:"error,omitempty"`
+	// The state of every target of sync.completed events
+	Targets []Target `json:"targets,omitempty"`
+}
+
+// Target is a copy of a shared object
+type Target struct {
+	Namespace string                        `json:"namespace"`
+	Name      string                        `json:"name"`
+	State     tattletalev1beta1.TargetState `json:"state,omitempty"`
+}
+
+// NewEvent returns an event with a random id about a shared object
+func NewEvent(eventType, source, subject string, data interface{}) Event {
+	id := make([]byte, 16)
+	_, _ = io.ReadFull(rand.Reader, id)
+	return Event{ID: hex.EncodeToString(id), Type: eventType, Source: source, Subject: subject, Time: time.Now().UTC(), Data: data}
+}
+
+type delivery struct {
+	sink  tattletalev1beta1.NotificationSink
+	event Event
+}
+
+// Notifier queues events and sends them to their sinks in order. Deliveries failing with a network error,
+// a 429 or a 5xx answer are retried, events are dropped while the queue is full.
+type Notifier struct {
+	Client *http.Client
+	Log    logr.Logger
+	// The sinks of shared objects that don't set their own
+	Sinks []tattletalev1beta1.NotificationSink
+	// Hosts the sinks of shared objects may send to
+	AllowedHosts sets.String
+	// How many times a delivery is retried
+	Retries int
+	// The delay before the first retry, doubled for every further one
+	Backoff time.Duration
+
+	queue chan delivery
+}
+
+// NewNotifier returns a notifier queueing up to queueSize deliveries
+func NewNotifier(log logr.Logger, sinks []tattletalev1beta1.NotificationSink, allowedHosts []string, queueSize, retries int) *Notifier {
+	n := &Notifier{
+		Log:          log,
+		Sinks:        sinks,
+		AllowedHosts: sets.NewString(allowedHosts...),
+		Retries:      retries,
+		Backoff:      time.Second,
+		queue:        make(chan delivery, queueSize),
+	}
+	n.Client = &http.Client{Timeout: 10 * time.Second, CheckRedirect: n.checkRedirect}
+	return n
+}
+
+// redirectNotAllowedError is returned for sinks redirecting to a host events may not be sent to
+type redirectNotAllowedError struct {
+	host string
+}
+
+func (e *redirectNotAllowedError) Error() string {
+	return fmt.Sprintf("redirect to %s is not allowed, it is not a host events may be sent to", e.host)
+}
+
+// checkRedirect only follows redirects to the hosts sinks may send to, so an allowed sink can't forward
+// events to any other host
+func (n *Notifier) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if !n.hostAllowed(req.URL) {
+		return &redirectNotAllowedError{host: req.URL.Host}
+	}
+	return nil
+}
+
+// hostAllowed reports whether events may be sent to u, a host of the allow-list or of the operator's own sinks
+func (n *Notifier) hostAllowed(u *url.URL) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	if n.AllowedHosts.Has(u.Hostname()) {
+		return true
+	}
+	for _, s := range n.Sinks {
+		if sink, err := url.Parse(s.URL); err == nil && sink.Hostname() == u.Hostname() {
+			return true
+		}
+	}
+	return false
+}
+
+// SinksFor returns the sinks events about a shared object are sent to, and the sinks it sets that it may not use
+func (n *Notifier) SinksFor(notifications *tattletalev1beta1.Notifications) (sinks, forbidden []tattletalev1beta1.NotificationSink) {
+	if notifications == nil || len(notifications.Sinks) == 0 {
+		return n.Sinks, nil
+	}
+	for _, s := range notifications.Sinks {
+		u, err := url.Parse(s.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !n.AllowedHosts.Has(u.Hostname()) {
+			forbidden = append(forbidden, s)
+			continue
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, forbidden
+}
+
+// Send queues the event for every sink without blocking
+func (n *Notifier) Send(sinks []tattletalev1beta1.NotificationSink, event Event) {
+	for _, s := range sinks {
+		select {
+		case n.queue <- delivery{sink: s, event: event}:
+		default:
+			n.Log.Info("notification queue is full. dropping event", "type", event.Type, "subject", event.Subject, "sink", s.URL)
+		}
+	}
+}
+
+// Start sends queued events until stop is closed
+func (n *Notifier) Start(stop <-chan struct{}) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case d := <-n.queue:
+			if err := n.deliver(ctx, d); err != nil {
+				n.Log.Error(err, "unable to send event", "type", d.event.Type, "subject", d.event.Subject, "sink", d.sink.URL)
+			}
+		}
+	}
+}
+
+// deliver sends an event, retrying with an exponential backoff
+func (n *Notifier) deliver(ctx context.Context, d delivery) error {
+	backoff := n.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := n.post(ctx, d)
+		if err == nil || !retry || attempt >= n.Retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post sends an event once and reports whether a failure is worth retrying
+func (n *Notifier) post(ctx context.Context, d delivery) (bool, error) {
+	req, err := newRequest(d.sink, d.event)
+	if err != nil {
+		return false, err
+	}
+	resp, err := n.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		// Refused redirects are refused again on every retry
+		if urlErr, ok := err.(*url.Error); ok {
+			if _, ok := urlErr.Err.(*redirectNotAllowedError); ok {
+				return false, err
+			}
+		}
+		return true, err
+	}
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("sink answered %s", resp.Status)
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+// newRequest encodes an event in the mode of the sink
+func newRequest(sink tattletalev1beta1.NotificationSink, event Event) (*http.Request, error) {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return nil, err
+	}
+	timestamp := event.Time.Format(time.RFC3339Nano)
+
+	if sink.Mode == tattletalev1beta1.CloudEventsModeStructured {
+		structured := map[string]interface{}{
+			"specversion":     specVersion,
+			"id":              event.ID,
+			"type":            event.Type,
+			"source":          event.Source,
+			"time":            timestamp,
+			"datacontenttype": "application/json",
+			"data":            json.RawMessage(data),
+		}
+		if event.Subject != "" {
+			structured["subject"] = event.Subject
+		}
+		body, err := json.Marshal(structured)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequest(http.MethodPost, sink.URL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/cloudevents+json")
+		return req, nil
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sink.URL, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Ce-Specversion", specVersion)
+	req.Header.Set("Ce-Id", event.ID)
+	req.Header.Set("Ce-Type", event.Type)
+	req.Header.Set("Ce-Source", event.Source)
+	req.Header.Set("Ce-Time", timestamp)
+	if event.Subject != "" {
+		req.Header.Set("Ce-Subject", event.Subject)
+	}
+	return req, nil
+}
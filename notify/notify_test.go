@@ -0,0 +1,257 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// receiver records the requests it is sent and answers with the queued status codes, then 204. It redirects
+// every request to location when set.
+type receiver struct {
+	sync.Mutex
+	statuses []int
+	location string
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	r.Lock()
+	defer r.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	status := http.StatusNoContent
+	if r.location != "" {
+		w.Header().Set("Location", r.location)
+		status = http.StatusTemporaryRedirect
+	} else if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (r *receiver) count() int {
+	r.Lock()
+	defer r.Unlock()
+	return len(r.requests)
+}
+
+// waitFor fails the test unless the receiver got exactly n requests within a second, and no more over the
+// next 50ms
+func (r *receiver) waitFor(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for r.count() < n && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := r.count(); got != n {
+		t.Fatalf("received %d requests, want %d", got, n)
+	}
+}
+
+type notifierTest struct {
+	recv     *receiver
+	notifier *Notifier
+	sinks    []tattletalev1beta1.NotificationSink
+	event    Event
+}
+
+// newNotifierTest returns a notifier sending to a test receiver, along with funcs starting it and stopping
+// the test
+func newNotifierTest(t *testing.T) (*notifierTest, func(), func()) {
+	recv := &receiver{}
+	server := httptest.NewServer(recv)
+	sinks := []tattletalev1beta1.NotificationSink{{URL: server.URL}}
+	notifier := NewNotifier(ctrl.Log, sinks, []string{"127.0.0.1"}, 10, 2)
+	notifier.Backoff = time.Millisecond
+	event := NewEvent(TypeTargetUpdated, "/apis/tattletale.tattletale.dev/v1beta1/namespaces/default/sharedsecrets/db", "team-a/db",
+		Data{Kind: "SharedSecret", Namespace: "default", Name: "db", SourceHash: "abc", Target: &Target{Namespace: "team-a", Name: "db"}})
+
+	stop := make(chan struct{})
+	start := func() {
+		go func() {
+			if err := notifier.Start(stop); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	cleanup := func() {
+		close(stop)
+		server.Close()
+	}
+	return &notifierTest{recv: recv, notifier: notifier, sinks: sinks, event: event}, start, cleanup
+}
+
+func TestNotifierBinary(t *testing.T) {
+	nt, start, cleanup := newNotifierTest(t)
+	defer cleanup()
+	start()
+	nt.notifier.Send(nt.sinks, nt.event)
+	nt.recv.waitFor(t, 1)
+
+	req := nt.recv.requests[0]
+	if req.Method != http.MethodPost {
+		t.Errorf("method = %s, want POST", req.Method)
+	}
+	headers := map[string]string{
+		"Content-Type":   "application/json",
+		"Ce-Specversion": "1.0",
+		"Ce-Id":          nt.event.ID,
+		"Ce-Type":        TypeTargetUpdated,
+		"Ce-Subject":     "team-a/db",
+	}
+	for header, want := range headers {
+		if got := req.Header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	var got, want interface{}
+	if err := json.Unmarshal(nt.recv.bodies[0], &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(`{"kind":"SharedSecret","namespace":"default","name":"db","sourceHash":"abc","target":{"namespace":"team-a","name":"db"}}`), &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("body = %s, want %v", nt.recv.bodies[0], want)
+	}
+}
+
+func TestNotifierStructured(t *testing.T) {
+	nt, start, cleanup := newNotifierTest(t)
+	defer cleanup()
+	start()
+	nt.sinks[0].Mode = tattletalev1beta1.CloudEventsModeStructured
+	nt.notifier.Send(nt.sinks, nt.event)
+	nt.recv.waitFor(t, 1)
+
+	if got := nt.recv.requests[0].Header.Get("Content-Type"); got != "application/cloudevents+json" {
+		t.Errorf("Content-Type = %q, want application/cloudevents+json", got)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(nt.recv.bodies[0], &body); err != nil {
+		t.Fatal(err)
+	}
+	attributes := map[string]interface{}{
+		"specversion": "1.0",
+		"type":        TypeTargetUpdated,
+		"source":      nt.event.Source,
+		"subject":     "team-a/db",
+	}
+	for attribute, want := range attributes {
+		if body[attribute] != want {
+			t.Errorf("%s = %v, want %v", attribute, body[attribute], want)
+		}
+	}
+	if data, _ := body["data"].(map[string]interface{}); data["sourceHash"] != "abc" {
+		t.Errorf("data = %v, want the source hash", body["data"])
+	}
+}
+
+func TestNotifierRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		want     int
+	}{
+		{name: "server errors", statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}, want: 3},
+		{name: "client errors", statuses: []int{http.StatusBadRequest}, want: 1},
+		{name: "giving up after the retries", statuses: []int{500, 500, 500, 500}, want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nt, start, cleanup := newNotifierTest(t)
+			defer cleanup()
+			start()
+			nt.recv.statuses = tt.statuses
+			nt.notifier.Send(nt.sinks, nt.event)
+			nt.recv.waitFor(t, tt.want)
+		})
+	}
+}
+
+func TestNotifierRedirect(t *testing.T) {
+	nt, start, cleanup := newNotifierTest(t)
+	defer cleanup()
+	// A sink of the allowed host 127.0.0.1 redirecting to localhost, a host events may not be sent to
+	redirects := &receiver{location: strings.Replace(nt.sinks[0].URL, "127.0.0.1", "localhost", 1)}
+	server := httptest.NewServer(redirects)
+	defer server.Close()
+	start()
+
+	// The redirect is refused once, without retries
+	nt.notifier.Send([]tattletalev1beta1.NotificationSink{{URL: server.URL}}, nt.event)
+	redirects.waitFor(t, 1)
+	nt.recv.waitFor(t, 0)
+}
+
+func TestNotifierQueueFull(t *testing.T) {
+	nt, start, cleanup := newNotifierTest(t)
+	defer cleanup()
+	for i := 0; i < 15; i++ {
+		nt.notifier.Send(nt.sinks, nt.event)
+	}
+	start()
+	nt.recv.waitFor(t, 10)
+}
+
+func TestNotifierSinksFor(t *testing.T) {
+	nt, _, cleanup := newNotifierTest(t)
+	defer cleanup()
+	own := tattletalev1beta1.NotificationSink{URL: "http://127.0.0.1:8080/events", Mode: tattletalev1beta1.CloudEventsModeStructured}
+	other := tattletalev1beta1.NotificationSink{URL: "http://internal.example.com/events"}
+
+	tests := []struct {
+		name          string
+		notifications *tattletalev1beta1.Notifications
+		want          []tattletalev1beta1.NotificationSink
+		wantForbidden []tattletalev1beta1.NotificationSink
+	}{
+		{name: "operator sinks", want: nt.sinks},
+		{
+			name:          "sinks of the shared object",
+			notifications: &tattletalev1beta1.Notifications{Sinks: []tattletalev1beta1.NotificationSink{own, other}},
+			want:          []tattletalev1beta1.NotificationSink{own},
+			wantForbidden: []tattletalev1beta1.NotificationSink{other},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sinks, forbidden := nt.notifier.SinksFor(tt.notifications)
+			if !reflect.DeepEqual(sinks, tt.want) {
+				t.Errorf("sinks = %v, want %v", sinks, tt.want)
+			}
+			if len(forbidden) != len(tt.wantForbidden) || (len(forbidden) > 0 && !reflect.DeepEqual(forbidden, tt.wantForbidden)) {
+				t.Errorf("forbidden = %v, want %v", forbidden, tt.wantForbidden)
+			}
+		})
+	}
+}
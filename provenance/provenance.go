@@ -0,0 +1,260 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package provenance signs the copies written by tattletale and verifies their signatures, so consumers
+// can tell a copy written by the operator from one planted by anybody else with write access to its namespace.
+package provenance
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	"golang.org/x/crypto/ed25519"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// The first field of every signed message, changed whenever the message does
+const messageVersion = "tattletale.dev/provenance/v1"
+
+var (
+	// ErrUnsigned is returned for copies without a signature
+	ErrUnsigned = errors.New("object is not signed")
+	// ErrUnknownKey is returned for copies signed with none of the keys given
+	ErrUnknownKey = errors.New("object is signed with an unknown key")
+	// ErrInvalidSignature is returned for copies whose signature doesn't match their content
+	ErrInvalidSignature = errors.New("signature does not match the object")
+)
+
+// Provenance is what a valid signature vouches for
+type Provenance struct {
+	// The shared object that wrote the copy, as Kind/namespace/name
+	SharedBy string
+	// The source the copy was written from
+	Source string
+	// The hash of the source data recorded on the copy
+	SourceHash string
+	// The version of the source recorded on the copy, if any
+	SourceVersion string
+	// The id of the key the copy is signed with
+	KeyID string
+}
+
+// SharedBy formats the reference to a shared object recorded on its copies
+func SharedBy(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// Signer signs copies with an ed25519 private key held by the operator
+type Signer struct {
+	key ed25519.PrivateKey
+	id  string
+}
+
+// NewSigner returns a signer for the private key
+func NewSigner(key ed25519.PrivateKey) *Signer {
+	return &Signer{key: key, id: KeyID(key.Public().(ed25519.PublicKey))}
+}
+
+// LoadSigner reads a base64 encoded ed25519 private key, or its 32 byte seed, from a file
+func LoadSigner(path string) (*Signer, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParsePrivateKey(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return NewSigner(key), nil
+}
+
+// KeyID returns the id of the signer's key, recorded on every copy it signs
+func (s *Signer) KeyID() string {
+	return s.id
+}
+
+// PublicKey returns the key signatures are verified with
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// SignSecret records the shared object and source on the secret and signs it. The secret's data and
+// annotations must be final.
+func (s *Signer) SignSecret(secret *corev1.Secret, sharedBy, source string) {
+	s.sign(&secret.ObjectMeta.Annotations, "Secret", secret.Namespace, secret.Name, sharedBy, source, secret.Data, nil)
+}
+
+// SignConfigMap records the shared object and source on the configmap and signs it. The configmap's data
+// and annotations must be final.
+func (s *Signer) SignConfigMap(configmap *corev1.ConfigMap, sharedBy, source string) {
+	s.sign(&configmap.ObjectMeta.Annotations, "ConfigMap", configmap.Namespace, configmap.Name, sharedBy, source, stringData(configmap.Data), configmap.BinaryData)
+}
+
+func (s *Signer) sign(annotations *map[string]string, kind, namespace, name, sharedBy, source string, data, binaryData map[string][]byte) {
+	if *annotations == nil {
+		*annotations = map[string]string{}
+	}
+	a := *annotations
+	a[tattletalev1beta1.SharedByAnnotation] = sharedBy
+	a[tattletalev1beta1.SourceAnnotation] = source
+	a[tattletalev1beta1.SigningKeyAnnotation] = s.id
+	signature := ed25519.Sign(s.key, message(kind, namespace, name, a, data, binaryData))
+	a[tattletalev1beta1.SignatureAnnotation] = base64.StdEncoding.EncodeToString(signature)
+}
+
+// Unsign removes the provenance annotations, for copies written without a signing key
+func Unsign(annotations map[string]string) {
+	delete(annotations, tattletalev1beta1.SharedByAnnotation)
+	delete(annotations, tattletalev1beta1.SourceAnnotation)
+	delete(annotations, tattletalev1beta1.SigningKeyAnnotation)
+	delete(annotations, tattletalev1beta1.SignatureAnnotation)
+}
+
+// VerifySecret checks that the secret is signed with one of the keys and was not changed since
+func VerifySecret(secret *corev1.Secret, keys ...ed25519.PublicKey) (*Provenance, error) {
+	return verify(secret.Annotations, "Secret", secret.Namespace, secret.Name, secret.Data, nil, keys)
+}
+
+// VerifyConfigMap checks that the configmap is signed with one of the keys and was not changed since
+func VerifyConfigMap(configmap *corev1.ConfigMap, keys ...ed25519.PublicKey) (*Provenance, error) {
+	return verify(configmap.Annotations, "ConfigMap", configmap.Namespace, configmap.Name, stringData(configmap.Data), configmap.BinaryData, keys)
+}
+
+func verify(annotations map[string]string, kind, namespace, name string, data, binaryData map[string][]byte, keys []ed25519.PublicKey) (*Provenance, error) {
+	encoded, ok := annotations[tattletalev1beta1.SignatureAnnotation]
+	if !ok {
+		return nil, ErrUnsigned
+	}
+	signature, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return nil, ErrInvalidSignature
+	}
+	id := annotations[tattletalev1beta1.SigningKeyAnnotation]
+	for _, key := range keys {
+		if KeyID(key) != id {
+			continue
+		}
+		if !ed25519.Verify(key, message(kind, namespace, name, annotations, data, binaryData), signature) {
+			return nil, ErrInvalidSignature
+		}
+		return &Provenance{
+			SharedBy:      annotations[tattletalev1beta1.SharedByAnnotation],
+			Source:        annotations[tattletalev1beta1.SourceAnnotation],
+			SourceHash:    annotations[tattletalev1beta1.SourceHashAnnotation],
+			SourceVersion: annotations[tattletalev1beta1.SourceVersionAnnotation],
+			KeyID:         id,
+		}, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// message is what gets signed: the identity of the copy, its provenance annotations and a digest of its
+// data. Every field is length prefixed so no two copies share a message.
+func message(kind, namespace, name string, annotations map[string]string, data, binaryData map[string][]byte) []byte {
+	var b []byte
+	field := func(s string) {
+		b = appendBytes(b, []byte(s))
+	}
+	field(messageVersion)
+	field(kind)
+	field(namespace)
+	field(name)
+	field(annotations[tattletalev1beta1.SharedByAnnotation])
+	field(annotations[tattletalev1beta1.SourceAnnotation])
+	field(annotations[tattletalev1beta1.SourceHashAnnotation])
+	field(annotations[tattletalev1beta1.SourceVersionAnnotation])
+	field(annotations[tattletalev1beta1.SigningKeyAnnotation])
+	field(digest(data, binaryData))
+	return b
+}
+
+// digest hashes the data and binary data of a copy
+func digest(maps ...map[string][]byte) string {
+	h := sha256.New()
+	for _, m := range maps {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var b []byte
+		b = appendUvarint(b, uint64(len(keys)))
+		for _, k := range keys {
+			b = appendBytes(b, []byte(k))
+			b = appendBytes(b, m[k])
+		}
+		h.Write(b)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func appendBytes(b, s []byte) []byte {
+	return append(appendUvarint(b, uint64(len(s))), s...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var n [binary.MaxVarintLen64]byte
+	return append(b, n[:binary.PutUvarint(n[:], v)]...)
+}
+
+func stringData(data map[string]string) map[string][]byte {
+	m := make(map[string][]byte, len(data))
+	for k, v := range data {
+		m[k] = []byte(v)
+	}
+	return m
+}
+
+// KeyID identifies a public key, so copies can be verified while keys are rotated
+func KeyID(key ed25519.PublicKey) string {
+	h := sha256.Sum256(key)
+	return hex.EncodeToString(h[:8])
+}
+
+// ParsePublicKey decodes a base64 encoded ed25519 public key
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("public key is not valid base64: %v", err)
+	}
+	if len(b) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key is %d bytes long, not %d", len(b), ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// ParsePrivateKey decodes a base64 encoded ed25519 private key, or its seed
+func ParsePrivateKey(s string) (ed25519.PrivateKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("private key is not valid base64: %v", err)
+	}
+	switch len(b) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(b), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.NewKeyFromSeed(b[:ed25519.SeedSize]), nil
+	}
+	return nil, fmt.Errorf("private key is %d bytes long, not %d or %d", len(b), ed25519.SeedSize, ed25519.PrivateKeySize)
+}
@@ -0,0 +1,198 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provenance
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	"golang.org/x/crypto/ed25519"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newSigner(t *testing.T) *Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSigner(key)
+}
+
+// newSignedSecret returns a new signer along with a secret it signed
+func newSignedSecret(t *testing.T) (*Signer, *corev1.Secret) {
+	signer := newSigner(t)
+	return signer, signedSecret(signer)
+}
+
+func signedSecret(signer *Signer) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "team-a",
+			Name:        "db",
+			Annotations: map[string]string{tattletalev1beta1.SourceHashAnnotation: "abc"},
+		},
+		Data: map[string][]byte{"password": []byte("hunter2")},
+	}
+	signer.SignSecret(secret, SharedBy("SharedSecret", "default", "db"), "secret:default/db")
+	return secret
+}
+
+func TestVerifySecret(t *testing.T) {
+	signer, secret := newSignedSecret(t)
+	p, err := VerifySecret(secret, signer.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Provenance{
+		SharedBy:   "SharedSecret/default/db",
+		Source:     "secret:default/db",
+		SourceHash: "abc",
+		KeyID:      signer.KeyID(),
+	}
+	if *p != want {
+		t.Errorf("provenance = %+v, want %+v", *p, want)
+	}
+}
+
+func TestVerifySecretRejected(t *testing.T) {
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(secret *corev1.Secret)
+		// The key to verify with instead of the signer's
+		key  ed25519.PublicKey
+		want error
+	}{
+		{
+			name:   "changed data",
+			change: func(secret *corev1.Secret) { secret.Data["password"] = []byte("hunter3") },
+			want:   ErrInvalidSignature,
+		},
+		{
+			name:   "changed source",
+			change: func(secret *corev1.Secret) { secret.Annotations[tattletalev1beta1.SourceAnnotation] = "secret:default/other" },
+			want:   ErrInvalidSignature,
+		},
+		{
+			name:   "moved to another namespace",
+			change: func(secret *corev1.Secret) { secret.Namespace = "team-b" },
+			want:   ErrInvalidSignature,
+		},
+		{
+			name: "unknown key",
+			key:  other,
+			want: ErrUnknownKey,
+		},
+		{
+			name: "unsigned",
+			change: func(secret *corev1.Secret) {
+				Unsign(secret.Annotations)
+				if len(secret.Annotations) != 1 {
+					t.Errorf("annotations = %v, want only the source hash", secret.Annotations)
+				}
+			},
+			want: ErrUnsigned,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, secret := newSignedSecret(t)
+			if tt.change != nil {
+				tt.change(secret)
+			}
+			key := signer.PublicKey()
+			if tt.key != nil {
+				key = tt.key
+			}
+			if _, err := VerifySecret(secret, key); err != tt.want {
+				t.Errorf("VerifySecret() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyConfigMap(t *testing.T) {
+	signer := newSigner(t)
+	secret := signedSecret(signer)
+	signed := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "app"},
+		Data:       map[string]string{"a": "1"},
+	}
+	signer.SignConfigMap(signed, SharedBy("SharedConfigMap", "default", "app"), "git:https://example.com/config@main")
+
+	tests := []struct {
+		name      string
+		configmap *corev1.ConfigMap
+		want      error
+	}{
+		{name: "signed", configmap: signed},
+		{
+			// Data and binary data are told apart
+			name:      "data moved to binary data",
+			configmap: &corev1.ConfigMap{ObjectMeta: signed.ObjectMeta, BinaryData: map[string][]byte{"a": []byte("1")}},
+			want:      ErrInvalidSignature,
+		},
+		{
+			name:      "copy of a secret",
+			configmap: &corev1.ConfigMap{ObjectMeta: secret.ObjectMeta, Data: map[string]string{"password": "hunter2"}},
+			want:      ErrInvalidSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := VerifyConfigMap(tt.configmap, signer.PublicKey()); err != tt.want {
+				t.Errorf("VerifyConfigMap() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr bool
+	}{
+		{name: "private key", encoded: base64.StdEncoding.EncodeToString(key) + "\n"},
+		{name: "seed", encoded: base64.StdEncoding.EncodeToString(key.Seed()) + "\n"},
+		{name: "too short", encoded: "c2hvcnQ=", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParsePrivateKey(tt.encoded)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePrivateKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(parsed, key) {
+				t.Error("ParsePrivateKey() returned another key")
+			}
+		})
+	}
+}
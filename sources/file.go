@@ -0,0 +1,73 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sources
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+)
+
+// FileProvider reads sources from files below a directory, usually secrets or configmaps mounted into the operator pod
+type FileProvider struct {
+	// Paths of sources are relative to Directory and can't leave it
+	Directory string
+}
+
+func (p *FileProvider) Fetch(ctx context.Context, namespace string, source *tattletalev1beta1.SecretSource) (*Data, error) {
+	// Cleaning the path as an absolute one drops any leading ..
+	path := filepath.Join(p.Directory, filepath.Clean("/"+source.File.Path))
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		values, err := decodeValues(b)
+		if err != nil {
+			return nil, err
+		}
+		return &Data{Values: values}, nil
+	}
+
+	// A directory is read like a mounted secret, one key per file
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string][]byte{}
+	for _, f := range files {
+		// Mounted volumes keep their data in hidden directories
+		if strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(path, f.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %v", f.Name(), err)
+		}
+		data[f.Name()] = b
+	}
+	return &Data{Values: data}, nil
+}
@@ -0,0 +1,119 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sources
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+)
+
+func TestFileProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tattletale-sources")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	provider := &FileProvider{Directory: filepath.Join(dir, "sources")}
+
+	if err := os.MkdirAll(filepath.Join(dir, "sources", "mounted", "..data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join("sources", "app.json"):         `{"user":"admin","password":"hunter2"}`,
+		filepath.Join("sources", "mounted", "token"): "abc",
+		filepath.Join("sources", "invalid.json"):     `{"port":8080}`,
+		"outside.json":                               `{"user":"root"}`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want map[string][]byte
+		// Checks the error, when one is expected
+		wantErr func(err error) bool
+	}{
+		{
+			name: "JSON object of string values",
+			path: "app.json",
+			want: map[string][]byte{"user": []byte("admin"), "password": []byte("hunter2")},
+		},
+		{
+			// One key per file, skipping hidden files
+			name: "directory",
+			path: "mounted",
+			want: map[string][]byte{"token": []byte("abc")},
+		},
+		{name: "values that aren't strings", path: "invalid.json", wantErr: IsInvalid},
+		{name: "outside of the directory", path: "../outside.json", wantErr: os.IsNotExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := provider.Fetch(context.Background(), "default", &tattletalev1beta1.SecretSource{File: &tattletalev1beta1.FileSource{Path: tt.path}})
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Errorf("Fetch() error = %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(data.Values, tt.want) {
+				t.Errorf("values = %q, want %q", data.Values, tt.want)
+			}
+		})
+	}
+}
+
+func TestProviders(t *testing.T) {
+	providers := Providers{TypeFile: &FileProvider{Directory: "/nonexistent"}}
+
+	tests := []struct {
+		name    string
+		source  *tattletalev1beta1.SecretSource
+		wantErr func(err error) bool
+	}{
+		{
+			name:    "type not enabled",
+			source:  &tattletalev1beta1.SecretSource{HTTP: &tattletalev1beta1.HTTPSource{URL: "https://example.com"}},
+			wantErr: IsForbidden,
+		},
+		{name: "no provider", source: &tattletalev1beta1.SecretSource{}, wantErr: IsInvalid},
+		{
+			name:    "several providers",
+			source:  &tattletalev1beta1.SecretSource{File: &tattletalev1beta1.FileSource{}, HTTP: &tattletalev1beta1.HTTPSource{}},
+			wantErr: IsInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := providers.Fetch(context.Background(), "default", tt.source); !tt.wantErr(err) {
+				t.Errorf("Fetch() error = %v", err)
+			}
+		})
+	}
+}
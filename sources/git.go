@@ -0,0 +1,145 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sources
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// GitProvider reads files of Git repositories with the git binary. Every repository is mirrored once
+// below Directory and only fetched again afterwards.
+type GitProvider struct {
+	// Where repositories are mirrored
+	Directory string
+	// URL prefixes of the repositories sources may be read from, e.g. https://github.com/acme/
+	AllowedRepositories []string
+
+	// git isn't safe to run concurrently on the same repository
+	sync.Mutex
+}
+
+// GitDescription returns a short description of a Git source for logs and CLI output
+func GitDescription(source *tattletalev1beta1.GitSource) string {
+	ref := source.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	return "git:" + source.URL + "@" + ref
+}
+
+// Fetch reads the files of the repository matching the path of the source. The version of the data is the
+// commit read.
+func (p *GitProvider) Fetch(ctx context.Context, source *tattletalev1beta1.GitSource) (*Data, error) {
+	if !p.allowed(source.URL) {
+		return nil, &ForbiddenError{fmt.Sprintf("repository %s is not one the operator may read from", source.URL)}
+	}
+	ref := source.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	// Refs and URLs starting with a dash would be read as options by git
+	if strings.HasPrefix(ref, "-") || strings.HasPrefix(source.URL, "-") {
+		return nil, &InvalidError{"URL and ref of a Git source can't start with -"}
+	}
+	pattern := source.Path
+	if pattern == "" {
+		pattern = "*"
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, &InvalidError{fmt.Sprintf("invalid path glob %s: %v", pattern, err)}
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	sum := sha256.Sum256([]byte(source.URL))
+	mirror := filepath.Join(p.Directory, hex.EncodeToString(sum[:8]))
+	if _, err := os.Stat(mirror); os.IsNotExist(err) {
+		if _, err := p.git(ctx, "", "clone", "--mirror", "--quiet", "--", source.URL, mirror); err != nil {
+			os.RemoveAll(mirror)
+			return nil, err
+		}
+	} else if _, err := p.git(ctx, mirror, "fetch", "--prune", "--quiet", "origin"); err != nil {
+		return nil, err
+	}
+
+	commit, err := p.git(ctx, mirror, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return nil, &NotFoundError{fmt.Sprintf("ref %s does not exist in repository %s", ref, source.URL)}
+	}
+	commit = strings.TrimSpace(commit)
+
+	files, err := p.git(ctx, mirror, "ls-tree", "-r", "-z", "--name-only", commit)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string][]byte{}
+	for _, file := range strings.Split(files, "\x00") {
+		if matched, _ := path.Match(pattern, file); !matched || file == "" {
+			continue
+		}
+		key := path.Base(file)
+		if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+			return nil, &InvalidError{fmt.Sprintf("file %s can't be a configmap key: %s", file, strings.Join(errs, ", "))}
+		}
+		if _, ok := values[key]; ok {
+			return nil, &InvalidError{fmt.Sprintf("more than one file matching %s is named %s", pattern, key)}
+		}
+		content, err := p.git(ctx, mirror, "cat-file", "blob", commit+":"+file)
+		if err != nil {
+			return nil, err
+		}
+		values[key] = []byte(content)
+	}
+	return &Data{Values: values, Version: commit}, nil
+}
+
+func (p *GitProvider) allowed(url string) bool {
+	for _, prefix := range p.AllowedRepositories {
+		if strings.HasPrefix(url, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// git runs a git command in dir and returns its output
+func (p *GitProvider) git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	// Never wait for credentials on a terminal that isn't there
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
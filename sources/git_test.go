@@ -0,0 +1,173 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sources
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+)
+
+// gitRepo is a bare repository along with a clone commits are pushed from
+type gitRepo struct {
+	t            *testing.T
+	remote, work string
+}
+
+// newGitRepo returns a repository in dir, and skips the test when git isn't installed
+func newGitRepo(t *testing.T, dir string) *gitRepo {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	r := &gitRepo{t: t, remote: filepath.Join(dir, "remote.git"), work: filepath.Join(dir, "work")}
+	r.git(dir, "init", "--quiet", "--bare", r.remote)
+	r.git(dir, "init", "--quiet", r.work)
+	r.git(r.work, "remote", "add", "origin", r.remote)
+	return r
+}
+
+func (r *gitRepo) git(dir string, args ...string) string {
+	r.t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=tattletale", "GIT_AUTHOR_EMAIL=tattletale@example.com",
+		"GIT_COMMITTER_NAME=tattletale", "GIT_COMMITTER_EMAIL=tattletale@example.com")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		r.t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commit pushes the files to main and returns the commit
+func (r *gitRepo) commit(files map[string]string) string {
+	r.t.Helper()
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(r.work, name)), 0755); err != nil {
+			r.t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(r.work, name), []byte(content), 0644); err != nil {
+			r.t.Fatal(err)
+		}
+	}
+	r.git(r.work, "add", "-A")
+	r.git(r.work, "commit", "--quiet", "-m", "update")
+	r.git(r.work, "push", "--quiet", "origin", "HEAD:refs/heads/main")
+	return r.git(r.work, "rev-parse", "HEAD")
+}
+
+func (r *gitRepo) source(ref, path string) *tattletalev1beta1.GitSource {
+	return &tattletalev1beta1.GitSource{URL: "file://" + r.remote, Ref: ref, Path: path}
+}
+
+func TestGitProvider(t *testing.T) {
+	tests := []struct {
+		name string
+		// Commits to the repository and returns the source to fetch, along with the commit expected
+		setup   func(r *gitRepo, provider *GitProvider) (*tattletalev1beta1.GitSource, string)
+		want    map[string][]byte
+		wantErr func(err error) bool
+	}{
+		{
+			name: "files matching the path",
+			setup: func(r *gitRepo, _ *GitProvider) (*tattletalev1beta1.GitSource, string) {
+				sha := r.commit(map[string]string{"config/app.yaml": "replicas: 2", "config/db.yaml": "port: 5432", "README.md": "docs"})
+				return r.source("main", "config/*.yaml"), sha
+			},
+			want: map[string][]byte{"app.yaml": []byte("replicas: 2"), "db.yaml": []byte("port: 5432")},
+		},
+		{
+			name: "new commits",
+			setup: func(r *gitRepo, provider *GitProvider) (*tattletalev1beta1.GitSource, string) {
+				r.commit(map[string]string{"app.yaml": "replicas: 2"})
+				if _, err := provider.Fetch(context.Background(), r.source("main", "")); err != nil {
+					r.t.Fatal(err)
+				}
+				return r.source("main", ""), r.commit(map[string]string{"app.yaml": "replicas: 3"})
+			},
+			want: map[string][]byte{"app.yaml": []byte("replicas: 3")},
+		},
+		{
+			name: "commit given as ref",
+			setup: func(r *gitRepo, _ *GitProvider) (*tattletalev1beta1.GitSource, string) {
+				first := r.commit(map[string]string{"app.yaml": "replicas: 2"})
+				r.commit(map[string]string{"app.yaml": "replicas: 3"})
+				return r.source(first, ""), first
+			},
+			want: map[string][]byte{"app.yaml": []byte("replicas: 2")},
+		},
+		{
+			name: "missing ref",
+			setup: func(r *gitRepo, _ *GitProvider) (*tattletalev1beta1.GitSource, string) {
+				r.commit(map[string]string{"app.yaml": "replicas: 2"})
+				return r.source("release", ""), ""
+			},
+			wantErr: IsNotFound,
+		},
+		{
+			name: "files sharing a name",
+			setup: func(r *gitRepo, _ *GitProvider) (*tattletalev1beta1.GitSource, string) {
+				r.commit(map[string]string{"a/app.yaml": "a", "b/app.yaml": "b"})
+				return r.source("main", "*/app.yaml"), ""
+			},
+			wantErr: IsInvalid,
+		},
+		{
+			name: "repository not allowed",
+			setup: func(*gitRepo, *GitProvider) (*tattletalev1beta1.GitSource, string) {
+				return &tattletalev1beta1.GitSource{URL: "https://github.com/acme/config"}, ""
+			},
+			wantErr: IsForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "tattletale-git")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			r := newGitRepo(t, dir)
+			provider := &GitProvider{Directory: filepath.Join(dir, "cache"), AllowedRepositories: []string{"file://" + dir + "/"}}
+
+			source, sha := tt.setup(r, provider)
+			data, err := provider.Fetch(context.Background(), source)
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Errorf("Fetch() error = %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(data.Values, tt.want) {
+				t.Errorf("values = %q, want %q", data.Values, tt.want)
+			}
+			if data.Version != sha {
+				t.Errorf("version = %q, want %q", data.Version, sha)
+			}
+		})
+	}
+}
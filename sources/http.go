@@ -0,0 +1,153 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// The largest response read, a secret can't hold more than 1MiB anyway
+const maxResponseSize = 1 << 20
+
+// HTTPProvider reads sources from HTTP(S) endpoints. Responses are kept with their ETag so unchanged
+// endpoints are not downloaded again.
+type HTTPProvider struct {
+	Client *http.Client
+	// Hosts sources may be read from
+	AllowedHosts sets.String
+
+	cache map[string]cachedResponse
+	sync.Mutex
+}
+
+type cachedResponse struct {
+	etag string
+	data *Data
+}
+
+// NewHTTPProvider returns a provider reading from the given hosts
+func NewHTTPProvider(allowedHosts []string) *HTTPProvider {
+	p := &HTTPProvider{
+		AllowedHosts: sets.NewString(allowedHosts...),
+		cache:        map[string]cachedResponse{},
+	}
+	p.Client = &http.Client{
+		Timeout: 30 * time.Second,
+		CheckRedirect: checkRedirect(func(u *url.URL) bool {
+			return (u.Scheme == "http" || u.Scheme == "https") && p.AllowedHosts.Has(u.Hostname())
+		}),
+	}
+	return p
+}
+
+// checkRedirect returns a CheckRedirect func only following redirects to the URLs allowed accepts, so
+// an allowed server can't send the operator to one that isn't
+func checkRedirect(allowed func(u *url.URL) bool) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if !allowed(req.URL) {
+			return &ForbiddenError{fmt.Sprintf("redirect to %s is not allowed, %s is not one the operator may read from", req.URL, req.URL.Host)}
+		}
+		return nil
+	}
+}
+
+// redirectError returns the ForbiddenError a redirect was refused with, or err as it is
+func redirectError(err error) error {
+	if urlErr, ok := err.(*url.Error); ok {
+		if forbidden, ok := urlErr.Err.(*ForbiddenError); ok {
+			return forbidden
+		}
+	}
+	return err
+}
+
+func (p *HTTPProvider) Fetch(ctx context.Context, namespace string, source *tattletalev1beta1.SecretSource) (*Data, error) {
+	u, err := url.Parse(source.HTTP.URL)
+	if err != nil {
+		return nil, &InvalidError{fmt.Sprintf("invalid URL: %v", err)}
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, &InvalidError{fmt.Sprintf("URL scheme must be http or https, not %q", u.Scheme)}
+	}
+	if !p.AllowedHosts.Has(u.Hostname()) {
+		return nil, &ForbiddenError{fmt.Sprintf("host %s is not one the operator may read from", u.Hostname())}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+
+	p.Lock()
+	cached, found := p.cache[u.String()]
+	p.Unlock()
+	if found && cached.etag != "" {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, redirectError(err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		if found {
+			return cached.data, nil
+		}
+		return nil, fmt.Errorf("%s answered 304 Not Modified to an unconditional request", u)
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("%s answered %s", u, resp.Status)
+	}
+
+	b, err := ioutil.ReadAll(&io.LimitedReader{R: resp.Body, N: maxResponseSize + 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxResponseSize {
+		return nil, &InvalidError{fmt.Sprintf("%s answered more than %d bytes", u, maxResponseSize)}
+	}
+	values, err := decodeValues(b)
+	if err != nil {
+		return nil, err
+	}
+
+	// The ETag is the only version an endpoint has
+	data := &Data{Values: values, Version: resp.Header.Get("ETag")}
+	p.Lock()
+	p.cache[u.String()] = cachedResponse{etag: data.Version, data: data}
+	p.Unlock()
+	return data, nil
+}
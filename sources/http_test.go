@@ -0,0 +1,153 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sources
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+)
+
+// etagServer serves body with etag, answering 304 to requests for the current etag. /redirect is
+// redirected to redirect.
+type etagServer struct {
+	*httptest.Server
+	body, etag string
+	redirect   string
+	downloads  int
+}
+
+func newETagServer() *etagServer {
+	s := &etagServer{body: `{"user":"admin"}`, etag: `"v1"`}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == s.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, s.redirect, http.StatusFound)
+			return
+		}
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		s.downloads++
+		w.Header().Set("ETag", s.etag)
+		fmt.Fprint(w, s.body)
+	}))
+	return s
+}
+
+func (s *etagServer) source(path string) *tattletalev1beta1.SecretSource {
+	return &tattletalev1beta1.SecretSource{HTTP: &tattletalev1beta1.HTTPSource{URL: s.URL + path}}
+}
+
+func (s *etagServer) provider() *HTTPProvider {
+	u, _ := url.Parse(s.URL)
+	return NewHTTPProvider([]string{u.Hostname()})
+}
+
+func TestHTTPProviderETag(t *testing.T) {
+	server := newETagServer()
+	defer server.Close()
+	provider := server.provider()
+
+	// The endpoint is only downloaded again once its ETag changes
+	steps := []struct {
+		body, etag string
+		want       map[string][]byte
+		downloads  int
+	}{
+		{want: map[string][]byte{"user": []byte("admin")}, downloads: 1},
+		{want: map[string][]byte{"user": []byte("admin")}, downloads: 1},
+		{body: `{"user":"root"}`, etag: `"v2"`, want: map[string][]byte{"user": []byte("root")}, downloads: 2},
+	}
+	for i, step := range steps {
+		if step.etag != "" {
+			server.body, server.etag = step.body, step.etag
+		}
+		data, err := provider.Fetch(context.Background(), "default", server.source("/app"))
+		if err != nil {
+			t.Fatalf("fetch %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(data.Values, step.want) {
+			t.Errorf("fetch %d: values = %q, want %q", i, data.Values, step.want)
+		}
+		if server.downloads != step.downloads {
+			t.Errorf("fetch %d: %d downloads, want %d", i, server.downloads, step.downloads)
+		}
+	}
+}
+
+func TestHTTPProviderErrors(t *testing.T) {
+	server := newETagServer()
+	defer server.Close()
+	// An endpoint the operator may not read from, reached as localhost rather than the allowed 127.0.0.1
+	internal := newETagServer()
+	defer internal.Close()
+	u, _ := url.Parse(internal.URL)
+	server.redirect = "http://localhost:" + u.Port() + "/app"
+
+	tests := []struct {
+		name     string
+		provider *HTTPProvider
+		source   *tattletalev1beta1.SecretSource
+		wantErr  func(err error) bool
+	}{
+		{
+			name:     "error response",
+			provider: server.provider(),
+			source:   server.source("/missing"),
+			wantErr:  func(err error) bool { return err != nil && strings.Contains(err.Error(), "404") },
+		},
+		{
+			name:     "host not allowed",
+			provider: NewHTTPProvider([]string{"config.example.com"}),
+			source:   server.source("/app"),
+			wantErr:  IsForbidden,
+		},
+		{
+			name:     "redirect to a host not allowed",
+			provider: server.provider(),
+			source:   server.source("/redirect"),
+			wantErr:  IsForbidden,
+		},
+		{
+			name:     "URL that isn't HTTP",
+			provider: server.provider(),
+			source:   &tattletalev1beta1.SecretSource{HTTP: &tattletalev1beta1.HTTPSource{URL: "file:///etc/passwd"}},
+			wantErr:  IsInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.provider.Fetch(context.Background(), "default", tt.source); !tt.wantErr(err) {
+				t.Errorf("Fetch() error = %v", err)
+			}
+		})
+	}
+	if internal.downloads != 0 {
+		t.Errorf("%d downloads from a host not allowed, want 0", internal.downloads)
+	}
+}
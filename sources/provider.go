@@ -0,0 +1,183 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sources reads the data of shared secrets from outside of the cluster
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultPollInterval is how often a source is read again when its SharedSecret doesn't say
+const DefaultPollInterval = 5 * time.Minute
+
+// Data is what a provider read from a source
+type Data struct {
+	// The key/values of the source, they may be shared between reads and must not be modified
+	Values map[string][]byte
+
+	// The version of the source when it has one, e.g. the version of a Vault secret
+	Version string
+
+	// How long the values are valid for, zero when only the poll interval applies
+	TTL time.Duration
+}
+
+// Provider reads the key/values of one type of source
+type Provider interface {
+	// Fetch reads the source. namespace is the namespace of the SharedSecret reading it, any secret
+	// referenced by the source is read from there.
+	Fetch(ctx context.Context, namespace string, source *tattletalev1beta1.SecretSource) (*Data, error)
+}
+
+// Providers holds the enabled providers by source type, sources of any other type are forbidden
+type Providers map[string]Provider
+
+// Source types, named after the field of SecretSource configuring them
+const (
+	TypeFile  = "file"
+	TypeHTTP  = "http"
+	TypeVault = "vault"
+	TypeSOPS  = "sops"
+)
+
+// Type returns the type of a source, or an empty string when it doesn't set exactly one provider
+func Type(source *tattletalev1beta1.SecretSource) string {
+	types := []string{}
+	if source.File != nil {
+		types = append(types, TypeFile)
+	}
+	if source.HTTP != nil {
+		types = append(types, TypeHTTP)
+	}
+	if source.Vault != nil {
+		types = append(types, TypeVault)
+	}
+	if source.SOPS != nil {
+		types = append(types, TypeSOPS)
+	}
+	if len(types) != 1 {
+		return ""
+	}
+	return types[0]
+}
+
+// Description returns a short description of a source for logs and CLI output, e.g. http:https://example.com/app
+func Description(source *tattletalev1beta1.SecretSource) string {
+	switch Type(source) {
+	case TypeFile:
+		return TypeFile + ":" + source.File.Path
+	case TypeHTTP:
+		return TypeHTTP + ":" + source.HTTP.URL
+	case TypeVault:
+		return TypeVault + ":" + strings.TrimSuffix(source.Vault.Address, "/") + "/" + vaultMount(source.Vault) + "/" + source.Vault.Path
+	case TypeSOPS:
+		return TypeSOPS + ":configmap/" + source.SOPS.ConfigMap + "/" + source.SOPS.Key
+	}
+	return "invalid"
+}
+
+// Fetch reads a source with the provider of its type
+func (p Providers) Fetch(ctx context.Context, namespace string, source *tattletalev1beta1.SecretSource) (*Data, error) {
+	sourceType := Type(source)
+	if sourceType == "" {
+		return nil, &InvalidError{"source must set exactly one provider"}
+	}
+	provider, ok := p[sourceType]
+	if !ok {
+		return nil, &ForbiddenError{fmt.Sprintf("%s sources are not enabled in the operator", sourceType)}
+	}
+	return provider.Fetch(ctx, namespace, source)
+}
+
+// RefreshInterval returns how long until a source is read again: its poll interval, or the TTL of the
+// data read when it runs out first
+func RefreshInterval(pollInterval *metav1.Duration, data *Data) time.Duration {
+	interval := DefaultPollInterval
+	if pollInterval != nil && pollInterval.Duration > 0 {
+		interval = pollInterval.Duration
+	}
+	if data != nil && data.TTL > 0 && data.TTL < interval {
+		interval = data.TTL
+	}
+	return interval
+}
+
+// ForbiddenError is returned for sources the operator isn't allowed to read
+type ForbiddenError struct {
+	message string
+}
+
+func (e *ForbiddenError) Error() string {
+	return e.message
+}
+
+// IsForbidden reports whether err is a ForbiddenError
+func IsForbidden(err error) bool {
+	_, ok := err.(*ForbiddenError)
+	return ok
+}
+
+// NotFoundError is returned for sources that don't exist
+type NotFoundError struct {
+	message string
+}
+
+func (e *NotFoundError) Error() string {
+	return e.message
+}
+
+// IsNotFound reports whether err is a NotFoundError, or a missing file
+func IsNotFound(err error) bool {
+	_, ok := err.(*NotFoundError)
+	return ok || os.IsNotExist(err)
+}
+
+// InvalidError is returned for sources that are misconfigured or hold data that can't be shared
+type InvalidError struct {
+	message string
+}
+
+func (e *InvalidError) Error() string {
+	return e.message
+}
+
+// IsInvalid reports whether err is an InvalidError
+func IsInvalid(err error) bool {
+	_, ok := err.(*InvalidError)
+	return ok
+}
+
+// decodeValues decodes a JSON object of string values
+func decodeValues(b []byte) (map[string][]byte, error) {
+	var values map[string]string
+	if err := json.Unmarshal(b, &values); err != nil {
+		return nil, &InvalidError{fmt.Sprintf("source is not a JSON object of string values: %v", err)}
+	}
+	data := make(map[string][]byte, len(values))
+	for k, v := range values {
+		data[k] = []byte(v)
+	}
+	return data, nil
+}
@@ -0,0 +1,226 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sources
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	"filippo.io/age"
+	"github.com/getsops/sops/v3"
+	"github.com/getsops/sops/v3/aes"
+	sopsage "github.com/getsops/sops/v3/age"
+	"github.com/getsops/sops/v3/keyservice"
+	sopsyaml "github.com/getsops/sops/v3/stores/yaml"
+	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SOPSProvider reads SOPS encrypted files from configmaps and decrypts them with an age key. Both are
+// read from the namespace of the SharedSecret.
+type SOPSProvider struct {
+	Reader client.Reader
+}
+
+// DecryptionError is returned for sources that can't be decrypted
+type DecryptionError struct {
+	message string
+}
+
+func (e *DecryptionError) Error() string {
+	return e.message
+}
+
+// IsDecryptionFailed reports whether err is a DecryptionError
+func IsDecryptionFailed(err error) bool {
+	_, ok := err.(*DecryptionError)
+	return ok
+}
+
+func (p *SOPSProvider) Fetch(ctx context.Context, namespace string, source *tattletalev1beta1.SecretSource) (*Data, error) {
+	s := source.SOPS
+	var configmap corev1.ConfigMap
+	if err := p.Reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: s.ConfigMap}, &configmap); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, &NotFoundError{fmt.Sprintf("configmap %s/%s does not exist", namespace, s.ConfigMap)}
+		}
+		return nil, err
+	}
+	file, ok := configmap.Data[s.Key]
+	if !ok {
+		return nil, &NotFoundError{fmt.Sprintf("configmap %s/%s has no key %s", namespace, s.ConfigMap, s.Key)}
+	}
+
+	var secret corev1.Secret
+	if err := p.Reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: s.AgeKeySecretRef.Name}, &secret); err != nil {
+		return nil, fmt.Errorf("reading secret %s/%s: %v", namespace, s.AgeKeySecretRef.Name, err)
+	}
+	keys, ok := secret.Data[s.AgeKeySecretRef.Key]
+	if !ok {
+		return nil, &InvalidError{fmt.Sprintf("secret %s/%s has no key %s", namespace, s.AgeKeySecretRef.Name, s.AgeKeySecretRef.Key)}
+	}
+	identities, err := age.ParseIdentities(bytes.NewReader(keys))
+	if err != nil {
+		return nil, &DecryptionError{fmt.Sprintf("invalid age key file: %v", err)}
+	}
+
+	values, err := DecryptSOPS([]byte(file), identities)
+	if err != nil {
+		return nil, err
+	}
+	return &Data{Values: values}, nil
+}
+
+// DecryptSOPS decrypts a SOPS encrypted YAML or JSON file holding either a map of plain values, or a
+// Kubernetes Secret whose data and stringData are returned. It decrypts the file like sops does, verifying
+// its MAC, but only with the given age identities.
+func DecryptSOPS(file []byte, identities []age.Identity) (map[string][]byte, error) {
+	// JSON is YAML, so the YAML store loads both
+	store := &sopsyaml.Store{}
+	tree, err := store.LoadEncryptedFile(file)
+	if err == sops.MetadataNotFound {
+		return nil, &InvalidError{"source is not encrypted with SOPS"}
+	}
+	if err != nil {
+		return nil, &InvalidError{fmt.Sprintf("source is not a SOPS encrypted YAML or JSON object: %v", err)}
+	}
+
+	key, err := tree.Metadata.GetDataKeyWithKeyServices([]keyservice.KeyServiceClient{&ageKeyService{identities: identities}})
+	if err != nil {
+		return nil, &DecryptionError{fmt.Sprintf("unable to decrypt the data key: %v", err)}
+	}
+	cipher := aes.NewCipher()
+	mac, err := decryptTree(tree, key, cipher)
+	if err != nil {
+		return nil, &DecryptionError{err.Error()}
+	}
+	// The MAC is encrypted with the data key and the last modification time
+	expected, err := cipher.Decrypt(tree.Metadata.MessageAuthenticationCode, key, tree.Metadata.LastModified.Format(time.RFC3339))
+	if err != nil {
+		return nil, &DecryptionError{fmt.Sprintf("unable to decrypt the MAC: %v", err)}
+	}
+	if expected != mac {
+		return nil, &DecryptionError{"the MAC of the file doesn't match its values"}
+	}
+	if len(tree.Branches) != 1 {
+		return nil, &InvalidError{"source is not a single YAML or JSON object"}
+	}
+	return sopsValues(tree.Branches[0])
+}
+
+// decryptTree decrypts the values of a tree in place and returns their MAC. sops panics on plain values that
+// aren't strings where the encryption rules expect encrypted ones.
+func decryptTree(tree sops.Tree, key []byte, cipher sops.Cipher) (mac string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("a value that should be encrypted is not: %v", r)
+		}
+	}()
+	return tree.Decrypt(key, cipher)
+}
+
+// ageKeyService decrypts the data key of SOPS files with the age identities of a SharedSecret, where the
+// local key service of sops reads them from the environment of the operator
+type ageKeyService struct {
+	identities sopsage.ParsedIdentities
+}
+
+func (s *ageKeyService) Decrypt(ctx context.Context, req *keyservice.DecryptRequest, opts ...grpc.CallOption) (*keyservice.DecryptResponse, error) {
+	k := req.Key.GetAgeKey()
+	if k == nil {
+		return nil, errors.New("only age keys are supported")
+	}
+	masterKey := &sopsage.MasterKey{Recipient: k.Recipient}
+	masterKey.SetEncryptedDataKey(req.Ciphertext)
+	s.identities.ApplyToMasterKey(masterKey)
+	plaintext, err := masterKey.Decrypt()
+	if err != nil {
+		return nil, err
+	}
+	return &keyservice.DecryptResponse{Plaintext: plaintext}, nil
+}
+
+func (s *ageKeyService) Encrypt(ctx context.Context, req *keyservice.EncryptRequest, opts ...grpc.CallOption) (*keyservice.EncryptResponse, error) {
+	return nil, errors.New("encryption is not supported")
+}
+
+// sopsValues returns the key/values of a decrypted tree. Values are typed by sops, e.g. type:int values
+// are ints, and are formatted back to text.
+func sopsValues(tree sops.TreeBranch) (map[string][]byte, error) {
+	if branchValue(tree, "kind") == "Secret" {
+		values := map[string][]byte{}
+		data, _ := branchValue(tree, "data").(sops.TreeBranch)
+		for _, item := range data {
+			s, ok := item.Value.(string)
+			decoded, err := base64.StdEncoding.DecodeString(s)
+			if !ok || err != nil {
+				return nil, &InvalidError{fmt.Sprintf("data.%v of the Secret is not base64", item.Key)}
+			}
+			values[fmt.Sprint(item.Key)] = decoded
+		}
+		stringData, _ := branchValue(tree, "stringData").(sops.TreeBranch)
+		for _, item := range stringData {
+			s, ok := item.Value.(string)
+			if !ok {
+				return nil, &InvalidError{fmt.Sprintf("stringData.%v of the Secret is not a string", item.Key)}
+			}
+			values[fmt.Sprint(item.Key)] = []byte(s)
+		}
+		return values, nil
+	}
+
+	values := make(map[string][]byte, len(tree))
+	for _, item := range tree {
+		if _, ok := item.Key.(sops.Comment); ok {
+			continue
+		}
+		k := fmt.Sprint(item.Key)
+		switch v := item.Value.(type) {
+		case string:
+			values[k] = []byte(v)
+		case []byte:
+			values[k] = v
+		case int:
+			values[k] = []byte(strconv.Itoa(v))
+		case bool:
+			values[k] = []byte(strconv.FormatBool(v))
+		case float64:
+			values[k] = []byte(strconv.FormatFloat(v, 'f', -1, 64))
+		default:
+			return nil, &InvalidError{fmt.Sprintf("value of key %s is not a string, number or bool", k)}
+		}
+	}
+	return values, nil
+}
+
+// branchValue returns the value of a key of a tree, or nil
+func branchValue(tree sops.TreeBranch, key string) interface{} {
+	for _, item := range tree {
+		if item.Key == key {
+			return item.Value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sources
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	"filippo.io/age"
+	"github.com/getsops/sops/v3"
+	"github.com/getsops/sops/v3/aes"
+	sopsage "github.com/getsops/sops/v3/age"
+	sopsjson "github.com/getsops/sops/v3/stores/json"
+	sopsyaml "github.com/getsops/sops/v3/stores/yaml"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// sopsFile encrypts a plain file with sops the way `sops --encrypt --age recipient` does. metadata holds
+// the encryption rules, e.g. the unencrypted_suffix.
+func sopsFile(t *testing.T, store sops.Store, recipient string, metadata sops.Metadata, plain string) string {
+	t.Helper()
+	branches, err := store.LoadPlainFile([]byte(plain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := sopsage.MasterKeyFromRecipient(recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata.KeyGroups = []sops.KeyGroup{{key}}
+	metadata.Version = "3.8.1"
+	tree := sops.Tree{Branches: branches, Metadata: metadata}
+	dataKey, errs := tree.GenerateDataKey()
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	cipher := aes.NewCipher()
+	mac, err := tree.Encrypt(dataKey, cipher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree.Metadata.LastModified = time.Now().UTC()
+	if tree.Metadata.MessageAuthenticationCode, err = cipher.Encrypt(mac, dataKey, tree.Metadata.LastModified.Format(time.RFC3339)); err != nil {
+		t.Fatal(err)
+	}
+	file, err := store.EmitEncryptedFile(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(file)
+}
+
+func newAgeIdentity(t *testing.T) *age.X25519Identity {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return identity
+}
+
+func TestDecryptSOPS(t *testing.T) {
+	identity := newAgeIdentity(t)
+	const userAndPort = "user: admin\nport_unencrypted: 5432\n"
+
+	tests := []struct {
+		name     string
+		store    sops.Store
+		metadata sops.Metadata
+		plain    string
+		// Changes the file after it is encrypted
+		tamper  func(file string) string
+		want    map[string][]byte
+		wantErr func(err error) bool
+	}{
+		{
+			name:     "map of values",
+			metadata: sops.Metadata{UnencryptedSuffix: "_unencrypted"},
+			plain:    "user: admin\npassword: hunter2\nport_unencrypted: 5432\n",
+			want:     map[string][]byte{"user": []byte("admin"), "password": []byte("hunter2"), "port_unencrypted": []byte("5432")},
+		},
+		{
+			name:  "JSON file",
+			store: &sopsjson.Store{},
+			plain: `{"user": "admin", "password": "hunter2"}`,
+			want:  map[string][]byte{"user": []byte("admin"), "password": []byte("hunter2")},
+		},
+		{
+			// sops encrypts the type of values along with them
+			name:  "typed values",
+			plain: "port: 5432\nratio: 0.5\ndebug: true\nuser: admin\n",
+			want:  map[string][]byte{"port": []byte("5432"), "ratio": []byte("0.5"), "debug": []byte("true"), "user": []byte("admin")},
+		},
+		{
+			name:     "Kubernetes Secret",
+			metadata: sops.Metadata{EncryptedRegex: "^(data|stringData)$"},
+			plain:    "apiVersion: v1\nkind: Secret\nmetadata:\n    name: db\ndata:\n    token: YWJj\nstringData:\n    user: admin\n",
+			want:     map[string][]byte{"token": []byte("abc"), "user": []byte("admin")},
+		},
+		{
+			name:    "value moved to another path",
+			plain:   "user: admin\n",
+			tamper:  func(file string) string { return strings.Replace(file, "user:", "password:", 1) },
+			wantErr: IsDecryptionFailed,
+		},
+		{
+			name:     "plain value sops would have encrypted",
+			metadata: sops.Metadata{UnencryptedRegex: "^user$"},
+			plain:    userAndPort,
+			tamper: func(file string) string {
+				return strings.Replace(file, "unencrypted_regex: ^user$", "unencrypted_regex: ^password$", 1)
+			},
+			wantErr: IsDecryptionFailed,
+		},
+		{
+			name:     "plain number sops would have encrypted",
+			metadata: sops.Metadata{UnencryptedSuffix: "_unencrypted"},
+			plain:    userAndPort,
+			tamper: func(file string) string {
+				return strings.Replace(file, "unencrypted_suffix: _unencrypted", "unencrypted_suffix: _plain", 1)
+			},
+			wantErr: IsDecryptionFailed,
+		},
+		{
+			name:     "plain value changed after encryption",
+			metadata: sops.Metadata{UnencryptedSuffix: "_unencrypted"},
+			plain:    userAndPort,
+			tamper:   func(file string) string { return strings.Replace(file, "5432", "5433", 1) },
+			wantErr:  IsDecryptionFailed,
+		},
+		{
+			name:     "value removed after encryption",
+			metadata: sops.Metadata{UnencryptedSuffix: "_unencrypted"},
+			plain:    userAndPort,
+			tamper:   func(file string) string { return strings.Replace(file, "port_unencrypted: 5432\n", "", 1) },
+			wantErr:  IsDecryptionFailed,
+		},
+		{
+			name:     "no MAC",
+			metadata: sops.Metadata{UnencryptedSuffix: "_unencrypted"},
+			plain:    userAndPort,
+			tamper: func(file string) string {
+				lines := strings.Split(file, "\n")
+				for i, line := range lines {
+					if strings.HasPrefix(strings.TrimSpace(line), "mac: ") {
+						lines = append(lines[:i], lines[i+1:]...)
+						break
+					}
+				}
+				return strings.Join(lines, "\n")
+			},
+			wantErr: IsDecryptionFailed,
+		},
+		{
+			name:    "file not encrypted with SOPS",
+			plain:   userAndPort,
+			tamper:  func(string) string { return userAndPort },
+			wantErr: IsInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := tt.store
+			if store == nil {
+				store = &sopsyaml.Store{}
+			}
+			file := sopsFile(t, store, identity.Recipient().String(), tt.metadata, tt.plain)
+			if tt.tamper != nil {
+				file = tt.tamper(file)
+			}
+			values, err := DecryptSOPS([]byte(file), []age.Identity{identity})
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Errorf("DecryptSOPS() error = %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(values, tt.want) {
+				t.Errorf("DecryptSOPS() = %q, want %q", values, tt.want)
+			}
+		})
+	}
+}
+
+func TestSOPSProvider(t *testing.T) {
+	identity, otherIdentity := newAgeIdentity(t), newAgeIdentity(t)
+	file := sopsFile(t, &sopsyaml.Store{}, identity.Recipient().String(), sops.Metadata{}, "user: admin\n")
+	// The file and key are read from the namespace of the SharedSecret
+	provider := &SOPSProvider{Reader: fake.NewFakeClient(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "db"}, Data: map[string]string{"db.enc.yaml": file}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "age"}, Data: map[string][]byte{"keys.txt": []byte("# created: 2020-01-01T00:00:00Z\n" + identity.String() + "\n")}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "other-age"}, Data: map[string][]byte{"keys.txt": []byte(otherIdentity.String())}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "empty"}, Data: map[string][]byte{"keys.txt": nil}},
+	)}
+
+	tests := []struct {
+		name      string
+		namespace string
+		keySecret string
+		want      map[string][]byte
+		wantErr   func(err error) bool
+	}{
+		{name: "namespace of the file", namespace: "team-a", keySecret: "age", want: map[string][]byte{"user": []byte("admin")}},
+		{name: "other namespace", namespace: "team-b", keySecret: "age", wantErr: IsNotFound},
+		{name: "other key", namespace: "team-a", keySecret: "other-age", wantErr: IsDecryptionFailed},
+		{name: "no key", namespace: "team-a", keySecret: "empty", wantErr: IsDecryptionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &tattletalev1beta1.SecretSource{SOPS: &tattletalev1beta1.SOPSSource{
+				ConfigMap: "db", Key: "db.enc.yaml", AgeKeySecretRef: tattletalev1beta1.SecretKeyReference{Name: tt.keySecret, Key: "keys.txt"},
+			}}
+			data, err := provider.Fetch(context.Background(), tt.namespace, source)
+			if tt.wantErr != nil {
+				if !tt.wantErr(err) {
+					t.Errorf("Fetch() error = %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(data.Values, tt.want) {
+				t.Errorf("values = %q, want %q", data.Values, tt.want)
+			}
+		})
+	}
+}
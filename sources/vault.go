@@ -0,0 +1,282 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sources
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	defaultVaultMount           = "secret"
+	defaultVaultKubernetesMount = "kubernetes"
+)
+
+// VaultProvider reads secrets of HashiCorp Vault KV version 2 engines. Tokens obtained with the Kubernetes
+// auth method are kept until shortly before they expire.
+type VaultProvider struct {
+	Client *http.Client
+	// Reads the secrets holding credentials
+	Reader client.Reader
+	// Servers sources may be read from, as scheme://host[:port]
+	AllowedAddresses sets.String
+
+	tokens map[string]vaultToken
+	sync.Mutex
+}
+
+type vaultToken struct {
+	token string
+	// Zero when the token doesn't expire
+	expires time.Time
+}
+
+// NewVaultProvider returns a provider reading from the given Vault servers
+func NewVaultProvider(reader client.Reader, allowedAddresses []string) *VaultProvider {
+	allowed := sets.NewString()
+	for _, address := range allowedAddresses {
+		if normalized, err := NormalizeVaultAddress(address); err == nil {
+			allowed.Insert(normalized)
+		}
+	}
+	p := &VaultProvider{
+		Reader:           reader,
+		AllowedAddresses: allowed,
+		tokens:           map[string]vaultToken{},
+	}
+	// Requests carry the Vault token, they are never redirected to a server that isn't allowed
+	p.Client = &http.Client{
+		Timeout: 30 * time.Second,
+		CheckRedirect: checkRedirect(func(u *url.URL) bool {
+			address, err := NormalizeVaultAddress(u.Scheme + "://" + u.Host)
+			return err == nil && p.AllowedAddresses.Has(address)
+		}),
+	}
+	return p
+}
+
+// NormalizeVaultAddress returns an address as scheme://host[:port], so addresses can be compared
+func NormalizeVaultAddress(address string) (string, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("scheme must be http or https, not %q", u.Scheme)
+	}
+	if u.Host == "" || strings.Trim(u.Path, "/") != "" {
+		return "", fmt.Errorf("address must be of the form scheme://host[:port]")
+	}
+	return u.Scheme + "://" + u.Host, nil
+}
+
+func vaultMount(v *tattletalev1beta1.VaultSource) string {
+	if mount := strings.Trim(v.Mount, "/"); mount != "" {
+		return mount
+	}
+	return defaultVaultMount
+}
+
+// vaultSecret is the answer of Vault to a read of a KV version 2 secret
+type vaultSecret struct {
+	LeaseDuration int `json:"lease_duration"`
+	Data          struct {
+		Data     map[string]interface{} `json:"data"`
+		Metadata struct {
+			Version int `json:"version"`
+		} `json:"metadata"`
+	} `json:"data"`
+}
+
+// vaultLogin is the answer of Vault to a login
+type vaultLogin struct {
+	Auth struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+	} `json:"auth"`
+}
+
+func (p *VaultProvider) Fetch(ctx context.Context, namespace string, source *tattletalev1beta1.SecretSource) (*Data, error) {
+	v := source.Vault
+	address, err := NormalizeVaultAddress(v.Address)
+	if err != nil {
+		return nil, &InvalidError{fmt.Sprintf("invalid Vault address %s: %v", v.Address, err)}
+	}
+	if !p.AllowedAddresses.Has(address) {
+		return nil, &ForbiddenError{fmt.Sprintf("Vault server %s is not one the operator may read from", address)}
+	}
+	path := strings.Trim(v.Path, "/")
+	if path == "" {
+		return nil, &InvalidError{"Vault path is empty"}
+	}
+
+	token, tokenKey, err := p.token(ctx, namespace, address, v.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	var secret vaultSecret
+	status, err := p.do(ctx, http.MethodGet, address+"/v1/"+vaultMount(v)+"/data/"+path, token, nil, &secret)
+	switch {
+	case status == http.StatusNotFound:
+		return nil, &NotFoundError{fmt.Sprintf("Vault secret %s does not exist", Description(source))}
+	case status == http.StatusForbidden && tokenKey != "":
+		// The token may have been revoked, log in again next time
+		p.Lock()
+		delete(p.tokens, tokenKey)
+		p.Unlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string][]byte, len(secret.Data.Data))
+	for k, value := range secret.Data.Data {
+		s, ok := value.(string)
+		if !ok {
+			return nil, &InvalidError{fmt.Sprintf("value of key %s of Vault secret %s is not a string", k, Description(source))}
+		}
+		values[k] = []byte(s)
+	}
+	return &Data{
+		Values:  values,
+		Version: strconv.Itoa(secret.Data.Metadata.Version),
+		TTL:     time.Duration(secret.LeaseDuration) * time.Second,
+	}, nil
+}
+
+// token returns the Vault token to read with, and the key it is cached under when it was obtained by logging in
+func (p *VaultProvider) token(ctx context.Context, namespace, address string, auth tattletalev1beta1.VaultAuth) (string, string, error) {
+	switch {
+	case auth.TokenSecretRef != nil && auth.Kubernetes == nil:
+		token, err := p.readSecretKey(ctx, namespace, *auth.TokenSecretRef)
+		return token, "", err
+	case auth.Kubernetes != nil && auth.TokenSecretRef == nil:
+	default:
+		return "", "", &InvalidError{"Vault auth must set exactly one method"}
+	}
+
+	k := auth.Kubernetes
+	if k.Role == "" {
+		return "", "", &InvalidError{"Vault Kubernetes auth needs a role"}
+	}
+	jwt, err := p.readSecretKey(ctx, namespace, k.ServiceAccountTokenSecretRef)
+	if err != nil {
+		return "", "", err
+	}
+	mount := strings.Trim(k.Mount, "/")
+	if mount == "" {
+		mount = defaultVaultKubernetesMount
+	}
+
+	// Tokens are cached per service account token, so rotating it logs in again
+	sum := sha256.Sum256([]byte(jwt))
+	key := strings.Join([]string{address, mount, k.Role, hex.EncodeToString(sum[:])}, "|")
+	p.Lock()
+	cached, ok := p.tokens[key]
+	p.Unlock()
+	if ok && (cached.expires.IsZero() || time.Now().Before(cached.expires)) {
+		return cached.token, key, nil
+	}
+
+	var login vaultLogin
+	body := map[string]string{"role": k.Role, "jwt": jwt}
+	if _, err := p.do(ctx, http.MethodPost, address+"/v1/auth/"+mount+"/login", "", body, &login); err != nil {
+		return "", "", fmt.Errorf("logging in to Vault: %v", err)
+	}
+	if login.Auth.ClientToken == "" {
+		return "", "", fmt.Errorf("logging in to Vault: no token in the answer")
+	}
+
+	token := vaultToken{token: login.Auth.ClientToken}
+	if lease := time.Duration(login.Auth.LeaseDuration) * time.Second; lease > 0 {
+		// Log in again a little before the token expires
+		token.expires = time.Now().Add(lease - lease/5)
+	}
+	p.Lock()
+	p.tokens[key] = token
+	p.Unlock()
+	return token.token, key, nil
+}
+
+func (p *VaultProvider) readSecretKey(ctx context.Context, namespace string, ref tattletalev1beta1.SecretKeyReference) (string, error) {
+	var secret corev1.Secret
+	if err := p.Reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, &secret); err != nil {
+		return "", fmt.Errorf("reading secret %s/%s: %v", namespace, ref.Name, err)
+	}
+	value, ok := secret.Data[ref.Key]
+	if !ok {
+		return "", &InvalidError{fmt.Sprintf("secret %s/%s has no key %s", namespace, ref.Name, ref.Key)}
+	}
+	return strings.TrimSpace(string(value)), nil
+}
+
+// do sends a request to Vault and decodes its answer into out. It returns the status code of the answer
+// along with any error.
+func (p *VaultProvider) do(ctx context.Context, method, u, token string, body, out interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return 0, redirectError(err)
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(&io.LimitedReader{R: resp.Body, N: maxResponseSize})
+	if resp.StatusCode != http.StatusOK {
+		var errs struct {
+			Errors []string `json:"errors"`
+		}
+		_ = decoder.Decode(&errs)
+		return resp.StatusCode, fmt.Errorf("Vault answered %s: %s", resp.Status, strings.Join(errs.Errors, ", "))
+	}
+	if err := decoder.Decode(out); err != nil {
+		return resp.StatusCode, fmt.Errorf("decoding the answer of Vault: %v", err)
+	}
+	return resp.StatusCode, nil
+}
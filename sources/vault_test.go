@@ -0,0 +1,192 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// A stand-in Vault server with a KV version 2 engine mounted at secret and the Kubernetes auth method
+type fakeVault struct {
+	secrets map[string]map[string]interface{}
+	version int
+	logins  int
+	// Where every request is redirected to when set
+	redirect string
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case v.redirect != "":
+		http.Redirect(w, r, v.redirect+r.URL.Path, http.StatusTemporaryRedirect)
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/auth/kubernetes/login":
+		var login map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&login)
+		if login["role"] != "tattletale" || login["jwt"] != "service-account-jwt" {
+			w.WriteHeader(http.StatusForbidden)
+			_ = json.NewEncoder(w).Encode(map[string][]string{"errors": {"permission denied"}})
+			return
+		}
+		v.logins++
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]interface{}{"client_token": "login-token", "lease_duration": 3600}})
+	case r.Method == http.MethodGet:
+		if token := r.Header.Get("X-Vault-Token"); token != "login-token" && token != "static-token" {
+			w.WriteHeader(http.StatusForbidden)
+			_ = json.NewEncoder(w).Encode(map[string][]string{"errors": {"permission denied"}})
+			return
+		}
+		data, ok := v.secrets[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string][]string{"errors": {}})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"lease_duration": 0,
+			"data":           map[string]interface{}{"data": data, "metadata": map[string]interface{}{"version": v.version}},
+		})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+var vaultCredentials = &corev1.Secret{
+	ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "vault"},
+	Data:       map[string][]byte{"token": []byte("static-token\n"), "jwt": []byte("service-account-jwt")},
+}
+
+var vaultTokenAuth = tattletalev1beta1.VaultAuth{TokenSecretRef: &tattletalev1beta1.SecretKeyReference{Name: "vault", Key: "token"}}
+
+// newFakeVault starts a fake Vault server and returns it along with a provider allowed to read it
+func newFakeVault() (*fakeVault, *httptest.Server, *VaultProvider) {
+	vault := &fakeVault{
+		secrets: map[string]map[string]interface{}{
+			"/v1/secret/data/apps/db":    {"user": "admin", "password": "hunter2"},
+			"/v1/secret/data/apps/ports": {"port": 5432},
+		},
+		version: 3,
+	}
+	server := httptest.NewServer(vault)
+	return vault, server, NewVaultProvider(fake.NewFakeClient(vaultCredentials), []string{server.URL + "/"})
+}
+
+func vaultSource(address, path string, auth tattletalev1beta1.VaultAuth) *tattletalev1beta1.SecretSource {
+	return &tattletalev1beta1.SecretSource{Vault: &tattletalev1beta1.VaultSource{Address: address, Path: path, Auth: auth}}
+}
+
+func TestVaultProviderToken(t *testing.T) {
+	_, server, provider := newFakeVault()
+	defer server.Close()
+
+	data, err := provider.Fetch(context.Background(), "team-a", vaultSource(server.URL, "apps/db", vaultTokenAuth))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string][]byte{"user": []byte("admin"), "password": []byte("hunter2")}; !reflect.DeepEqual(data.Values, want) {
+		t.Errorf("values = %q, want %q", data.Values, want)
+	}
+	if data.Version != "3" {
+		t.Errorf("version = %q, want the version of the secret", data.Version)
+	}
+}
+
+func TestVaultProviderKubernetesAuth(t *testing.T) {
+	vault, server, provider := newFakeVault()
+	defer server.Close()
+	kubernetesAuth := tattletalev1beta1.VaultAuth{Kubernetes: &tattletalev1beta1.VaultKubernetesAuth{
+		Role:                         "tattletale",
+		ServiceAccountTokenSecretRef: tattletalev1beta1.SecretKeyReference{Name: "vault", Key: "jwt"},
+	}}
+
+	// The provider logs in once while the token is valid
+	for i := 0; i < 2; i++ {
+		if _, err := provider.Fetch(context.Background(), "team-a", vaultSource(server.URL, "apps/db", kubernetesAuth)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if vault.logins != 1 {
+		t.Errorf("logged in %d times, want once", vault.logins)
+	}
+}
+
+func TestVaultProviderErrors(t *testing.T) {
+	_, server, provider := newFakeVault()
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		namespace string
+		address   string
+		path      string
+		wantErr   func(err error) bool
+	}{
+		{
+			// Credentials are only read from the namespace of the SharedSecret
+			name:      "credentials in another namespace",
+			namespace: "team-b",
+			path:      "apps/db",
+			wantErr:   func(err error) bool { return err != nil && strings.Contains(err.Error(), "team-b/vault") },
+		},
+		{name: "missing secret", path: "apps/missing", wantErr: IsNotFound},
+		{name: "values that aren't strings", path: "apps/ports", wantErr: IsInvalid},
+		{name: "server not allowed", address: "https://vault.example.com", path: "apps/db", wantErr: IsForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			namespace, address := tt.namespace, tt.address
+			if namespace == "" {
+				namespace = "team-a"
+			}
+			if address == "" {
+				address = server.URL
+			}
+			if _, err := provider.Fetch(context.Background(), namespace, vaultSource(address, tt.path, vaultTokenAuth)); !tt.wantErr(err) {
+				t.Errorf("Fetch() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestVaultProviderRedirect(t *testing.T) {
+	vault, server, provider := newFakeVault()
+	defer server.Close()
+	// A server the operator may not read from, reached as localhost rather than the allowed 127.0.0.1
+	tokens := []string{}
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokens = append(tokens, r.Header.Get("X-Vault-Token"))
+	}))
+	defer other.Close()
+	vault.redirect = strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+
+	if _, err := provider.Fetch(context.Background(), "team-a", vaultSource(server.URL, "apps/db", vaultTokenAuth)); !IsForbidden(err) {
+		t.Errorf("Fetch() error = %v, want a ForbiddenError", err)
+	}
+	if len(tokens) != 0 {
+		t.Errorf("the Vault token was sent to %s", vault.redirect)
+	}
+}
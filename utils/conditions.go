@@ -0,0 +1,66 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SetCondition returns the conditions with condition added or replacing the one of the same type. The
+// transition time is kept when the status doesn't change. The conditions given are not modified.
+func SetCondition(conditions []tattletalev1beta1.Condition, condition tattletalev1beta1.Condition, now metav1.Time) []tattletalev1beta1.Condition {
+	result := make([]tattletalev1beta1.Condition, 0, len(conditions)+1)
+	condition.LastTransitionTime = now
+	found := false
+	for _, c := range conditions {
+		if c.Type != condition.Type {
+			result = append(result, c)
+			continue
+		}
+		found = true
+		if c.Status == condition.Status {
+			condition.LastTransitionTime = c.LastTransitionTime
+		}
+		result = append(result, condition)
+	}
+	if !found {
+		result = append(result, condition)
+	}
+	return result
+}
+
+// RemoveCondition returns the conditions without the one of the given type. The conditions given are not modified.
+func RemoveCondition(conditions []tattletalev1beta1.Condition, conditionType tattletalev1beta1.ConditionType) []tattletalev1beta1.Condition {
+	var result []tattletalev1beta1.Condition
+	for _, c := range conditions {
+		if c.Type != conditionType {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// FindCondition returns the condition of the given type, or nil when there is none
+func FindCondition(conditions []tattletalev1beta1.Condition, conditionType tattletalev1beta1.ConditionType) *tattletalev1beta1.Condition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+	"time"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetCondition(t *testing.T) {
+	earlier := metav1.NewTime(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	now := metav1.NewTime(earlier.Add(time.Hour))
+
+	tests := []struct {
+		name      string
+		condition tattletalev1beta1.Condition
+		// The transition time expected
+		want metav1.Time
+	}{
+		{
+			// The transition time is kept while the status doesn't change
+			name:      "same status",
+			condition: tattletalev1beta1.Condition{Type: tattletalev1beta1.ConditionDecrypted, Status: corev1.ConditionTrue, Message: "again"},
+			want:      earlier,
+		},
+		{
+			name:      "transition",
+			condition: tattletalev1beta1.Condition{Type: tattletalev1beta1.ConditionDecrypted, Status: corev1.ConditionFalse},
+			want:      now,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := []tattletalev1beta1.Condition{{Type: tattletalev1beta1.ConditionDecrypted, Status: corev1.ConditionTrue, LastTransitionTime: earlier}}
+			conditions := SetCondition(previous, tt.condition, now)
+			if len(conditions) != 1 {
+				t.Fatalf("conditions = %+v, want 1", conditions)
+			}
+			got := FindCondition(conditions, tattletalev1beta1.ConditionDecrypted)
+			if !got.LastTransitionTime.Equal(&tt.want) {
+				t.Errorf("transition time = %v, want %v", got.LastTransitionTime, tt.want)
+			}
+			if got.Status != tt.condition.Status || got.Message != tt.condition.Message {
+				t.Errorf("condition = %+v, want %+v", *got, tt.condition)
+			}
+			// The conditions given aren't modified
+			if previous[0].Status != corev1.ConditionTrue {
+				t.Errorf("previous conditions were modified: %+v", previous)
+			}
+		})
+	}
+}
+
+func TestRemoveCondition(t *testing.T) {
+	decrypted := tattletalev1beta1.Condition{Type: tattletalev1beta1.ConditionDecrypted, Status: corev1.ConditionTrue}
+	if conditions := RemoveCondition([]tattletalev1beta1.Condition{decrypted}, tattletalev1beta1.ConditionDecrypted); len(conditions) != 0 {
+		t.Errorf("conditions = %+v, want none", conditions)
+	}
+	if c := FindCondition(nil, tattletalev1beta1.ConditionDecrypted); c != nil {
+		t.Errorf("found %+v in no conditions", *c)
+	}
+}
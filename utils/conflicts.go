@@ -0,0 +1,360 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// Precedes reports whether shared object a takes precedence over shared object b when both write the same
+// copy: the higher priority wins, then the object created first, then the one whose namespace/name sorts
+// first. Only the spec and the creation of the objects count, so the winner doesn't change between syncs.
+func Precedes(a metav1.Object, aPriority int32, b metav1.Object, bPriority int32) bool {
+	if aPriority != bPriority {
+		return aPriority > bPriority
+	}
+	aCreated, bCreated := a.GetCreationTimestamp(), b.GetCreationTimestamp()
+	if !aCreated.Equal(&bCreated) {
+		return aCreated.Before(&bCreated)
+	}
+	return IndexKey(a.GetNamespace(), a.GetName()) < IndexKey(b.GetNamespace(), b.GetName())
+}
+
+// CopyWriters finds the shared objects of one kind writing a copy of one kind, to settle which of them may
+// write it. Shared objects with a target namespace pattern are listed once, on the first lookup.
+type CopyWriters struct {
+	Reader client.Reader
+
+	// Returns an empty list of the shared object kind to query
+	NewList func() runtime.Object
+
+	// The index holding the "namespace/name" of the copies, TargetIndex or CrossKindTargetIndex
+	Index string
+
+	// Returns the targets of a shared object whose namespace is a pattern, writing copies of the kind
+	Patterns func(o runtime.Object) []TargetPattern
+
+	// Returns the "namespace/name" of the source of a shared object, which it never writes to.
+	// Nil when the source is of another kind than the copies.
+	Source func(o runtime.Object) string
+
+	// The kind of the copies in the status of the shared objects, empty when it is the kind of their source
+	TargetKind tattletalev1beta1.TargetKind
+
+	// Set when the index holds keys of resources of any kind, see ResourceIndexKey
+	GroupKind string
+
+	// Shared objects in these namespaces aren't reconciled, so they never write copies
+	ExcludedNamespaces sets.String
+
+	patternWriters []runtime.Object
+}
+
+// CopyWriterSet finds the shared objects of every kind writing a copy of one kind
+type CopyWriterSet []*CopyWriters
+
+// NewSecretWriters returns the CopyWriterSet of secrets: SharedSecrets and SharedConfigMaps with
+// Secret targets
+func NewSecretWriters(reader client.Reader, excludedNamespaces sets.String) CopyWriterSet {
+	return CopyWriterSet{
+		{
+			Reader:   reader,
+			NewList:  func() runtime.Object { return &tattletalev1beta1.SharedSecretList{} },
+			Index:    TargetIndex,
+			Patterns: SharedSecretTargetPatterns,
+			Source: func(o runtime.Object) string {
+				s := o.(*tattletalev1beta1.SharedSecret)
+				if s.Spec.Source != nil {
+					return ""
+				}
+				return IndexKey(s.Spec.SourceNamespace, s.Spec.SourceSecret)
+			},
+			ExcludedNamespaces: excludedNamespaces,
+		},
+		{
+			Reader:             reader,
+			NewList:            func() runtime.Object { return &tattletalev1beta1.SharedConfigMapList{} },
+			Index:              CrossKindTargetIndex,
+			Patterns:           SharedConfigMapCrossKindPatterns,
+			TargetKind:         tattletalev1beta1.TargetKindSecret,
+			ExcludedNamespaces: excludedNamespaces,
+		},
+	}
+}
+
+// NewConfigMapWriters returns the CopyWriterSet of configmaps: SharedConfigMaps and SharedSecrets with
+// ConfigMap targets
+func NewConfigMapWriters(reader client.Reader, excludedNamespaces sets.String) CopyWriterSet {
+	return CopyWriterSet{
+		{
+			Reader:   reader,
+			NewList:  func() runtime.Object { return &tattletalev1beta1.SharedConfigMapList{} },
+			Index:    TargetIndex,
+			Patterns: SharedConfigMapTargetPatterns,
+			Source: func(o runtime.Object) string {
+				c := o.(*tattletalev1beta1.SharedConfigMap)
+				if c.Spec.Source != nil {
+					return ""
+				}
+				return IndexKey(c.Spec.SourceNamespace, c.Spec.SourceConfigMap)
+			},
+			ExcludedNamespaces: excludedNamespaces,
+		},
+		{
+			Reader:             reader,
+			NewList:            func() runtime.Object { return &tattletalev1beta1.SharedSecretList{} },
+			Index:              CrossKindTargetIndex,
+			Patterns:           SharedSecretCrossKindPatterns,
+			TargetKind:         tattletalev1beta1.TargetKindConfigMap,
+			ExcludedNamespaces: excludedNamespaces,
+		},
+	}
+}
+
+// NewSharedResourceWriters returns the CopyWriterSet of resources of a kind other than secrets and
+// configmaps, which only SharedResources write
+func NewSharedResourceWriters(reader client.Reader, groupKind string, excludedNamespaces sets.String) CopyWriterSet {
+	return CopyWriterSet{
+		{
+			Reader:  reader,
+			NewList: func() runtime.Object { return &tattletalev1beta1.SharedResourceList{} },
+			Index:   TargetIndex,
+			Source: func(o runtime.Object) string {
+				r := o.(*tattletalev1beta1.SharedResource)
+				return ResourceIndexKey(sharedResourceGroupKind(r), r.Spec.SourceNamespace, r.Spec.SourceName)
+			},
+			GroupKind:          groupKind,
+			ExcludedNamespaces: excludedNamespaces,
+		},
+	}
+}
+
+// Writers returns the shared objects writing the copy namespace/name, in no particular order. Shared objects
+// being deleted or in excluded namespaces don't write copies, and none writes to its own source.
+func (w *CopyWriters) Writers(ctx context.Context, namespace, name string) ([]runtime.Object, error) {
+	key := IndexKey(namespace, name)
+	if w.GroupKind != "" {
+		key = ResourceIndexKey(w.GroupKind, namespace, name)
+	}
+
+	list := w.NewList()
+	if err := w.Reader.List(ctx, list, client.MatchingField(w.Index, key)); err != nil {
+		return nil, err
+	}
+	candidates, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+	// Shared objects without target namespace patterns, e.g. SharedResources, have no pattern writers
+	if w.patternWriters == nil && w.Patterns != nil {
+		list := w.NewList()
+		if err := w.Reader.List(ctx, list, client.MatchingField(TargetNamespacePatternIndex, PatternIndexKey)); err != nil {
+			return nil, err
+		}
+		if w.patternWriters, err = meta.ExtractList(list); err != nil {
+			return nil, err
+		}
+	}
+	for _, o := range w.patternWriters {
+		for _, p := range w.Patterns(o) {
+			if p.Name != name {
+				continue
+			}
+			if match, err := NewNamespaceMatcher(p.Namespace); err == nil && match(namespace) {
+				candidates = append(candidates, o)
+				break
+			}
+		}
+	}
+
+	writers := []runtime.Object{}
+	seen := sets.NewString()
+	for _, o := range candidates {
+		m, err := meta.Accessor(o)
+		if err != nil {
+			return nil, err
+		}
+		// Shared objects with both a target and a pattern writing the copy are listed twice
+		if seen.Has(IndexKey(m.GetNamespace(), m.GetName())) {
+			continue
+		}
+		seen.Insert(IndexKey(m.GetNamespace(), m.GetName()))
+		if m.GetDeletionTimestamp() != nil || w.ExcludedNamespaces.Has(m.GetNamespace()) {
+			continue
+		}
+		if w.Source != nil && w.Source(o) == key {
+			continue
+		}
+		writers = append(writers, o)
+	}
+	return writers, nil
+}
+
+// Writers returns the shared objects of every kind writing the copy namespace/name, in no particular order
+func (s CopyWriterSet) Writers(ctx context.Context, namespace, name string) ([]runtime.Object, error) {
+	writers := []runtime.Object{}
+	for _, w := range s {
+		found, err := w.Writers(ctx, namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		writers = append(writers, found...)
+	}
+	return writers, nil
+}
+
+// Winner returns the shared object taking precedence over self in writing the copy namespace/name,
+// or nil when self may write it. Only shared objects able to write the copy count, so one whose source is
+// missing doesn't keep the copy from others.
+func (s CopyWriterSet) Winner(ctx context.Context, self runtime.Object, namespace, name string) (runtime.Object, error) {
+	selfRef := RefOf(self)
+
+	var winner runtime.Object
+	for _, w := range s {
+		writers, err := w.Writers(ctx, namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range writers {
+			if RefOf(o) == selfRef {
+				continue
+			}
+			if !precedes(o, self) || !w.writes(o, namespace, name) {
+				continue
+			}
+			if winner == nil || precedes(o, winner) {
+				winner = o
+			}
+		}
+	}
+	return winner, nil
+}
+
+// writes reports whether a shared object writes the copy namespace/name: its source was found, it wasn't
+// reconciled yet, or its status lists the copy as synced
+func (w *CopyWriters) writes(o runtime.Object, namespace, name string) bool {
+	source, targets := sharedObjectStatus(o)
+	if source == "" || source == sourceFound {
+		return true
+	}
+	for _, t := range targets {
+		if t.Namespace == namespace && t.Name == name && t.Kind == w.TargetKind {
+			return t.State == tattletalev1beta1.TargetStateSynced
+		}
+	}
+	return false
+}
+
+// precedes is Precedes for shared objects of any kind. A SharedSecret and a SharedConfigMap sharing a
+// namespace and name are told apart by their kind.
+func precedes(a, b runtime.Object) bool {
+	aMeta, err := meta.Accessor(a)
+	if err != nil {
+		return false
+	}
+	bMeta, err := meta.Accessor(b)
+	if err != nil {
+		return false
+	}
+	aPriority, bPriority := sharedObjectPriority(a), sharedObjectPriority(b)
+	if Precedes(aMeta, aPriority, bMeta, bPriority) {
+		return true
+	}
+	if Precedes(bMeta, bPriority, aMeta, aPriority) {
+		return false
+	}
+	return RefOf(a).Kind < RefOf(b).Kind
+}
+
+// The status of the source of shared objects that read it, see the controllers
+const sourceFound = "Found"
+
+// sharedObjectStatus returns the status of the source and the copies of a shared object
+func sharedObjectStatus(o runtime.Object) (string, []tattletalev1beta1.TargetStatus) {
+	switch obj := o.(type) {
+	case *tattletalev1beta1.SharedSecret:
+		return obj.Status.SourceSecret, obj.Status.Targets
+	case *tattletalev1beta1.SharedConfigMap:
+		return obj.Status.SourceConfigMap, obj.Status.Targets
+	case *tattletalev1beta1.SharedResource:
+		return obj.Status.Source, obj.Status.Targets
+	}
+	return "", nil
+}
+
+func sharedObjectPriority(o runtime.Object) int32 {
+	switch obj := o.(type) {
+	case *tattletalev1beta1.SharedSecret:
+		return obj.Spec.Priority
+	case *tattletalev1beta1.SharedConfigMap:
+		return obj.Spec.Priority
+	}
+	return 0
+}
+
+// ConditionMapper maps an event on a shared object to the shared objects of the same kind with one of the
+// given conditions set to True, e.g. those that lost a copy to another one, so they take it over once the
+// winner is deleted or stops writing it. They are looked up in the ConditionIndex.
+type ConditionMapper struct {
+	Reader client.Reader
+
+	// Returns an empty list of the shared object kind to query
+	NewList func() runtime.Object
+
+	// The conditions mapped on
+	Types []tattletalev1beta1.ConditionType
+}
+
+func (m *ConditionMapper) Map(o handler.MapObject) []reconcile.Request {
+	requests := []reconcile.Request{}
+	seen := map[types.NamespacedName]bool{}
+	for _, t := range m.Types {
+		list := m.NewList()
+		if err := m.Reader.List(context.Background(), list, client.MatchingField(ConditionIndex, string(t))); err != nil {
+			handlerLog.Error(err, "unable to list shared objects", "index", ConditionIndex, "key", t)
+			continue
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			handlerLog.Error(err, "unable to extract shared objects", "index", ConditionIndex, "key", t)
+			continue
+		}
+		for _, item := range items {
+			accessor, err := meta.Accessor(item)
+			if err != nil {
+				continue
+			}
+			name := types.NamespacedName{Namespace: accessor.GetNamespace(), Name: accessor.GetName()}
+			if seen[name] || (name.Namespace == o.Meta.GetNamespace() && name.Name == o.Meta.GetName()) {
+				continue
+			}
+			seen[name] = true
+			requests = append(requests, reconcile.Request{NamespacedName: name})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,231 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+)
+
+var conflictCreated = time.Date(2019, 9, 1, 12, 0, 0, 0, time.UTC)
+
+// conflictWriter returns a SharedSecret copying db-credentials, created age before the others
+func conflictWriter(i int, priority int32, age time.Duration, targets ...tattletalev1beta1.TargetSecret) *tattletalev1beta1.SharedSecret {
+	s := newSharedSecret(i, targets...)
+	s.Spec.SourceSecret = "db-credentials"
+	s.Spec.Priority = priority
+	s.CreationTimestamp = metav1.NewTime(conflictCreated.Add(-age))
+	return s
+}
+
+func TestPrecedes(t *testing.T) {
+	// Precedence goes to the higher priority, then the older object, then the name
+	tests := []struct {
+		name string
+		a, b *tattletalev1beta1.SharedSecret
+		want bool
+	}{
+		{name: "higher priority", a: conflictWriter(1, 1, 0), b: conflictWriter(2, 0, time.Hour), want: true},
+		{name: "older", a: conflictWriter(1, 0, time.Hour), b: conflictWriter(2, 0, 0), want: true},
+		{name: "younger", a: conflictWriter(2, 0, 0), b: conflictWriter(1, 0, time.Hour)},
+		{name: "lower name", a: conflictWriter(1, 0, 0), b: conflictWriter(2, 0, 0), want: true},
+		{name: "higher name", a: conflictWriter(2, 0, 0), b: conflictWriter(1, 0, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Precedes(tt.a, tt.a.Spec.Priority, tt.b, tt.b.Spec.Priority); got != tt.want {
+				t.Errorf("Precedes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// checkWinner fails the test unless the shared object taking precedence in writing namespace/name is want
+func checkWinner(t *testing.T, writers CopyWriterSet, self runtime.Object, namespace, name string, want *SharedObjectRef) {
+	t.Helper()
+	winner, err := writers.Winner(context.Background(), self, namespace, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	switch {
+	case want == nil && winner != nil:
+		t.Errorf("winner = %v, want none", RefOf(winner))
+	case want != nil && winner == nil:
+		t.Errorf("no winner, want %v", *want)
+	case want != nil && RefOf(winner) != *want:
+		t.Errorf("winner = %v, want %v", RefOf(winner), *want)
+	}
+}
+
+func sharedSecretRef(s *tattletalev1beta1.SharedSecret) *SharedObjectRef {
+	return &SharedObjectRef{Kind: KindSharedSecret, Namespace: s.Namespace, Name: s.Name}
+}
+
+func TestWinner(t *testing.T) {
+	older := conflictWriter(1, 0, time.Hour, tattletalev1beta1.TargetSecret{Namespace: "team-a"})
+	pattern := conflictWriter(2, 5, 0, tattletalev1beta1.TargetSecret{Namespace: "team-*"})
+	self := conflictWriter(3, 0, 0, tattletalev1beta1.TargetSecret{Namespace: "team-a"}, tattletalev1beta1.TargetSecret{Namespace: "other"})
+	younger := conflictWriter(4, 0, -time.Hour, tattletalev1beta1.TargetSecret{Namespace: "other"})
+	c, err := newIndexedCache(older, pattern, self, younger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writers := NewSecretWriters(c, sets.NewString())
+
+	// The shared object taking precedence in writing a copy is found
+	checkWinner(t, writers, self, "team-a", "db-credentials", sharedSecretRef(pattern))
+	checkWinner(t, writers, self, "other", "db-credentials", nil)
+	checkWinner(t, writers, younger, "other", "db-credentials", sharedSecretRef(self))
+}
+
+func TestWinnerOfBothKinds(t *testing.T) {
+	self := conflictWriter(1, 0, 0, tattletalev1beta1.TargetSecret{Namespace: "team-a"})
+	// A SharedConfigMap with the same name, writing the same secret
+	configmap := &tattletalev1beta1.SharedConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: self.Namespace, Name: self.Name, CreationTimestamp: self.CreationTimestamp},
+		Spec: tattletalev1beta1.SharedConfigMapSpec{
+			SourceNamespace: "default",
+			SourceConfigMap: "settings",
+			Targets:         []tattletalev1beta1.TargetConfigMap{{Namespace: "team-a", NewName: "db-credentials", Kind: tattletalev1beta1.TargetKindSecret}},
+		},
+	}
+	c, err := newIndexedCache(self, configmap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkWinner(t, NewSecretWriters(c, sets.NewString()), self, "team-a", "db-credentials", &SharedObjectRef{Kind: KindSharedConfigMap, Namespace: "default", Name: self.Name})
+	checkWinner(t, NewSecretWriters(c, sets.NewString()), configmap, "team-a", "db-credentials", nil)
+	// The configmap of the same name is written by the SharedConfigMap's source kind alone
+	checkWinner(t, NewConfigMapWriters(c, sets.NewString()), configmap, "team-a", "db-credentials", nil)
+}
+
+// newSharedResource returns a SharedResource sharing the NetworkPolicy namespace/name
+func newSharedResource(i int, namespace, name string, targets ...tattletalev1beta1.TargetResource) *tattletalev1beta1.SharedResource {
+	return &tattletalev1beta1.SharedResource{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: fmt.Sprintf("sharedresource-%d", i), CreationTimestamp: metav1.NewTime(conflictCreated)},
+		Spec: tattletalev1beta1.SharedResourceSpec{
+			APIVersion:      "networking.k8s.io/v1",
+			Kind:            "NetworkPolicy",
+			SourceNamespace: namespace,
+			SourceName:      name,
+			Targets:         targets,
+		},
+	}
+}
+
+func TestWinnerOfSharedResources(t *testing.T) {
+	older := newSharedResource(1, "default", "deny-all", tattletalev1beta1.TargetResource{Namespace: "team-a"})
+	older.CreationTimestamp = metav1.NewTime(conflictCreated.Add(-time.Hour))
+	self := newSharedResource(2, "default", "deny-all", tattletalev1beta1.TargetResource{Namespace: "team-a"}, tattletalev1beta1.TargetResource{Namespace: "team-b"})
+	// A SharedResource of another kind writing a resource of the same name
+	other := newSharedResource(3, "default", "deny-all", tattletalev1beta1.TargetResource{Namespace: "team-b"})
+	other.Spec.APIVersion, other.Spec.Kind = "v1", "LimitRange"
+	other.CreationTimestamp = older.CreationTimestamp
+	c, err := newIndexedCache(older, self, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writers := NewSharedResourceWriters(c, "NetworkPolicy.networking.k8s.io", sets.NewString())
+
+	checkWinner(t, writers, self, "team-a", "deny-all", &SharedObjectRef{Kind: KindSharedResource, Namespace: "default", Name: older.Name})
+	checkWinner(t, writers, older, "team-a", "deny-all", nil)
+	checkWinner(t, writers, self, "team-b", "deny-all", nil)
+}
+
+func TestWinnerIgnoresObjectsNeverWriting(t *testing.T) {
+	deleted := conflictWriter(1, 0, time.Hour, tattletalev1beta1.TargetSecret{Namespace: "team-a"})
+	deleted.DeletionTimestamp = &metav1.Time{Time: conflictCreated}
+	excluded := conflictWriter(2, 0, time.Hour, tattletalev1beta1.TargetSecret{Namespace: "team-a"})
+	excluded.Namespace = "legacy"
+	// Patterns never match the source of the shared object
+	source := conflictWriter(3, 5, 0, tattletalev1beta1.TargetSecret{Namespace: "*"})
+	source.Spec.SourceNamespace = "team-a"
+	self := conflictWriter(4, 0, 0, tattletalev1beta1.TargetSecret{Namespace: "team-a"})
+	c, err := newIndexedCache(deleted, excluded, source, self)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkWinner(t, NewSecretWriters(c, sets.NewString("legacy")), self, "team-a", "db-credentials", nil)
+}
+
+func TestWinnerOnlyCountsObjectsAbleToWrite(t *testing.T) {
+	missing := conflictWriter(1, 5, 0, tattletalev1beta1.TargetSecret{Namespace: "team-a"})
+	missing.Status.SourceSecret = "Missing"
+	self := conflictWriter(2, 0, 0, tattletalev1beta1.TargetSecret{Namespace: "team-a"}, tattletalev1beta1.TargetSecret{Namespace: "team-b"})
+	self.Status.SourceSecret = "Found"
+	// A source that can't be read right now doesn't hand over the copies synced from it
+	unavailable := conflictWriter(3, 5, 0, tattletalev1beta1.TargetSecret{Namespace: "team-a"})
+	unavailable.Status.SourceSecret = "Unavailable"
+	unavailable.Status.Targets = []tattletalev1beta1.TargetStatus{{Namespace: "team-a", Name: "db-credentials", State: tattletalev1beta1.TargetStateSynced}}
+	// Nor does a shared object that wasn't reconciled yet
+	pending := conflictWriter(4, 1, 0, tattletalev1beta1.TargetSecret{Namespace: "team-b"})
+
+	tests := []struct {
+		name      string
+		objs      []runtime.Object
+		namespace string
+		want      *SharedObjectRef
+	}{
+		{name: "missing source", objs: []runtime.Object{missing, self}, namespace: "team-a"},
+		{name: "unavailable source", objs: []runtime.Object{missing, unavailable, pending, self}, namespace: "team-a", want: sharedSecretRef(unavailable)},
+		{name: "not reconciled yet", objs: []runtime.Object{missing, unavailable, pending, self}, namespace: "team-b", want: sharedSecretRef(pending)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newIndexedCache(tt.objs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkWinner(t, NewSecretWriters(c, sets.NewString()), self, tt.namespace, "db-credentials", tt.want)
+		})
+	}
+}
+
+func TestConditionMapper(t *testing.T) {
+	lost := newSharedSecret(1)
+	lost.Status.Conditions = []tattletalev1beta1.Condition{{Type: tattletalev1beta1.ConditionConflict, Status: corev1.ConditionTrue}}
+	inCycle := newSharedSecret(4)
+	inCycle.Status.Conditions = []tattletalev1beta1.Condition{{Type: tattletalev1beta1.ConditionCycle, Status: corev1.ConditionTrue}}
+	won := newSharedSecret(5)
+	won.Status.Conditions = []tattletalev1beta1.Condition{{Type: tattletalev1beta1.ConditionConflict, Status: corev1.ConditionFalse}}
+	c, err := newIndexedCache(lost, inCycle, won, newSharedSecret(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &ConditionMapper{
+		Reader:  c,
+		NewList: func() runtime.Object { return &tattletalev1beta1.SharedSecretList{} },
+		Types:   []tattletalev1beta1.ConditionType{tattletalev1beta1.ConditionConflict, tattletalev1beta1.ConditionCycle},
+	}
+
+	// A change to a shared object is mapped to the shared objects that lost a copy or are stuck in a cycle
+	winner := newSharedSecret(3)
+	checkRequests(t, m.Map(handler.MapObject{Meta: winner, Object: winner}), 1, 4)
+	checkRequests(t, m.Map(handler.MapObject{Meta: lost, Object: lost}), 4)
+}
@@ -0,0 +1,47 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"unicode/utf8"
+)
+
+// SecretDataFromConfigMap returns the data of a secret holding the values of a configmap. Values of both
+// maps end up in data, the API server base64 encodes them on the wire.
+func SecretDataFromConfigMap(data map[string]string, binaryData map[string][]byte) map[string][]byte {
+	values := make(map[string][]byte, len(data)+len(binaryData))
+	for k, v := range data {
+		values[k] = []byte(v)
+	}
+	for k, v := range binaryData {
+		values[k] = v
+	}
+	return values
+}
+
+// ConfigMapDataFromSecret returns the data and binary data of a configmap holding the given values.
+// ConfigMaps only hold UTF-8 in data, anything else goes to binaryData.
+func ConfigMapDataFromSecret(values map[string][]byte) (map[string]string, map[string][]byte) {
+	data, binaryData := map[string]string{}, map[string][]byte{}
+	for k, v := range values {
+		if utf8.Valid(v) {
+			data[k] = string(v)
+		} else {
+			binaryData[k] = v
+		}
+	}
+	return data, binaryData
+}
@@ -0,0 +1,71 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSecretDataFromConfigMap(t *testing.T) {
+	// Both maps of a configmap end up in the data of a secret
+	got := SecretDataFromConfigMap(
+		map[string]string{"url": "postgres://db:5432"},
+		map[string][]byte{"cert.der": {0x30, 0x82, 0xff}},
+	)
+	want := map[string][]byte{
+		"url":      []byte("postgres://db:5432"),
+		"cert.der": {0x30, 0x82, 0xff},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SecretDataFromConfigMap() = %q, want %q", got, want)
+	}
+}
+
+func TestConfigMapDataFromSecret(t *testing.T) {
+	tests := []struct {
+		name           string
+		values         map[string][]byte
+		wantData       map[string]string
+		wantBinaryData map[string][]byte
+	}{
+		{
+			// Values that aren't UTF-8 are kept in binary data
+			name:           "text and binary values",
+			values:         map[string][]byte{"password": []byte("hunter2"), "key.der": {0x30, 0x82, 0xff}},
+			wantData:       map[string]string{"password": "hunter2"},
+			wantBinaryData: map[string][]byte{"key.der": {0x30, 0x82, 0xff}},
+		},
+		{
+			name:           "invalid UTF-8",
+			values:         map[string][]byte{"a": []byte("text"), "b": {0xc3, 0x28}},
+			wantData:       map[string]string{"a": "text"},
+			wantBinaryData: map[string][]byte{"b": {0xc3, 0x28}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, binaryData := ConfigMapDataFromSecret(tt.values)
+			if !reflect.DeepEqual(data, tt.wantData) || !reflect.DeepEqual(binaryData, tt.wantBinaryData) {
+				t.Errorf("ConfigMapDataFromSecret() = %q, %q, want %q, %q", data, binaryData, tt.wantData, tt.wantBinaryData)
+			}
+			// Values round trip through both kinds
+			if back := SecretDataFromConfigMap(data, binaryData); !reflect.DeepEqual(back, tt.values) {
+				t.Errorf("round trip = %q, want %q", back, tt.values)
+			}
+		})
+	}
+}
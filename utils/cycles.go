@@ -0,0 +1,186 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Kinds of the shared objects in the sharing graph
+const (
+	KindSharedSecret    = "SharedSecret"
+	KindSharedConfigMap = "SharedConfigMap"
+	KindSharedResource  = "SharedResource"
+)
+
+// SharedObjectRef points at a shared object in the sharing graph
+type SharedObjectRef struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// RefOf returns the reference of a SharedSecret, SharedConfigMap or SharedResource, whose kind is left
+// empty for anything else
+func RefOf(o runtime.Object) SharedObjectRef {
+	switch obj := o.(type) {
+	case *tattletalev1beta1.SharedSecret:
+		return SharedObjectRef{Kind: KindSharedSecret, Namespace: obj.Namespace, Name: obj.Name}
+	case *tattletalev1beta1.SharedConfigMap:
+		return SharedObjectRef{Kind: KindSharedConfigMap, Namespace: obj.Namespace, Name: obj.Name}
+	case *tattletalev1beta1.SharedResource:
+		return SharedObjectRef{Kind: KindSharedResource, Namespace: obj.Namespace, Name: obj.Name}
+	}
+	if m, err := meta.Accessor(o); err == nil {
+		return SharedObjectRef{Namespace: m.GetNamespace(), Name: m.GetName()}
+	}
+	return SharedObjectRef{}
+}
+
+func (r SharedObjectRef) String() string {
+	return r.Kind + " " + IndexKey(r.Namespace, r.Name)
+}
+
+// CyclePath renders a cycle as the shared objects data is copied through, e.g.
+// SharedConfigMap team-a/a -> SharedConfigMap team-b/b -> SharedConfigMap team-a/a
+func CyclePath(cycle []SharedObjectRef) string {
+	refs := make([]string, 0, len(cycle))
+	for _, r := range cycle {
+		refs = append(refs, r.String())
+	}
+	return strings.Join(refs, " -> ")
+}
+
+// SharingGraph walks the graph of shared objects reading the copies of other shared objects of any kind,
+// built from the target indexes of the manager's cache. Shared objects with a target namespace pattern are
+// listed once.
+type SharingGraph struct {
+	Reader client.Reader
+
+	secrets    CopyWriterSet
+	configmaps CopyWriterSet
+	// SharedResources only write resources of the kind of their source, see NewSharedResourceWriters
+	excludedNamespaces sets.String
+}
+
+// NewSharingGraph returns the sharing graph of the shared objects the reader holds
+func NewSharingGraph(reader client.Reader, excludedNamespaces sets.String) *SharingGraph {
+	return &SharingGraph{
+		Reader:     reader,
+		secrets:    NewSecretWriters(reader, excludedNamespaces),
+		configmaps: NewConfigMapWriters(reader, excludedNamespaces),
+
+		excludedNamespaces: excludedNamespaces,
+	}
+}
+
+// writersOf returns the shared objects writing the source of a shared object, sorted so the same cycle is
+// always reported the same way. Sources outside of the cluster aren't written by anything.
+func (g *SharingGraph) writersOf(ctx context.Context, ref SharedObjectRef) ([]SharedObjectRef, error) {
+	key := client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}
+	var writers []runtime.Object
+	var err error
+	switch ref.Kind {
+	case KindSharedSecret:
+		var s tattletalev1beta1.SharedSecret
+		if err := g.Reader.Get(ctx, key, &s); err != nil {
+			return nil, client.IgnoreNotFound(err)
+		}
+		if s.Spec.Source != nil {
+			return nil, nil
+		}
+		writers, err = g.secrets.Writers(ctx, s.Spec.SourceNamespace, s.Spec.SourceSecret)
+	case KindSharedConfigMap:
+		var c tattletalev1beta1.SharedConfigMap
+		if err := g.Reader.Get(ctx, key, &c); err != nil {
+			return nil, client.IgnoreNotFound(err)
+		}
+		if c.Spec.Source != nil {
+			return nil, nil
+		}
+		writers, err = g.configmaps.Writers(ctx, c.Spec.SourceNamespace, c.Spec.SourceConfigMap)
+	case KindSharedResource:
+		var r tattletalev1beta1.SharedResource
+		if err := g.Reader.Get(ctx, key, &r); err != nil {
+			return nil, client.IgnoreNotFound(err)
+		}
+		writers, err = NewSharedResourceWriters(g.Reader, sharedResourceGroupKind(&r), g.excludedNamespaces).Writers(ctx, r.Spec.SourceNamespace, r.Spec.SourceName)
+	default:
+		return nil, fmt.Errorf("unknown shared object kind %s", ref.Kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make([]SharedObjectRef, 0, len(writers))
+	for _, o := range writers {
+		refs = append(refs, RefOf(o))
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].String() < refs[j].String() })
+	return refs, nil
+}
+
+// FindCycle returns a cycle of shared objects copying each other's copies through the given one, in the order
+// data is copied and starting and ending with it, or nil when it takes part in none. Chains leading into or
+// out of a cycle aren't part of it, and chains without a cycle are fine.
+func (g *SharingGraph) FindCycle(ctx context.Context, start SharedObjectRef) ([]SharedObjectRef, error) {
+	// Walk upstream from the source of start, a cycle leads back to start
+	path := []SharedObjectRef{start}
+	visited := map[SharedObjectRef]bool{start: true}
+	var visit func(ref SharedObjectRef) (bool, error)
+	visit = func(ref SharedObjectRef) (bool, error) {
+		writers, err := g.writersOf(ctx, ref)
+		if err != nil {
+			return false, err
+		}
+		for _, w := range writers {
+			if w == start {
+				path = append(path, w)
+				return true, nil
+			}
+			if visited[w] {
+				continue
+			}
+			visited[w] = true
+			path = append(path, w)
+			if found, err := visit(w); found || err != nil {
+				return found, err
+			}
+			path = path[:len(path)-1]
+		}
+		return false, nil
+	}
+
+	found, err := visit(start)
+	if err != nil || !found {
+		return nil, err
+	}
+	// The path was walked against the direction data is copied in
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path, nil
+}
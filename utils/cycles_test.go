@@ -0,0 +1,155 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func sharedSecretObjectRef(i int) SharedObjectRef {
+	return SharedObjectRef{Kind: KindSharedSecret, Namespace: "default", Name: newSharedSecret(i).Name}
+}
+
+// newChain returns SharedSecrets of which sharedsecret-1 copies default/secret-1 to team-a/secret-1,
+// sharedsecret-2 copies it on to team-b/secret-1 and sharedsecret-3 copies that back to default/secret-1
+func newChain() []*tattletalev1beta1.SharedSecret {
+	first := newSharedSecret(1, tattletalev1beta1.TargetSecret{Namespace: "team-a"})
+	second := newSharedSecret(2, tattletalev1beta1.TargetSecret{Namespace: "team-b", NewName: "secret-1"})
+	second.Spec.SourceNamespace, second.Spec.SourceSecret = "team-a", "secret-1"
+	third := newSharedSecret(3, tattletalev1beta1.TargetSecret{Namespace: "default", NewName: "secret-1"})
+	third.Spec.SourceNamespace, third.Spec.SourceSecret = "team-b", "secret-1"
+	return []*tattletalev1beta1.SharedSecret{first, second, third}
+}
+
+func TestFindCycle(t *testing.T) {
+	chain := newChain()
+	// Copies the start of the cycle without taking part in it
+	reader := newSharedSecret(4, tattletalev1beta1.TargetSecret{Namespace: "team-c"})
+	reader.Spec.SourceNamespace, reader.Spec.SourceSecret = "team-a", "secret-1"
+	// The last link of the chain, targeting the source of the first through a pattern
+	pattern := chain[2].DeepCopy()
+	pattern.Spec.Targets = []tattletalev1beta1.TargetSecret{{Namespace: "def*", NewName: "secret-1"}}
+
+	tests := []struct {
+		name  string
+		objs  []runtime.Object
+		start int
+		// The cycle in the order data is copied
+		want []int
+	}{
+		{name: "start of a chain", objs: []runtime.Object{chain[0], chain[1]}, start: 1},
+		{name: "end of a chain", objs: []runtime.Object{chain[0], chain[1]}, start: 2},
+		{name: "cycle", objs: []runtime.Object{chain[0], chain[1], chain[2], reader}, start: 1, want: []int{1, 2, 3, 1}},
+		{name: "cycle from another object", objs: []runtime.Object{chain[0], chain[1], chain[2], reader}, start: 2, want: []int{2, 3, 1, 2}},
+		{name: "copy of a cycle", objs: []runtime.Object{chain[0], chain[1], chain[2], reader}, start: 4},
+		{name: "target namespace pattern", objs: []runtime.Object{chain[0], chain[1], pattern}, start: 3, want: []int{3, 1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newIndexedCache(tt.objs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cycle, err := NewSharingGraph(c, sets.NewString()).FindCycle(context.Background(), sharedSecretObjectRef(tt.start))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []SharedObjectRef
+			for _, i := range tt.want {
+				want = append(want, sharedSecretObjectRef(i))
+			}
+			if !reflect.DeepEqual(cycle, want) {
+				t.Errorf("FindCycle() = %v, want %v", cycle, want)
+			}
+		})
+	}
+}
+
+func TestCyclePath(t *testing.T) {
+	cycle := []SharedObjectRef{sharedSecretObjectRef(1), sharedSecretObjectRef(2), sharedSecretObjectRef(3), sharedSecretObjectRef(1)}
+	want := "SharedSecret default/sharedsecret-1 -> SharedSecret default/sharedsecret-2 -> SharedSecret default/sharedsecret-3 -> SharedSecret default/sharedsecret-1"
+	if got := CyclePath(cycle); got != want {
+		t.Errorf("CyclePath() = %q, want %q", got, want)
+	}
+}
+
+func TestFindCycleChangingKind(t *testing.T) {
+	// sharedsecret-1 copies default/secret-1 to the configmap team-a/settings, which a SharedConfigMap
+	// copies back to the secret default/secret-1
+	first := newSharedSecret(1, tattletalev1beta1.TargetSecret{Namespace: "team-a", NewName: "settings", Kind: tattletalev1beta1.TargetKindConfigMap})
+	second := &tattletalev1beta1.SharedConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "sharedconfigmap-1"},
+		Spec: tattletalev1beta1.SharedConfigMapSpec{
+			SourceNamespace: "team-a",
+			SourceConfigMap: "settings",
+			Targets:         []tattletalev1beta1.TargetConfigMap{{Namespace: "default", NewName: "secret-1", Kind: tattletalev1beta1.TargetKindSecret}},
+		},
+	}
+	c, err := newIndexedCache(first, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cycle, err := NewSharingGraph(c, sets.NewString()).FindCycle(context.Background(), sharedSecretObjectRef(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "SharedSecret default/sharedsecret-1 -> SharedConfigMap default/sharedconfigmap-1 -> SharedSecret default/sharedsecret-1"
+	if got := CyclePath(cycle); got != want {
+		t.Errorf("cycle = %q, want %q", got, want)
+	}
+}
+
+func TestFindCycleOfSharedResources(t *testing.T) {
+	// sharedresource-1 copies default/deny-all to team-a/deny-all, which sharedresource-2 copies back
+	first := newSharedResource(1, "default", "deny-all", tattletalev1beta1.TargetResource{Namespace: "team-a"})
+	second := newSharedResource(2, "team-a", "deny-all", tattletalev1beta1.TargetResource{Namespace: "default"})
+	// Copies team-a/deny-all as another kind, which isn't the source of sharedresource-1
+	other := newSharedResource(3, "team-a", "deny-all", tattletalev1beta1.TargetResource{Namespace: "default"})
+	other.Spec.APIVersion, other.Spec.Kind = "v1", "LimitRange"
+
+	tests := []struct {
+		name string
+		objs []runtime.Object
+		want string
+	}{
+		{name: "cycle", objs: []runtime.Object{first, second}, want: "SharedResource default/sharedresource-1 -> SharedResource default/sharedresource-2 -> SharedResource default/sharedresource-1"},
+		{name: "resource of another kind", objs: []runtime.Object{first, other}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newIndexedCache(tt.objs...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cycle, err := NewSharingGraph(c, sets.NewString()).FindCycle(context.Background(), RefOf(first))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := CyclePath(cycle); got != tt.want {
+				t.Errorf("cycle = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HashSecretData returns a stable hash of the data of a secret
+func HashSecretData(data map[string][]byte) string {
+	return hashData(data, nil)
+}
+
+// HashConfigMapData returns a stable hash of the data and binary data of a configmap
+func HashConfigMapData(data map[string]string, binaryData map[string][]byte) string {
+	strs := make(map[string][]byte, len(data))
+	for k, v := range data {
+		strs[k] = []byte(v)
+	}
+	return hashData(strs, binaryData)
+}
+
+func hashData(maps ...map[string][]byte) string {
+	h := sha256.New()
+	for i, m := range maps {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		// Separate the maps so moving a key between Data and BinaryData changes the hash
+		h.Write([]byte{byte(i)})
+		for _, k := range keys {
+			h.Write([]byte(k))
+			h.Write([]byte{0})
+			h.Write(m[k])
+			h.Write([]byte{0})
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// EffectiveDriftPolicy returns the target's drift policy, falling back to the CR's and then to Overwrite
+func EffectiveDriftPolicy(spec, target tattletalev1beta1.DriftPolicy) tattletalev1beta1.DriftPolicy {
+	if target != "" {
+		return target
+	}
+	if spec != "" {
+		return spec
+	}
+	return tattletalev1beta1.DriftPolicyOverwrite
+}
+
+// SyncDecision is the outcome of comparing a copy against its source
+type SyncDecision struct {
+	// Whether the copy should be written
+	Write bool
+	// Whether the copy was changed since tattletale last wrote it
+	Drifted bool
+}
+
+// DecideSync works out whether a copy needs writing.
+// sourceHash is the hash of the source data, recordedHash the hash annotated on the copy when it was last
+// written and currentHash the hash of the data the copy holds right now.
+func DecideSync(policy tattletalev1beta1.DriftPolicy, found bool, sourceHash, recordedHash, currentHash string) SyncDecision {
+	if !found {
+		return SyncDecision{Write: true}
+	}
+	if currentHash == sourceHash && recordedHash == sourceHash {
+		return SyncDecision{}
+	}
+
+	// Copies written before hashes were recorded are treated as ours
+	drifted := recordedHash != "" && currentHash != recordedHash
+	sourceChanged := recordedHash != sourceHash
+
+	switch policy {
+	case tattletalev1beta1.DriftPolicyReport:
+		return SyncDecision{Write: !drifted, Drifted: drifted}
+	case tattletalev1beta1.DriftPolicyIgnore:
+		return SyncDecision{Write: sourceChanged, Drifted: drifted && !sourceChanged}
+	default:
+		return SyncDecision{Write: true, Drifted: drifted}
+	}
+}
+
+// FindTargetStatus returns the previously recorded status of a copy, if any
+func FindTargetStatus(statuses []tattletalev1beta1.TargetStatus, namespace, name string) *tattletalev1beta1.TargetStatus {
+	for i := range statuses {
+		if statuses[i].Namespace == namespace && statuses[i].Name == name {
+			return &statuses[i]
+		}
+	}
+	return nil
+}
+
+// NewTargetStatus builds the status of a copy, carrying over the last sync time unless the copy was just written
+func NewTargetStatus(previous []tattletalev1beta1.TargetStatus, namespace, name string, state tattletalev1beta1.TargetState, hash string, written bool) tattletalev1beta1.TargetStatus {
+	status := tattletalev1beta1.TargetStatus{Namespace: namespace, Name: name, State: state, Hash: hash}
+	if written {
+		now := metav1.Now()
+		status.LastSyncTime = &now
+	} else if prev := FindTargetStatus(previous, namespace, name); prev != nil {
+		status.LastSyncTime = prev.LastSyncTime
+	}
+	return status
+}
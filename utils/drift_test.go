@@ -0,0 +1,81 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"testing"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+)
+
+func TestHashing(t *testing.T) {
+	if HashSecretData(map[string][]byte{"a": []byte("1"), "b": []byte("2")}) != HashSecretData(map[string][]byte{"b": []byte("2"), "a": []byte("1")}) {
+		t.Error("the hash of secret data depends on key order")
+	}
+	if HashConfigMapData(map[string]string{"a": "1"}, nil) == HashConfigMapData(nil, map[string][]byte{"a": []byte("1")}) {
+		t.Error("the hash of configmap data doesn't distinguish data from binary data")
+	}
+}
+
+func TestDecideSync(t *testing.T) {
+	const source, old, edited = "source", "old", "edited"
+
+	tests := []struct {
+		name   string
+		policy tattletalev1beta1.DriftPolicy
+		exists bool
+		// The hash recorded on the copy and the hash of its data
+		recorded, live string
+		want           SyncDecision
+	}{
+		{name: "missing copy, Overwrite", policy: tattletalev1beta1.DriftPolicyOverwrite, want: SyncDecision{Write: true}},
+		{name: "missing copy, Report", policy: tattletalev1beta1.DriftPolicyReport, want: SyncDecision{Write: true}},
+		{name: "missing copy, Ignore", policy: tattletalev1beta1.DriftPolicyIgnore, want: SyncDecision{Write: true}},
+		{name: "in sync", policy: tattletalev1beta1.DriftPolicyOverwrite, exists: true, recorded: source, live: source, want: SyncDecision{}},
+		{name: "drifted, Overwrite", policy: tattletalev1beta1.DriftPolicyOverwrite, exists: true, recorded: source, live: edited, want: SyncDecision{Write: true, Drifted: true}},
+		{name: "drifted, Report", policy: tattletalev1beta1.DriftPolicyReport, exists: true, recorded: source, live: edited, want: SyncDecision{Drifted: true}},
+		{name: "drifted from an old source, Report", policy: tattletalev1beta1.DriftPolicyReport, exists: true, recorded: old, live: edited, want: SyncDecision{Drifted: true}},
+		{name: "old source, Report", policy: tattletalev1beta1.DriftPolicyReport, exists: true, recorded: old, live: old, want: SyncDecision{Write: true}},
+		{name: "drifted, Ignore", policy: tattletalev1beta1.DriftPolicyIgnore, exists: true, recorded: source, live: edited, want: SyncDecision{Drifted: true}},
+		// Drift is ignored until the source changes
+		{name: "drifted from an old source, Ignore", policy: tattletalev1beta1.DriftPolicyIgnore, exists: true, recorded: old, live: edited, want: SyncDecision{Write: true}},
+		// Copies without a recorded hash aren't drifted
+		{name: "no recorded hash", policy: tattletalev1beta1.DriftPolicyReport, exists: true, live: edited, want: SyncDecision{Write: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DecideSync(tt.policy, tt.exists, source, tt.recorded, tt.live); got != tt.want {
+				t.Errorf("DecideSync() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEffectiveDriftPolicy(t *testing.T) {
+	tests := []struct {
+		spec, target tattletalev1beta1.DriftPolicy
+		want         tattletalev1beta1.DriftPolicy
+	}{
+		{want: tattletalev1beta1.DriftPolicyOverwrite},
+		{spec: tattletalev1beta1.DriftPolicyReport, want: tattletalev1beta1.DriftPolicyReport},
+		{spec: tattletalev1beta1.DriftPolicyReport, target: tattletalev1beta1.DriftPolicyIgnore, want: tattletalev1beta1.DriftPolicyIgnore},
+	}
+	for _, tt := range tests {
+		if got := EffectiveDriftPolicy(tt.spec, tt.target); got != tt.want {
+			t.Errorf("EffectiveDriftPolicy(%q, %q) = %q, want %q", tt.spec, tt.target, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// DefaultPublicKeyKey is the key of the public key configmap read when the encryption doesn't name one
+const DefaultPublicKeyKey = "publicKey"
+
+const sealedOverhead = 32 + box.Overhead
+
+// EffectiveEncryption returns the target's encryption, falling back to the CR's. nil means copies are plaintext.
+func EffectiveEncryption(spec, target *tattletalev1beta1.SecretEncryption) *tattletalev1beta1.SecretEncryption {
+	if target != nil {
+		return target
+	}
+	return spec
+}
+
+// ParsePublicKey decodes a base64 encoded Curve25519 public key
+func ParsePublicKey(s string) (*[32]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("public key is not valid base64: %v", err)
+	}
+	if len(b) != 32 {
+		return nil, fmt.Errorf("public key is %d bytes long, not 32", len(b))
+	}
+	var key [32]byte
+	copy(key[:], b)
+	return &key, nil
+}
+
+// KeyFingerprint identifies a public key, so copies are encrypted again when the key is rotated
+func KeyFingerprint(key *[32]byte) string {
+	h := sha256.Sum256(key[:])
+	return hex.EncodeToString(h[:8])
+}
+
+// EncryptedHash is the hash recorded on a copy encrypted to a key. It changes whenever the source or the key does.
+func EncryptedHash(sourceHash, fingerprint string) string {
+	return hashData(map[string][]byte{"source": []byte(sourceHash), "key": []byte(fingerprint)})
+}
+
+// SealSecretData encrypts every value to the public key
+func SealSecretData(data map[string][]byte, key *[32]byte) (map[string][]byte, error) {
+	sealed := make(map[string][]byte, len(data))
+	for k, v := range data {
+		s, err := SealAnonymous(v, key, rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		sealed[k] = s
+	}
+	return sealed, nil
+}
+
+// SealAnonymous encrypts a message to a public key with an ephemeral sender key. The output is the
+// ephemeral public key followed by the box, compatible with libsodium's crypto_box_seal.
+func SealAnonymous(message []byte, recipient *[32]byte, random io.Reader) ([]byte, error) {
+	ephemeralPublic, ephemeralPrivate, err := box.GenerateKey(random)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := sealNonce(ephemeralPublic, recipient)
+	if err != nil {
+		return nil, err
+	}
+	return box.Seal(ephemeralPublic[:], message, nonce, recipient, ephemeralPrivate), nil
+}
+
+// OpenAnonymous decrypts a message sealed with SealAnonymous
+func OpenAnonymous(sealed []byte, publicKey, privateKey *[32]byte) ([]byte, error) {
+	if len(sealed) < sealedOverhead {
+		return nil, errors.New("sealed message is too short")
+	}
+	var ephemeralPublic [32]byte
+	copy(ephemeralPublic[:], sealed[:32])
+	nonce, err := sealNonce(&ephemeralPublic, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	message, ok := box.Open(nil, sealed[32:], nonce, &ephemeralPublic, privateKey)
+	if !ok {
+		return nil, errors.New("unable to decrypt sealed message")
+	}
+	return message, nil
+}
+
+// sealNonce derives the nonce of a sealed box from both public keys, like libsodium
+func sealNonce(ephemeralPublic, recipient *[32]byte) (*[24]byte, error) {
+	h, err := blake2b.New(24, nil)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(ephemeralPublic[:])
+	h.Write(recipient[:])
+	var nonce [24]byte
+	copy(nonce[:], h.Sum(nil))
+	return &nonce, nil
+}
@@ -0,0 +1,125 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+func TestSealSecretData(t *testing.T) {
+	publicKey, privateKey, _ := box.GenerateKey(rand.Reader)
+	otherPublic, otherPrivate, _ := box.GenerateKey(rand.Reader)
+
+	sealed, err := SealSecretData(map[string][]byte{"password": []byte("hunter2")}, publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(sealed["password"]), "hunter2") {
+		t.Errorf("sealed = %q, want the value encrypted", sealed["password"])
+	}
+
+	tests := []struct {
+		name                  string
+		publicKey, privateKey *[32]byte
+		wantErr               bool
+	}{
+		{name: "sealing key", publicKey: publicKey, privateKey: privateKey},
+		{name: "other key", publicKey: otherPublic, privateKey: otherPrivate, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opened, err := OpenAnonymous(sealed["password"], tt.publicKey, tt.privateKey)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("OpenAnonymous() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(opened) != "hunter2" {
+				t.Errorf("OpenAnonymous() = %q, want hunter2", opened)
+			}
+		})
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	publicKey, _, _ := box.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr bool
+	}{
+		{name: "32 bytes", encoded: base64.StdEncoding.EncodeToString(publicKey[:]) + "\n"},
+		{name: "too short", encoded: base64.StdEncoding.EncodeToString([]byte("short")), wantErr: true},
+		{name: "not base64", encoded: "not base64!", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParsePublicKey(tt.encoded)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePublicKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && *key != *publicKey {
+				t.Error("ParsePublicKey() returned another key")
+			}
+		})
+	}
+}
+
+func TestEncryptedHash(t *testing.T) {
+	publicKey, _, _ := box.GenerateKey(rand.Reader)
+	otherPublic, _, _ := box.GenerateKey(rand.Reader)
+
+	// The hash changes when the source or the key changes
+	hash := EncryptedHash("source", KeyFingerprint(publicKey))
+	if hash != EncryptedHash("source", KeyFingerprint(publicKey)) {
+		t.Error("the hash isn't stable")
+	}
+	if hash == EncryptedHash("other", KeyFingerprint(publicKey)) {
+		t.Error("the hash doesn't change with the source")
+	}
+	if hash == EncryptedHash("source", KeyFingerprint(otherPublic)) {
+		t.Error("the hash doesn't change with the key")
+	}
+}
+
+func TestEffectiveEncryption(t *testing.T) {
+	spec := &tattletalev1beta1.SecretEncryption{PublicKeyConfigMap: "spec"}
+	target := &tattletalev1beta1.SecretEncryption{PublicKeyConfigMap: "target"}
+
+	// Targets override the encryption of the shared object
+	tests := []struct {
+		name         string
+		spec, target *tattletalev1beta1.SecretEncryption
+		want         *tattletalev1beta1.SecretEncryption
+	}{
+		{name: "spec", spec: spec, want: spec},
+		{name: "target", spec: spec, target: target, want: target},
+		{name: "none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EffectiveEncryption(tt.spec, tt.target); got != tt.want {
+				t.Errorf("EffectiveEncryption() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
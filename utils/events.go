@@ -0,0 +1,144 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// Reasons of the events emitted on shared objects
+const (
+	EventReasonCreated          = "Created"
+	EventReasonUpdated          = "Updated"
+	EventReasonDeleted          = "Deleted"
+	EventReasonSkipped          = "Skipped"
+	EventReasonConflicted       = "Conflicted"
+	EventReasonFailed           = "Failed"
+	EventReasonSourceMissing    = "SourceMissing"
+	EventReasonNamespaceMissing = "NamespaceMissing"
+	EventReasonForbidden        = "Forbidden"
+	EventReasonKeyMissing       = "KeyMissing"
+	EventReasonDecryptionFailed = "DecryptionFailed"
+	EventReasonInvalid          = "Invalid"
+	EventReasonTargetConflict   = "TargetConflict"
+	EventReasonCycle            = "Cycle"
+)
+
+// RateLimitedRecorder drops events once an object has used up its token bucket,
+// so a CR fanning out to hundreds of namespaces can't flood the API server
+type RateLimitedRecorder struct {
+	recorder record.EventRecorder
+	qps      float32
+	burst    int
+
+	limiters  map[string]*objectLimiter
+	lastSweep time.Time
+	// Returns the current time, replaced in tests
+	now func() time.Time
+	sync.Mutex
+}
+
+// objectLimiter is the token bucket of one object
+type objectLimiter struct {
+	limiter  flowcontrol.RateLimiter
+	lastUsed time.Time
+}
+
+// NewRateLimitedRecorder wraps a recorder with a token bucket of the given qps and burst per involved object
+func NewRateLimitedRecorder(recorder record.EventRecorder, qps float32, burst int) *RateLimitedRecorder {
+	return &RateLimitedRecorder{
+		recorder: recorder,
+		qps:      qps,
+		burst:    burst,
+		limiters: map[string]*objectLimiter{},
+		now:      time.Now,
+	}
+}
+
+// idle is how long a token bucket takes to fill up again. A bucket unused for longer is as good as a new
+// one, so it is dropped rather than kept for objects that may be long gone.
+func (r *RateLimitedRecorder) idle() time.Duration {
+	if r.qps <= 0 {
+		return 0
+	}
+	return time.Duration(float64(r.burst) / float64(r.qps) * float64(time.Second))
+}
+
+func (r *RateLimitedRecorder) allow(object runtime.Object) bool {
+	m, err := meta.Accessor(object)
+	if err != nil {
+		return true
+	}
+	key := fmt.Sprintf("%T/%s/%s", object, m.GetNamespace(), m.GetName())
+
+	r.Lock()
+	defer r.Unlock()
+	now := r.now()
+	r.sweep(now)
+	l, ok := r.limiters[key]
+	if !ok {
+		l = &objectLimiter{limiter: flowcontrol.NewTokenBucketRateLimiter(r.qps, r.burst)}
+		r.limiters[key] = l
+	}
+	l.lastUsed = now
+	return l.limiter.TryAccept()
+}
+
+// sweep drops the token buckets that filled up again, at most once per idle period
+func (r *RateLimitedRecorder) sweep(now time.Time) {
+	idle := r.idle()
+	if idle <= 0 || now.Sub(r.lastSweep) < idle {
+		return
+	}
+	r.lastSweep = now
+	for key, l := range r.limiters {
+		if now.Sub(l.lastUsed) >= idle {
+			delete(r.limiters, key)
+		}
+	}
+}
+
+func (r *RateLimitedRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	if r.allow(object) {
+		r.recorder.Event(object, eventtype, reason, message)
+	}
+}
+
+func (r *RateLimitedRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	if r.allow(object) {
+		r.recorder.Eventf(object, eventtype, reason, messageFmt, args...)
+	}
+}
+
+func (r *RateLimitedRecorder) PastEventf(object runtime.Object, timestamp metav1.Time, eventtype, reason, messageFmt string, args ...interface{}) {
+	if r.allow(object) {
+		r.recorder.PastEventf(object, timestamp, eventtype, reason, messageFmt, args...)
+	}
+}
+
+func (r *RateLimitedRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	if r.allow(object) {
+		r.recorder.AnnotatedEventf(object, annotations, eventtype, reason, messageFmt, args...)
+	}
+}
@@ -0,0 +1,86 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestRateLimitedRecorderBurst(t *testing.T) {
+	fake := record.NewFakeRecorder(10)
+	recorder := NewRateLimitedRecorder(fake, 0.0001, 2)
+
+	first := &tattletalev1beta1.SharedSecret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "first"}}
+	second := &tattletalev1beta1.SharedSecret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "second"}}
+	for i := 0; i < 5; i++ {
+		recorder.Eventf(first, corev1.EventTypeNormal, EventReasonUpdated, "updated %d", i)
+	}
+	recorder.Event(second, corev1.EventTypeWarning, EventReasonFailed, "failed")
+	close(fake.Events)
+
+	// Events are dropped once an object's burst is used up
+	events := []string{}
+	for e := range fake.Events {
+		events = append(events, e)
+	}
+	want := []string{"Normal Updated updated 0", "Normal Updated updated 1", "Warning Failed failed"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+}
+
+func TestRateLimitedRecorderSweep(t *testing.T) {
+	fake := record.NewFakeRecorder(10)
+	// The bucket fills up again after 2s
+	recorder := NewRateLimitedRecorder(fake, 1, 2)
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	recorder.now = func() time.Time { return now }
+	event := func(name string) {
+		recorder.Event(&tattletalev1beta1.SharedSecret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}, corev1.EventTypeNormal, EventReasonUpdated, "updated")
+	}
+
+	for i := 0; i < 3; i++ {
+		event(fmt.Sprint(i))
+	}
+
+	// The token buckets of objects are dropped once they filled up again
+	steps := []struct {
+		after time.Duration
+		want  int
+	}{
+		{after: time.Second, want: 3},
+		{after: 2 * time.Second, want: 1},
+	}
+	for _, step := range steps {
+		now = now.Add(step.after)
+		event("0")
+		if len(recorder.limiters) != step.want {
+			t.Errorf("after %s: %d token buckets, want %d", step.after, len(recorder.limiters), step.want)
+		}
+	}
+	if _, ok := recorder.limiters["*v1beta1.SharedSecret/default/0"]; !ok {
+		t.Error("the token bucket of the active object was dropped")
+	}
+}
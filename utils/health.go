@@ -0,0 +1,182 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var healthLog = logf.Log.WithName("health")
+
+// Checker reports whether a part of the manager is healthy or ready
+type Checker func(req *http.Request) error
+
+// HealthProbes serves the /healthz and /readyz endpoints of the manager.
+// It is started on its own rather than added to the manager, as the manager only starts runnables
+// once its caches have synced and the probes have to answer before that.
+type HealthProbes struct {
+	addr string
+
+	healthChecks map[string]Checker
+	readyChecks  map[string]Checker
+	sync.RWMutex
+}
+
+// NewHealthProbes returns probes served on addr, "0" disables serving them
+func NewHealthProbes(addr string) *HealthProbes {
+	return &HealthProbes{
+		addr:         addr,
+		healthChecks: map[string]Checker{},
+		readyChecks:  map[string]Checker{},
+	}
+}
+
+// AddHealthCheck adds a check to /healthz
+func (h *HealthProbes) AddHealthCheck(name string, check Checker) {
+	h.Lock()
+	defer h.Unlock()
+	h.healthChecks[name] = check
+}
+
+// AddReadyCheck adds a check to /readyz
+func (h *HealthProbes) AddReadyCheck(name string, check Checker) {
+	h.Lock()
+	defer h.Unlock()
+	h.readyChecks[name] = check
+}
+
+// Handler returns the handler serving both endpoints
+func (h *HealthProbes) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, req *http.Request) {
+		h.serveChecks(w, req, h.healthChecks)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, req *http.Request) {
+		h.serveChecks(w, req, h.readyChecks)
+	})
+	return mux
+}
+
+func (h *HealthProbes) serveChecks(w http.ResponseWriter, req *http.Request, checks map[string]Checker) {
+	h.RLock()
+	names := make([]string, 0, len(checks))
+	copied := make(map[string]Checker, len(checks))
+	for name, check := range checks {
+		names = append(names, name)
+		copied[name] = check
+	}
+	h.RUnlock()
+	sort.Strings(names)
+
+	failed := false
+	body := ""
+	for _, name := range names {
+		if err := copied[name](req); err != nil {
+			failed = true
+			body += fmt.Sprintf("[-]%s failed: %v\n", name, err)
+		} else {
+			body += fmt.Sprintf("[+]%s ok\n", name)
+		}
+	}
+
+	if failed {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	fmt.Fprint(w, body)
+}
+
+// Start serves the probes until stop is closed
+func (h *HealthProbes) Start(stop <-chan struct{}) error {
+	if h.addr == "0" {
+		return nil
+	}
+	listener, err := net.Listen("tcp", h.addr)
+	if err != nil {
+		return err
+	}
+
+	server := http.Server{Handler: h.Handler()}
+	go func() {
+		<-stop
+		if err := server.Shutdown(context.Background()); err != nil {
+			healthLog.Error(err, "problem shutting down health probes")
+		}
+	}()
+
+	healthLog.Info("serving health probes", "addr", h.addr)
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Ping is a Checker that always passes, answering shows the process isn't wedged
+func Ping(_ *http.Request) error {
+	return nil
+}
+
+// IndexWarmup is a manager runnable that queries every field index once the caches have synced,
+// so the manager only reports ready once watch events can be mapped back to shared objects.
+// It runs on every replica, not only on the leader, so standby replicas report ready too.
+type IndexWarmup struct {
+	Reader client.Reader
+	// One list per shared object kind
+	Lists   []runtime.Object
+	Indexes []string
+
+	ready int32
+}
+
+// Start runs the warm-up. The manager only starts it after its caches have synced.
+func (w *IndexWarmup) Start(stop <-chan struct{}) error {
+	for _, list := range w.Lists {
+		for _, index := range w.Indexes {
+			if err := w.Reader.List(context.Background(), list, client.MatchingField(index, "")); err != nil {
+				return fmt.Errorf("warming up index %s: %v", index, err)
+			}
+		}
+	}
+	atomic.StoreInt32(&w.ready, 1)
+	healthLog.Info("caches synced and indexes warmed up")
+	<-stop
+	return nil
+}
+
+// NeedLeaderElection implements the LeaderElectionRunnable interface
+func (w *IndexWarmup) NeedLeaderElection() bool {
+	return false
+}
+
+// Check is a Checker passing once the warm-up completed
+func (w *IndexWarmup) Check(_ *http.Request) error {
+	if atomic.LoadInt32(&w.ready) == 0 {
+		return errors.New("caches not synced yet")
+	}
+	return nil
+}
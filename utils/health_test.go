@@ -0,0 +1,90 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestHealthProbes(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := tattletalev1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	warmup := &IndexWarmup{
+		Reader: fake.NewFakeClientWithScheme(scheme),
+		Lists:  []runtime.Object{&tattletalev1beta1.SharedSecretList{}},
+		// The fake client ignores field selectors, so any index name does
+		Indexes: []string{SourceIndex},
+	}
+
+	probes := NewHealthProbes("0")
+	probes.AddHealthCheck("ping", Ping)
+	probes.AddReadyCheck("informers", warmup.Check)
+	server := httptest.NewServer(probes.Handler())
+	defer server.Close()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(body)
+	}
+
+	if code, _ := get("/healthz"); code != http.StatusOK {
+		t.Errorf("/healthz = %d, want 200", code)
+	}
+	// Ready is only reported once the index warm-up ran
+	if code, body := get("/readyz"); code != http.StatusServiceUnavailable || !strings.Contains(body, "[-]informers failed") {
+		t.Errorf("/readyz = %d %q before the warm-up, want 503", code, body)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		if err := warmup.Start(stop); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		code, _ := get("/readyz")
+		if code == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("/readyz = %d after the warm-up, want 200", code)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
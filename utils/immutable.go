@@ -0,0 +1,104 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+)
+
+// DefaultKeepGenerations is the number of older generations of an immutable copy kept when unset
+const DefaultKeepGenerations = 2
+
+// ImmutableName returns the name of the generation of a copy holding data of the given hash
+func ImmutableName(name, hash string) string {
+	if len(hash) > 10 {
+		hash = hash[:10]
+	}
+	return name + "-" + hash
+}
+
+// ImmutableGenerationName returns the name of the n-th generation of a copy holding data of the given hash.
+// Generations are never changed in place, one that drifted is replaced by the next.
+func ImmutableGenerationName(name, hash string, n int) string {
+	if n == 0 {
+		return ImmutableName(name, hash)
+	}
+	return fmt.Sprintf("%s-%d", ImmutableName(name, hash), n)
+}
+
+// ImmutableGeneration returns n of the generation current is named after among the generations of a copy
+// holding data of the given hash, 0 when it isn't one of them
+func ImmutableGeneration(current, name, hash string) int {
+	prefix := ImmutableName(name, hash) + "-"
+	if !strings.HasPrefix(current, prefix) {
+		return 0
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(current, prefix))
+	if err != nil || n < 1 {
+		return 0
+	}
+	return n
+}
+
+// ImmutableLabels returns the labels and annotations marking an object as a generation of a copy
+func ImmutableLabels(name string) (labels, annotations map[string]string) {
+	return map[string]string{tattletalev1beta1.ImmutableLabel: "true"},
+		map[string]string{tattletalev1beta1.CopyOfAnnotation: name}
+}
+
+// Generation is an existing generation of an immutable copy
+type Generation struct {
+	Name    string
+	Created time.Time
+}
+
+// ExpiredGenerations returns the names of the generations to delete. The current generation is
+// always kept, of the others the newest keep are kept unless they are older than maxAge.
+func ExpiredGenerations(config *tattletalev1beta1.ImmutableCopies, generations []Generation, current string, now time.Time) []string {
+	keep := DefaultKeepGenerations
+	if config.KeepGenerations != nil {
+		keep = int(*config.KeepGenerations)
+	}
+
+	older := []Generation{}
+	for _, g := range generations {
+		if g.Name != current {
+			older = append(older, g)
+		}
+	}
+	// Newest first, by name when created at the same second so the result is stable
+	sort.Slice(older, func(i, j int) bool {
+		if !older[i].Created.Equal(older[j].Created) {
+			return older[i].Created.After(older[j].Created)
+		}
+		return older[i].Name < older[j].Name
+	})
+
+	expired := []string{}
+	for i, g := range older {
+		tooOld := config.MaxAge != nil && now.Sub(g.Created) > config.MaxAge.Duration
+		if i >= keep || tooOld {
+			expired = append(expired, g.Name)
+		}
+	}
+	return expired
+}
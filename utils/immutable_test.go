@@ -0,0 +1,111 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestImmutableName(t *testing.T) {
+	// Generations are named after a prefix of the hash
+	name := ImmutableName("app", HashSecretData(map[string][]byte{"a": []byte("b")}))
+	if !regexp.MustCompile("^app-[0-9a-f]{10}$").MatchString(name) {
+		t.Errorf("ImmutableName() = %q, want app- and 10 hex digits", name)
+	}
+}
+
+func TestImmutableGeneration(t *testing.T) {
+	hash := HashSecretData(map[string][]byte{"a": []byte("b")})
+	first := ImmutableName("app", hash)
+
+	// Generations replacing drifted ones are named after the first
+	tests := []struct {
+		name string
+		n    int
+	}{
+		{name: first},
+		{name: first + "-2", n: 2},
+	}
+	for _, tt := range tests {
+		if got := ImmutableGenerationName("app", hash, tt.n); got != tt.name {
+			t.Errorf("ImmutableGenerationName(%d) = %q, want %q", tt.n, got, tt.name)
+		}
+		if got := ImmutableGeneration(tt.name, "app", hash); got != tt.n {
+			t.Errorf("ImmutableGeneration(%q) = %d, want %d", tt.name, got, tt.n)
+		}
+	}
+
+	// Names of other hashes, or not ending with a generation, are the first generation
+	for _, current := range []string{first + "-x", ImmutableName("app", HashSecretData(nil)) + "-2"} {
+		if got := ImmutableGeneration(current, "app", hash); got != 0 {
+			t.Errorf("ImmutableGeneration(%q) = %d, want 0", current, got)
+		}
+	}
+}
+
+func TestExpiredGenerations(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	generations := []Generation{
+		{Name: "app-current", Created: now.Add(-1 * time.Minute)},
+		{Name: "app-1h", Created: now.Add(-1 * time.Hour)},
+		{Name: "app-2h", Created: now.Add(-2 * time.Hour)},
+		{Name: "app-3h", Created: now.Add(-3 * time.Hour)},
+		{Name: "app-4h", Created: now.Add(-4 * time.Hour)},
+	}
+	keep := int32(0)
+
+	tests := []struct {
+		name    string
+		config  *tattletalev1beta1.ImmutableCopies
+		current string
+		want    []string
+	}{
+		{
+			// Two older generations are kept by default
+			name:    "default",
+			config:  &tattletalev1beta1.ImmutableCopies{},
+			current: "app-current",
+			want:    []string{"app-3h", "app-4h"},
+		},
+		{
+			name:    "keep generations",
+			config:  &tattletalev1beta1.ImmutableCopies{KeepGenerations: &keep},
+			current: "app-current",
+			want:    []string{"app-1h", "app-2h", "app-3h", "app-4h"},
+		},
+		{
+			// Generations past their max age are deleted, but never the current one
+			name:    "max age",
+			config:  &tattletalev1beta1.ImmutableCopies{MaxAge: &metav1.Duration{Duration: 90 * time.Minute}},
+			current: "app-4h",
+			want:    []string{"app-2h", "app-3h"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExpiredGenerations(tt.config, generations, tt.current, now); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExpiredGenerations() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,535 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var (
+	handlerLog = ctrl.Log.WithName("handler")
+)
+
+// Field indexes registered on the manager's cache for shared objects
+const (
+	// The "namespace/name" of the source object
+	SourceIndex = "spec.sourceRef"
+	// The "namespace/name" of every copy of the kind of the source
+	TargetIndex = "spec.targets"
+	// The "namespace/name" of every copy of the other kind, ConfigMaps written by SharedSecrets and
+	// Secrets written by SharedConfigMaps
+	CrossKindTargetIndex = "spec.targets.crossKind"
+	// The namespace of every copy
+	TargetNamespaceIndex = "spec.targets.namespace"
+	// Holds PatternIndexKey for shared objects with a target namespace pattern
+	TargetNamespacePatternIndex = "spec.targets.namespacePattern"
+	// The "namespace/name" of every public key configmap copies of a SharedSecret are encrypted to
+	EncryptionKeyIndex = "spec.encryption.publicKeyConfigMap"
+	// The "namespace/name" of the configmap holding the encrypted source of a SharedSecret
+	SourceConfigMapIndex = "spec.source.sops.configMap"
+	// The types of the conditions set to True, e.g. Conflict for shared objects that lost a copy
+	ConditionIndex = "status.conditions.true"
+)
+
+// PatternIndexKey is the value stored in the target namespace pattern index
+const PatternIndexKey = "pattern"
+
+// IndexKey returns the value stored in the source and target indexes for an object
+func IndexKey(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+// ResourceIndexKey returns the value stored in the source and target indexes for a resource of any kind
+func ResourceIndexKey(groupKind, namespace, name string) string {
+	return groupKind + ":" + IndexKey(namespace, name)
+}
+
+// RegisterSharedSecretIndexes adds the source and target indexes for SharedSecrets to the indexer
+func RegisterSharedSecretIndexes(indexer client.FieldIndexer) error {
+	obj := &tattletalev1beta1.SharedSecret{}
+	if err := indexer.IndexField(obj, SourceIndex, func(o runtime.Object) []string {
+		s := o.(*tattletalev1beta1.SharedSecret)
+		// Sources outside of the cluster are polled rather than watched, encrypted sources are
+		// decrypted again when their key changes
+		if s.Spec.Source != nil {
+			if s.Spec.Source.SOPS != nil {
+				return []string{IndexKey(s.Namespace, s.Spec.Source.SOPS.AgeKeySecretRef.Name)}
+			}
+			return nil
+		}
+		return []string{IndexKey(s.Spec.SourceNamespace, s.Spec.SourceSecret)}
+	}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(obj, TargetIndex, func(o runtime.Object) []string {
+		s := o.(*tattletalev1beta1.SharedSecret)
+		keys := make([]string, 0, len(s.Spec.Targets))
+		for _, t := range s.Spec.Targets {
+			if !IsNamespacePattern(t.Namespace) && s.TargetKind(t) == tattletalev1beta1.TargetKindSecret {
+				keys = append(keys, IndexKey(t.Namespace, s.TargetName(t)))
+			}
+		}
+		return keys
+	}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(obj, CrossKindTargetIndex, func(o runtime.Object) []string {
+		s := o.(*tattletalev1beta1.SharedSecret)
+		keys := []string{}
+		for _, t := range s.Spec.Targets {
+			if !IsNamespacePattern(t.Namespace) && s.TargetKind(t) != tattletalev1beta1.TargetKindSecret {
+				keys = append(keys, IndexKey(t.Namespace, s.TargetName(t)))
+			}
+		}
+		return keys
+	}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(obj, TargetNamespaceIndex, func(o runtime.Object) []string {
+		s := o.(*tattletalev1beta1.SharedSecret)
+		namespaces := make([]string, 0, len(s.Spec.Targets))
+		for _, t := range s.Spec.Targets {
+			if !IsNamespacePattern(t.Namespace) {
+				namespaces = append(namespaces, t.Namespace)
+			}
+		}
+		return namespaces
+	}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(obj, TargetNamespacePatternIndex, func(o runtime.Object) []string {
+		return patternIndexKeys(append(SharedSecretTargetPatterns(o), SharedSecretCrossKindPatterns(o)...))
+	}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(obj, EncryptionKeyIndex, func(o runtime.Object) []string {
+		s := o.(*tattletalev1beta1.SharedSecret)
+		keys := []string{}
+		for _, t := range s.Spec.Targets {
+			if encryption := EffectiveEncryption(s.Spec.Encryption, t.Encryption); encryption != nil && !IsNamespacePattern(t.Namespace) {
+				keys = append(keys, IndexKey(t.Namespace, encryption.PublicKeyConfigMap))
+			}
+		}
+		return keys
+	}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(obj, SourceConfigMapIndex, func(o runtime.Object) []string {
+		s := o.(*tattletalev1beta1.SharedSecret)
+		if s.Spec.Source == nil || s.Spec.Source.SOPS == nil {
+			return nil
+		}
+		return []string{IndexKey(s.Namespace, s.Spec.Source.SOPS.ConfigMap)}
+	}); err != nil {
+		return err
+	}
+	return indexer.IndexField(obj, ConditionIndex, func(o runtime.Object) []string {
+		return conditionIndexKeys(o.(*tattletalev1beta1.SharedSecret).Status.Conditions)
+	})
+}
+
+// RegisterSharedConfigMapIndexes adds the source and target indexes for SharedConfigMaps to the indexer
+func RegisterSharedConfigMapIndexes(indexer client.FieldIndexer) error {
+	obj := &tattletalev1beta1.SharedConfigMap{}
+	if err := indexer.IndexField(obj, SourceIndex, func(o runtime.Object) []string {
+		c := o.(*tattletalev1beta1.SharedConfigMap)
+		// Sources outside of the cluster are polled rather than watched
+		if c.Spec.Source != nil {
+			return nil
+		}
+		return []string{IndexKey(c.Spec.SourceNamespace, c.Spec.SourceConfigMap)}
+	}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(obj, TargetIndex, func(o runtime.Object) []string {
+		c := o.(*tattletalev1beta1.SharedConfigMap)
+		keys := make([]string, 0, len(c.Spec.Targets))
+		for _, t := range c.Spec.Targets {
+			if !IsNamespacePattern(t.Namespace) && c.TargetKind(t) == tattletalev1beta1.TargetKindConfigMap {
+				keys = append(keys, IndexKey(t.Namespace, c.TargetName(t)))
+			}
+		}
+		return keys
+	}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(obj, CrossKindTargetIndex, func(o runtime.Object) []string {
+		c := o.(*tattletalev1beta1.SharedConfigMap)
+		keys := []string{}
+		for _, t := range c.Spec.Targets {
+			if !IsNamespacePattern(t.Namespace) && c.TargetKind(t) != tattletalev1beta1.TargetKindConfigMap {
+				keys = append(keys, IndexKey(t.Namespace, c.TargetName(t)))
+			}
+		}
+		return keys
+	}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(obj, TargetNamespaceIndex, func(o runtime.Object) []string {
+		c := o.(*tattletalev1beta1.SharedConfigMap)
+		namespaces := make([]string, 0, len(c.Spec.Targets))
+		for _, t := range c.Spec.Targets {
+			if !IsNamespacePattern(t.Namespace) {
+				namespaces = append(namespaces, t.Namespace)
+			}
+		}
+		return namespaces
+	}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(obj, TargetNamespacePatternIndex, func(o runtime.Object) []string {
+		return patternIndexKeys(append(SharedConfigMapTargetPatterns(o), SharedConfigMapCrossKindPatterns(o)...))
+	}); err != nil {
+		return err
+	}
+	return indexer.IndexField(obj, ConditionIndex, func(o runtime.Object) []string {
+		return conditionIndexKeys(o.(*tattletalev1beta1.SharedConfigMap).Status.Conditions)
+	})
+}
+
+// TargetPattern is a target of a shared object whose namespace is a pattern
+type TargetPattern struct {
+	// The target namespace pattern
+	Namespace string
+	// The name of the copies written in every matching namespace
+	Name string
+}
+
+// SharedSecretTargetPatterns returns the targets of a SharedSecret whose namespace is a pattern, writing secrets
+func SharedSecretTargetPatterns(o runtime.Object) []TargetPattern {
+	s := o.(*tattletalev1beta1.SharedSecret)
+	patterns := []TargetPattern{}
+	for _, t := range s.Spec.Targets {
+		if IsNamespacePattern(t.Namespace) && s.TargetKind(t) == tattletalev1beta1.TargetKindSecret {
+			patterns = append(patterns, TargetPattern{Namespace: t.Namespace, Name: s.TargetName(t)})
+		}
+	}
+	return patterns
+}
+
+// SharedSecretCrossKindPatterns returns the targets of a SharedSecret whose namespace is a pattern, writing configmaps
+func SharedSecretCrossKindPatterns(o runtime.Object) []TargetPattern {
+	s := o.(*tattletalev1beta1.SharedSecret)
+	patterns := []TargetPattern{}
+	for _, t := range s.Spec.Targets {
+		if IsNamespacePattern(t.Namespace) && s.TargetKind(t) != tattletalev1beta1.TargetKindSecret {
+			patterns = append(patterns, TargetPattern{Namespace: t.Namespace, Name: s.TargetName(t)})
+		}
+	}
+	return patterns
+}
+
+// SharedSecretEncryptionKeyPatterns returns the public key configmaps read in every namespace matching
+// a target namespace pattern of a SharedSecret
+func SharedSecretEncryptionKeyPatterns(o runtime.Object) []TargetPattern {
+	s := o.(*tattletalev1beta1.SharedSecret)
+	patterns := []TargetPattern{}
+	for _, t := range s.Spec.Targets {
+		if encryption := EffectiveEncryption(s.Spec.Encryption, t.Encryption); encryption != nil && IsNamespacePattern(t.Namespace) {
+			patterns = append(patterns, TargetPattern{Namespace: t.Namespace, Name: encryption.PublicKeyConfigMap})
+		}
+	}
+	return patterns
+}
+
+// SharedConfigMapTargetPatterns returns the targets of a SharedConfigMap whose namespace is a pattern, writing configmaps
+func SharedConfigMapTargetPatterns(o runtime.Object) []TargetPattern {
+	c := o.(*tattletalev1beta1.SharedConfigMap)
+	patterns := []TargetPattern{}
+	for _, t := range c.Spec.Targets {
+		if IsNamespacePattern(t.Namespace) && c.TargetKind(t) == tattletalev1beta1.TargetKindConfigMap {
+			patterns = append(patterns, TargetPattern{Namespace: t.Namespace, Name: c.TargetName(t)})
+		}
+	}
+	return patterns
+}
+
+// SharedConfigMapCrossKindPatterns returns the targets of a SharedConfigMap whose namespace is a pattern, writing secrets
+func SharedConfigMapCrossKindPatterns(o runtime.Object) []TargetPattern {
+	c := o.(*tattletalev1beta1.SharedConfigMap)
+	patterns := []TargetPattern{}
+	for _, t := range c.Spec.Targets {
+		if IsNamespacePattern(t.Namespace) && c.TargetKind(t) != tattletalev1beta1.TargetKindConfigMap {
+			patterns = append(patterns, TargetPattern{Namespace: t.Namespace, Name: c.TargetName(t)})
+		}
+	}
+	return patterns
+}
+
+func patternIndexKeys(patterns []TargetPattern) []string {
+	if len(patterns) == 0 {
+		return nil
+	}
+	return []string{PatternIndexKey}
+}
+
+func conditionIndexKeys(conditions []tattletalev1beta1.Condition) []string {
+	keys := []string{}
+	for _, c := range conditions {
+		if c.Status == corev1.ConditionTrue {
+			keys = append(keys, string(c.Type))
+		}
+	}
+	return keys
+}
+
+// RegisterSharedResourceIndexes adds the source, target and condition indexes for SharedResources to the indexer.
+// Source and target keys are prefixed with the group and kind of the resource.
+func RegisterSharedResourceIndexes(indexer client.FieldIndexer) error {
+	obj := &tattletalev1beta1.SharedResource{}
+	if err := indexer.IndexField(obj, SourceIndex, func(o runtime.Object) []string {
+		r := o.(*tattletalev1beta1.SharedResource)
+		return []string{ResourceIndexKey(sharedResourceGroupKind(r), r.Spec.SourceNamespace, r.Spec.SourceName)}
+	}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(obj, TargetIndex, func(o runtime.Object) []string {
+		r := o.(*tattletalev1beta1.SharedResource)
+		keys := make([]string, 0, len(r.Spec.Targets))
+		for _, t := range r.Spec.Targets {
+			name := t.NewName
+			if name == "" {
+				name = r.Spec.SourceName
+			}
+			keys = append(keys, ResourceIndexKey(sharedResourceGroupKind(r), t.Namespace, name))
+		}
+		return keys
+	}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(obj, TargetNamespaceIndex, func(o runtime.Object) []string {
+		r := o.(*tattletalev1beta1.SharedResource)
+		namespaces := make([]string, 0, len(r.Spec.Targets))
+		for _, t := range r.Spec.Targets {
+			namespaces = append(namespaces, t.Namespace)
+		}
+		return namespaces
+	}); err != nil {
+		return err
+	}
+	return indexer.IndexField(obj, ConditionIndex, func(o runtime.Object) []string {
+		return conditionIndexKeys(o.(*tattletalev1beta1.SharedResource).Status.Conditions)
+	})
+}
+
+func sharedResourceGroupKind(r *tattletalev1beta1.SharedResource) string {
+	return schema.FromAPIVersionAndKind(r.Spec.APIVersion, r.Spec.Kind).GroupKind().String()
+}
+
+// IndexMapper maps an event on an object to the shared objects that reference it in any of the given indexes
+type IndexMapper struct {
+	Reader client.Reader
+
+	// Returns an empty list of the shared object kind to query
+	NewList func() runtime.Object
+
+	Indexes []string
+
+	// Set when the indexes hold keys of resources of any kind, see ResourceIndexKey
+	GroupKind string
+}
+
+func (m *IndexMapper) Map(o handler.MapObject) []reconcile.Request {
+	name := o.Meta.GetName()
+	// Generations of immutable copies are indexed under the name of the target they are a copy of
+	if copyOf, ok := o.Meta.GetAnnotations()[tattletalev1beta1.CopyOfAnnotation]; ok {
+		name = copyOf
+	}
+	key := IndexKey(o.Meta.GetNamespace(), name)
+	if m.GroupKind != "" {
+		key = ResourceIndexKey(m.GroupKind, o.Meta.GetNamespace(), name)
+	}
+	requests := []reconcile.Request{}
+	seen := map[types.NamespacedName]bool{}
+
+	for _, index := range m.Indexes {
+		list := m.NewList()
+		if err := m.Reader.List(context.Background(), list, client.MatchingField(index, key)); err != nil {
+			handlerLog.Error(err, "unable to list shared objects", "index", index, "key", key)
+			continue
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			handlerLog.Error(err, "unable to extract shared objects", "index", index, "key", key)
+			continue
+		}
+		for _, item := range items {
+			accessor, err := meta.Accessor(item)
+			if err != nil {
+				continue
+			}
+			name := types.NamespacedName{Namespace: accessor.GetNamespace(), Name: accessor.GetName()}
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			requests = append(requests, reconcile.Request{NamespacedName: name})
+		}
+	}
+
+	if len(requests) > 0 {
+		handlerLog.V(1).Info("Handling event", "object", key, "kind", fmt.Sprintf("%T", o.Object), "requests", len(requests))
+	}
+	return requests
+}
+
+// PatternIndex holds the shared objects of one kind with a target namespace pattern, along with their compiled
+// patterns. Reconcilers update it once per reconcile, so events on copies and namespaces are mapped without
+// listing shared objects or parsing their patterns again.
+type PatternIndex struct {
+	// Returns every target namespace pattern of a shared object
+	Patterns func(o runtime.Object) []TargetPattern
+
+	objects map[types.NamespacedName]*patternObject
+	sync.RWMutex
+}
+
+type patternObject struct {
+	object runtime.Object
+	// Invalid patterns have no matcher, they are reported when the shared object is reconciled
+	matchers map[string]NamespaceMatcher
+}
+
+// NewSharedSecretPatternIndex returns the PatternIndex of SharedSecrets
+func NewSharedSecretPatternIndex() *PatternIndex {
+	return &PatternIndex{
+		Patterns: func(o runtime.Object) []TargetPattern {
+			patterns := append(SharedSecretTargetPatterns(o), SharedSecretCrossKindPatterns(o)...)
+			return append(patterns, SharedSecretEncryptionKeyPatterns(o)...)
+		},
+		objects: map[types.NamespacedName]*patternObject{},
+	}
+}
+
+// NewSharedConfigMapPatternIndex returns the PatternIndex of SharedConfigMaps
+func NewSharedConfigMapPatternIndex() *PatternIndex {
+	return &PatternIndex{
+		Patterns: func(o runtime.Object) []TargetPattern {
+			return append(SharedConfigMapTargetPatterns(o), SharedConfigMapCrossKindPatterns(o)...)
+		},
+		objects: map[types.NamespacedName]*patternObject{},
+	}
+}
+
+// Update records a shared object as it is reconciled, shared objects without a pattern are forgotten.
+// It does nothing on a nil index.
+func (i *PatternIndex) Update(key types.NamespacedName, o runtime.Object) {
+	if i == nil {
+		return
+	}
+	patterns := i.Patterns(o)
+	if len(patterns) == 0 {
+		i.Forget(key)
+		return
+	}
+	indexed := &patternObject{object: o.DeepCopyObject(), matchers: map[string]NamespaceMatcher{}}
+	for _, p := range patterns {
+		if match, err := NewNamespaceMatcher(p.Namespace); err == nil {
+			indexed.matchers[p.Namespace] = match
+		}
+	}
+	i.Lock()
+	defer i.Unlock()
+	i.objects[key] = indexed
+}
+
+// Forget drops a shared object once it is deleted. It does nothing on a nil index.
+func (i *PatternIndex) Forget(key types.NamespacedName) {
+	if i == nil {
+		return
+	}
+	i.Lock()
+	defer i.Unlock()
+	delete(i.objects, key)
+}
+
+// PatternMapper maps an event on an object to the shared objects with a target namespace pattern matching
+// the namespace of the object, or the object itself for namespaces
+type PatternMapper struct {
+	Index *PatternIndex
+
+	// Returns the targets of a shared object whose namespace is a pattern
+	Patterns func(o runtime.Object) []TargetPattern
+
+	// Set when mapping events on namespaces, which match on their name alone. Other objects also have to
+	// be named like the copies the pattern writes.
+	Namespaces bool
+}
+
+func (m *PatternMapper) Map(o handler.MapObject) []reconcile.Request {
+	namespace, name := o.Meta.GetNamespace(), o.Meta.GetName()
+	if m.Namespaces {
+		namespace = name
+	}
+	// Generations of immutable copies are matched on the name of the target they are a copy of
+	if copyOf, ok := o.Meta.GetAnnotations()[tattletalev1beta1.CopyOfAnnotation]; ok {
+		name = copyOf
+	}
+
+	m.Index.RLock()
+	defer m.Index.RUnlock()
+	requests := []reconcile.Request{}
+	for key, indexed := range m.Index.objects {
+		for _, p := range m.Patterns(indexed.object) {
+			if !m.Namespaces && p.Name != name {
+				continue
+			}
+			if match, ok := indexed.matchers[p.Namespace]; ok && match(namespace) {
+				requests = append(requests, reconcile.Request{NamespacedName: key})
+				break
+			}
+		}
+	}
+
+	if len(requests) > 0 {
+		handlerLog.V(1).Info("Handling event", "object", IndexKey(o.Meta.GetNamespace(), o.Meta.GetName()), "kind", fmt.Sprintf("%T", o.Object), "patternRequests", len(requests))
+	}
+	return requests
+}
+
+// MultiMapper maps an event with every mapper, requesting every shared object once
+type MultiMapper []handler.Mapper
+
+func (m MultiMapper) Map(o handler.MapObject) []reconcile.Request {
+	requests := []reconcile.Request{}
+	seen := map[types.NamespacedName]bool{}
+	for _, mapper := range m {
+		for _, request := range mapper.Map(o) {
+			if !seen[request.NamespacedName] {
+				seen[request.NamespacedName] = true
+				requests = append(requests, request)
+			}
+		}
+	}
+	return requests
+}
@@ -0,0 +1,255 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"testing"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// newIndexedCache returns an unstarted informer cache with the SharedSecret, SharedConfigMap and SharedResource
+// indexes registered, holding the given objects. Nothing talks to an API server until the cache is started.
+func newIndexedCache(objs ...runtime.Object) (cache.Cache, error) {
+	scheme := runtime.NewScheme()
+	if err := tattletalev1beta1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(tattletalev1beta1.GroupVersion.WithKind("SharedSecret"), meta.RESTScopeNamespace)
+	mapper.Add(tattletalev1beta1.GroupVersion.WithKind("SharedConfigMap"), meta.RESTScopeNamespace)
+	mapper.Add(tattletalev1beta1.GroupVersion.WithKind("SharedResource"), meta.RESTScopeNamespace)
+
+	c, err := cache.New(&rest.Config{Host: "http://localhost"}, cache.Options{Scheme: scheme, Mapper: mapper})
+	if err != nil {
+		return nil, err
+	}
+	if err := RegisterSharedSecretIndexes(c); err != nil {
+		return nil, err
+	}
+	if err := RegisterSharedConfigMapIndexes(c); err != nil {
+		return nil, err
+	}
+	if err := RegisterSharedResourceIndexes(c); err != nil {
+		return nil, err
+	}
+	for _, o := range objs {
+		informer, err := c.GetInformer(o)
+		if err != nil {
+			return nil, err
+		}
+		if err := informer.(toolscache.SharedIndexInformer).GetIndexer().Add(o); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func newSharedSecret(i int, targets ...tattletalev1beta1.TargetSecret) *tattletalev1beta1.SharedSecret {
+	return &tattletalev1beta1.SharedSecret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: fmt.Sprintf("sharedsecret-%d", i)},
+		Spec: tattletalev1beta1.SharedSecretSpec{
+			SourceNamespace: "default",
+			SourceSecret:    fmt.Sprintf("secret-%d", i),
+			Targets:         targets,
+		},
+	}
+}
+
+func newSecretMapper(c cache.Cache, indexes ...string) *IndexMapper {
+	return &IndexMapper{
+		Reader:  c,
+		NewList: func() runtime.Object { return &tattletalev1beta1.SharedSecretList{} },
+		Indexes: indexes,
+	}
+}
+
+func secretEvent(namespace, name string) handler.MapObject {
+	s := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	return handler.MapObject{Meta: s, Object: s}
+}
+
+// sharedSecretRequest returns the request of newSharedSecret(i)
+func sharedSecretRequest(i int) reconcile.Request {
+	return reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: fmt.Sprintf("sharedsecret-%d", i)}}
+}
+
+// checkRequests fails the test unless requests are those of the shared secrets given, in any order
+func checkRequests(t *testing.T, requests []reconcile.Request, want ...int) {
+	t.Helper()
+	got := sets.NewString()
+	for _, r := range requests {
+		got.Insert(r.String())
+	}
+	wanted := sets.NewString()
+	for _, i := range want {
+		wanted.Insert(sharedSecretRequest(i).String())
+	}
+	if len(requests) != len(want) || !got.Equal(wanted) {
+		t.Errorf("requests = %v, want %v", requests, wanted.List())
+	}
+}
+
+func namespaceEvent(name string) handler.MapObject {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	return handler.MapObject{Meta: ns, Object: ns}
+}
+
+func TestIndexMapper(t *testing.T) {
+	c, err := newIndexedCache(
+		newSharedSecret(1, tattletalev1beta1.TargetSecret{Namespace: "team-a"}, tattletalev1beta1.TargetSecret{Namespace: "team-b", NewName: "renamed"}),
+		newSharedSecret(2, tattletalev1beta1.TargetSecret{Namespace: "team-b", NewName: "renamed"}),
+		newSharedSecret(3, tattletalev1beta1.TargetSecret{Namespace: "default", NewName: "secret-1"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sources and copies are mapped to their shared objects, once each
+	tests := []struct {
+		name    string
+		indexes []string
+		event   handler.MapObject
+		want    []int
+	}{
+		{name: "source and copy", indexes: []string{SourceIndex, TargetIndex}, event: secretEvent("default", "secret-1"), want: []int{1, 3}},
+		{name: "renamed copy", indexes: []string{SourceIndex, TargetIndex}, event: secretEvent("team-b", "renamed"), want: []int{1, 2}},
+		{name: "copy", indexes: []string{SourceIndex, TargetIndex}, event: secretEvent("team-a", "secret-1"), want: []int{1}},
+		{name: "unrelated", indexes: []string{SourceIndex, TargetIndex}, event: secretEvent("team-a", "unrelated")},
+		{name: "namespace", indexes: []string{TargetNamespaceIndex}, event: namespaceEvent("team-b"), want: []int{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkRequests(t, newSecretMapper(c, tt.indexes...).Map(tt.event), tt.want...)
+		})
+	}
+}
+
+// newPatternIndexTest returns a cache and PatternIndex holding SharedSecrets with target namespace patterns
+func newPatternIndexTest(t *testing.T) (cache.Cache, *PatternIndex) {
+	objs := []runtime.Object{
+		newSharedSecret(1, tattletalev1beta1.TargetSecret{Namespace: "team-*-prod"}),
+		newSharedSecret(2, tattletalev1beta1.TargetSecret{Namespace: tattletalev1beta1.AllNamespaces, NewName: "ca"}),
+		newSharedSecret(3, tattletalev1beta1.TargetSecret{Namespace: "/team-(a|b)-prod/"}, tattletalev1beta1.TargetSecret{Namespace: "team-[a"}),
+		newSharedSecret(4, tattletalev1beta1.TargetSecret{Namespace: "team-a-prod"}),
+	}
+	c, err := newIndexedCache(objs...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := NewSharedSecretPatternIndex()
+	for i, o := range objs {
+		index.Update(sharedSecretRequest(i+1).NamespacedName, o)
+	}
+	return c, index
+}
+
+func TestPatternMapper(t *testing.T) {
+	c, index := newPatternIndexTest(t)
+	// New namespaces are mapped to the shared objects targeting them or with a pattern matching them
+	namespaces := MultiMapper{
+		newSecretMapper(c, TargetNamespaceIndex),
+		&PatternMapper{Index: index, Patterns: SharedSecretTargetPatterns, Namespaces: true},
+	}
+	// Copies in matching namespaces are mapped to their shared objects
+	copies := &PatternMapper{Index: index, Patterns: SharedSecretTargetPatterns}
+
+	tests := []struct {
+		name   string
+		mapper handler.Mapper
+		event  handler.MapObject
+		want   []int
+	}{
+		{name: "namespace matching every pattern", mapper: namespaces, event: namespaceEvent("team-a-prod"), want: []int{1, 2, 3, 4}},
+		{name: "namespace matching a glob", mapper: namespaces, event: namespaceEvent("team-c-prod"), want: []int{1, 2}},
+		{name: "namespace matching all namespaces", mapper: namespaces, event: namespaceEvent("team-a-dev"), want: []int{2}},
+		{name: "copy matching a glob", mapper: copies, event: secretEvent("team-b-prod", "secret-1"), want: []int{1}},
+		{name: "copy matching a regular expression", mapper: copies, event: secretEvent("team-b-prod", "secret-3"), want: []int{3}},
+		{name: "copy in any namespace", mapper: copies, event: secretEvent("anywhere", "ca"), want: []int{2}},
+		{name: "copy in no matching namespace", mapper: copies, event: secretEvent("team-b-dev", "secret-1")},
+		// Pattern targets are left out of the target indexes
+		{name: "copy named like a pattern", mapper: newSecretMapper(c, TargetIndex), event: secretEvent("team-*-prod", "secret-1")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkRequests(t, tt.mapper.Map(tt.event), tt.want...)
+		})
+	}
+}
+
+func TestPatternIndexForget(t *testing.T) {
+	_, index := newPatternIndexTest(t)
+	m := &PatternMapper{Index: index, Patterns: SharedSecretTargetPatterns}
+
+	// Events stop being mapped to shared objects once they are forgotten
+	index.Forget(sharedSecretRequest(1).NamespacedName)
+	checkRequests(t, m.Map(secretEvent("team-b-prod", "secret-1")))
+
+	// Shared objects no longer targeting a pattern are forgotten as they are reconciled
+	index.Update(sharedSecretRequest(2).NamespacedName, newSharedSecret(2, tattletalev1beta1.TargetSecret{Namespace: "team-a", NewName: "ca"}))
+	checkRequests(t, m.Map(secretEvent("anywhere", "ca")))
+}
+
+// BenchmarkIndexMapper measures the cost of mapping a secret event to its shared objects with 10k SharedSecrets cached
+func BenchmarkIndexMapper(b *testing.B) {
+	objs := make([]runtime.Object, 0, 10000)
+	for i := 0; i < 10000; i++ {
+		objs = append(objs, newSharedSecret(i,
+			tattletalev1beta1.TargetSecret{Namespace: fmt.Sprintf("team-%d", i%100)},
+			tattletalev1beta1.TargetSecret{Namespace: fmt.Sprintf("team-%d", (i+1)%100)},
+		))
+	}
+	c, err := newIndexedCache(objs...)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("source", func(b *testing.B) {
+		m := newSecretMapper(c, SourceIndex, TargetIndex)
+		event := secretEvent("default", "secret-5000")
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if len(m.Map(event)) != 1 {
+				b.Fatal("expected a single request")
+			}
+		}
+	})
+
+	b.Run("namespace", func(b *testing.B) {
+		m := newSecretMapper(c, TargetNamespaceIndex)
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-50"}}
+		event := handler.MapObject{Meta: ns, Object: ns}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if len(m.Map(event)) != 200 {
+				b.Fatal("expected 200 requests")
+			}
+		}
+	})
+}
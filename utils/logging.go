@@ -0,0 +1,59 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"io"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/zapr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	logzap "sigs.k8s.io/controller-runtime/pkg/log/zap"
+
+	configv1alpha1 "tattletale/api/config/v1alpha1"
+)
+
+// NewLogger returns a logger writing entries of at least the given level to w, in the same format as
+// the controller-runtime zap logger. debug shows the V(1) logs of the reconcilers, error only shows errors.
+func NewLogger(w io.Writer, level string, development bool) logr.Logger {
+	lvl := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	switch level {
+	case configv1alpha1.LogLevelDebug:
+		lvl.SetLevel(zapcore.DebugLevel)
+	case configv1alpha1.LogLevelError:
+		lvl.SetLevel(zapcore.ErrorLevel)
+	}
+
+	sink := zapcore.AddSync(w)
+	var enc zapcore.Encoder
+	var opts []zap.Option
+	if development {
+		enc = zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig())
+		opts = append(opts, zap.Development(), zap.AddStacktrace(zap.ErrorLevel))
+	} else {
+		enc = zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+		opts = append(opts, zap.AddStacktrace(zap.WarnLevel),
+			zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+				return zapcore.NewSampler(core, time.Second, 100, 100)
+			}))
+	}
+	opts = append(opts, zap.AddCallerSkip(1), zap.ErrorOutput(sink))
+
+	log := zap.New(zapcore.NewCore(&logzap.KubeAwareEncoder{Encoder: enc, Verbose: development}, sink, lvl))
+	return zapr.NewLogger(log.WithOptions(opts...))
+}
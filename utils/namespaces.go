@@ -0,0 +1,109 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// NamespaceAllowed reports whether the operator may read and write in a namespace.
+// An empty allowed set means the operator is installed cluster wide.
+func NamespaceAllowed(allowed, excluded sets.String, namespace string) bool {
+	if excluded.Has(namespace) {
+		return false
+	}
+	return allowed.Len() == 0 || allowed.Has(namespace)
+}
+
+// serviceAccountNamespaceFile holds the namespace of the service account mounted into every pod
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// OperatorNamespace returns the namespace the manager runs in, from the POD_NAMESPACE environment variable
+// or the mounted service account. It is empty when the manager runs outside of the cluster.
+func OperatorNamespace() string {
+	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+		return ns
+	}
+	b, err := ioutil.ReadFile(serviceAccountNamespaceFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// NamespacedRoleName is the name of the Role and RoleBinding generated in every allowed namespace
+const NamespacedRoleName = "tattletale-manager-role"
+
+// NamespacedRBAC returns a Role and a RoleBinding per namespace granting a service account what the
+// manager needs when restricted to those namespaces, in place of the cluster wide manager-role
+func NamespacedRBAC(namespaces []string, serviceAccount, serviceAccountNamespace string) []runtime.Object {
+	rules := []rbacv1.PolicyRule{
+		{
+			APIGroups: []string{""},
+			Resources: []string{"configmaps", "secrets"},
+			Verbs:     []string{"create", "delete", "get", "list", "patch", "update", "watch"},
+		},
+		{
+			APIGroups: []string{""},
+			Resources: []string{"events"},
+			Verbs:     []string{"create", "patch"},
+		},
+		{
+			APIGroups: []string{tattletalev1beta1.GroupVersion.Group},
+			Resources: []string{"sharedconfigmaps", "sharedsecrets"},
+			Verbs:     []string{"create", "delete", "get", "list", "patch", "update", "watch"},
+		},
+		{
+			APIGroups: []string{tattletalev1beta1.GroupVersion.Group},
+			Resources: []string{"sharedconfigmaps/status", "sharedsecrets/status"},
+			Verbs:     []string{"get", "patch", "update"},
+		},
+	}
+
+	objects := []runtime.Object{}
+	for _, ns := range namespaces {
+		objects = append(objects,
+			&rbacv1.Role{
+				TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "Role"},
+				ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: NamespacedRoleName},
+				Rules:      rules,
+			},
+			&rbacv1.RoleBinding{
+				TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "RoleBinding"},
+				ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: NamespacedRoleName},
+				RoleRef: rbacv1.RoleRef{
+					APIGroup: rbacv1.GroupName,
+					Kind:     "Role",
+					Name:     NamespacedRoleName,
+				},
+				Subjects: []rbacv1.Subject{{
+					Kind:      rbacv1.ServiceAccountKind,
+					Name:      serviceAccount,
+					Namespace: serviceAccountNamespace,
+				}},
+			})
+	}
+	return objects
+}
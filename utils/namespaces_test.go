@@ -0,0 +1,79 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestNamespaceAllowed(t *testing.T) {
+	tests := []struct {
+		name              string
+		allowed, excluded sets.String
+		namespace         string
+		want              bool
+	}{
+		{name: "installed cluster wide", allowed: sets.NewString(), excluded: sets.NewString(), namespace: "anything", want: true},
+		{name: "listed", allowed: sets.NewString("team-a", "team-b"), excluded: sets.NewString(), namespace: "team-a", want: true},
+		{name: "not listed", allowed: sets.NewString("team-a", "team-b"), excluded: sets.NewString(), namespace: "kube-system"},
+		{name: "excluded", allowed: sets.NewString(), excluded: sets.NewString("legacy"), namespace: "legacy"},
+		{name: "listed and excluded", allowed: sets.NewString("legacy"), excluded: sets.NewString("legacy"), namespace: "legacy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NamespaceAllowed(tt.allowed, tt.excluded, tt.namespace); got != tt.want {
+				t.Errorf("NamespaceAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOperatorNamespace(t *testing.T) {
+	defer os.Unsetenv("POD_NAMESPACE")
+	os.Setenv("POD_NAMESPACE", "tattletale-system")
+	if got := OperatorNamespace(); got != "tattletale-system" {
+		t.Errorf("OperatorNamespace() = %q, want the namespace from the environment", got)
+	}
+}
+
+func TestNamespacedRBAC(t *testing.T) {
+	objects := NamespacedRBAC([]string{"team-a", "team-b"}, "manager", "tattletale-system")
+	if len(objects) != 4 {
+		t.Fatalf("generated %d objects, want a Role and RoleBinding per namespace", len(objects))
+	}
+
+	role := objects[2].(*rbacv1.Role)
+	if role.Namespace != "team-b" {
+		t.Errorf("role namespace = %q, want team-b", role.Namespace)
+	}
+	if resources := sets.NewString(role.Rules[0].Resources...); !resources.Equal(sets.NewString("configmaps", "secrets")) {
+		t.Errorf("role resources = %v, want configmaps and secrets", role.Rules[0].Resources)
+	}
+
+	binding := objects[3].(*rbacv1.RoleBinding)
+	if binding.Namespace != "team-b" || binding.RoleRef.Name != role.Name {
+		t.Errorf("binding = %s binding %s, want team-b binding %s", binding.Namespace, binding.RoleRef.Name, role.Name)
+	}
+	want := []rbacv1.Subject{{Kind: "ServiceAccount", Name: "manager", Namespace: "tattletale-system"}}
+	if !reflect.DeepEqual(binding.Subjects, want) {
+		t.Errorf("subjects = %+v, want %+v", binding.Subjects, want)
+	}
+}
@@ -0,0 +1,69 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// IsNamespacePattern reports whether a target namespace is a pattern rather than the name of a namespace:
+// a glob such as team-*-prod, which includes * for all namespaces, or a regular expression between slashes
+func IsNamespacePattern(namespace string) bool {
+	return strings.ContainsAny(namespace, "*?[") || isNamespaceRegexp(namespace)
+}
+
+func isNamespaceRegexp(namespace string) bool {
+	return len(namespace) > 1 && strings.HasPrefix(namespace, "/") && strings.HasSuffix(namespace, "/")
+}
+
+// NamespaceMatcher reports whether a namespace matches a target namespace pattern
+type NamespaceMatcher func(namespace string) bool
+
+// NewNamespaceMatcher parses a target namespace pattern. Regular expressions have to match the whole name.
+func NewNamespaceMatcher(pattern string) (NamespaceMatcher, error) {
+	if isNamespaceRegexp(pattern) {
+		re, err := regexp.Compile("^(?:" + pattern[1:len(pattern)-1] + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %s: %v", pattern, err)
+		}
+		return re.MatchString, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob %s: %v", pattern, err)
+	}
+	return func(namespace string) bool {
+		matched, _ := path.Match(pattern, namespace)
+		return matched
+	}, nil
+}
+
+// MatchNamespaces returns the namespaces matching a target namespace pattern
+func MatchNamespaces(pattern string, namespaces []string) ([]string, error) {
+	match, err := NewNamespaceMatcher(pattern)
+	if err != nil {
+		return nil, err
+	}
+	matched := []string{}
+	for _, ns := range namespaces {
+		if match(ns) {
+			matched = append(matched, ns)
+		}
+	}
+	return matched, nil
+}
@@ -0,0 +1,71 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsNamespacePattern(t *testing.T) {
+	tests := []struct {
+		namespace string
+		want      bool
+	}{
+		{namespace: "team-a-prod"},
+		{namespace: "*", want: true},
+		{namespace: "team-?-prod", want: true},
+		{namespace: "team-[ab]-prod", want: true},
+		{namespace: "/team-.+/", want: true},
+		{namespace: "/"},
+	}
+	for _, tt := range tests {
+		if got := IsNamespacePattern(tt.namespace); got != tt.want {
+			t.Errorf("IsNamespacePattern(%q) = %v, want %v", tt.namespace, got, tt.want)
+		}
+	}
+}
+
+func TestMatchNamespaces(t *testing.T) {
+	namespaces := []string{"default", "team-a-dev", "team-a-prod", "team-b-prod", "team-prod"}
+
+	tests := []struct {
+		name    string
+		pattern string
+		want    []string
+		wantErr bool
+	}{
+		{name: "every namespace", pattern: "*", want: namespaces},
+		{name: "glob", pattern: "team-*-prod", want: []string{"team-a-prod", "team-b-prod"}},
+		{name: "single character glob", pattern: "team-?-dev", want: []string{"team-a-dev"}},
+		{name: "regular expression", pattern: "/team-(a|b)-prod/", want: []string{"team-a-prod", "team-b-prod"}},
+		// Regular expressions match the whole name
+		{name: "partial regular expression", pattern: "/prod/"},
+		{name: "invalid glob", pattern: "team-[a", wantErr: true},
+		{name: "invalid regular expression", pattern: "/team-(a/", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MatchNamespaces(tt.pattern, namespaces)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MatchNamespaces() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("MatchNamespaces() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
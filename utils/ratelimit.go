@@ -0,0 +1,54 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"time"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// NewRateLimiter returns a workqueue rate limiter retrying each failed request with exponential backoff
+// between baseDelay and maxDelay, while retrying no more than qps requests per second overall
+func NewRateLimiter(baseDelay, maxDelay time.Duration, qps float64, burst int) workqueue.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(baseDelay, maxDelay),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(qps), burst)},
+	)
+}
+
+// RateLimitedReconciler retries failed requests with its own rate limiter instead of the controller's
+// default one, which can't be replaced through the controller options
+type RateLimitedReconciler struct {
+	reconcile.Reconciler
+	RateLimiter workqueue.RateLimiter
+	Log         logr.Logger
+}
+
+func (r *RateLimitedReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	result, err := r.Reconciler.Reconcile(req)
+	if err != nil {
+		delay := r.RateLimiter.When(req)
+		r.Log.Error(err, "reconcile failed, requeuing", "request", req.NamespacedName, "after", delay.String())
+		return ctrl.Result{RequeueAfter: delay}, nil
+	}
+	r.RateLimiter.Forget(req)
+	return result, nil
+}
@@ -0,0 +1,75 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// newFailingReconciler returns a RateLimitedReconciler whose requests fail while *failing is set
+func newFailingReconciler(failing *bool) *RateLimitedReconciler {
+	return &RateLimitedReconciler{
+		Reconciler: reconcile.Func(func(ctrl.Request) (ctrl.Result, error) {
+			if *failing {
+				return ctrl.Result{}, errors.New("boom")
+			}
+			return ctrl.Result{}, nil
+		}),
+		RateLimiter: NewRateLimiter(10*time.Millisecond, 35*time.Millisecond, 100, 100),
+		Log:         ctrl.Log,
+	}
+}
+
+func TestRateLimitedReconcilerBackoff(t *testing.T) {
+	failing := true
+	r := newFailingReconciler(&failing)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "foo"}}
+
+	// Failed requests back off up to the max delay
+	for i, want := range []time.Duration{10, 20, 35, 35} {
+		result, err := r.Reconcile(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.RequeueAfter != want*time.Millisecond {
+			t.Errorf("failure %d: requeued after %s, want %s", i, result.RequeueAfter, want*time.Millisecond)
+		}
+	}
+}
+
+func TestRateLimitedReconcilerReset(t *testing.T) {
+	failing := true
+	r := newFailingReconciler(&failing)
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "foo"}}
+
+	_, _ = r.Reconcile(req)
+	_, _ = r.Reconcile(req)
+	failing = false
+
+	// The backoff is reset once a request succeeds
+	if result, err := r.Reconcile(req); err != nil || result != (ctrl.Result{}) {
+		t.Errorf("Reconcile() = %+v, %v, want no requeue", result, err)
+	}
+	if n := r.RateLimiter.NumRequeues(req); n != 0 {
+		t.Errorf("%d requeues left, want 0", n)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Top level fields of a resource that are never copied: the metadata of the copy is its own and status is
+// written by whatever controller owns the kind
+var unsharedFields = map[string]bool{
+	"apiVersion": true,
+	"kind":       true,
+	"metadata":   true,
+	"status":     true,
+}
+
+// Fields of some kinds populated in the cluster after creation, they are neither copied nor compared
+var serverPopulatedFields = map[schema.GroupKind][][]string{
+	{Kind: "ServiceAccount"}: {{"secrets"}},
+	{Kind: "Service"}:        {{"spec", "clusterIP"}, {"spec", "clusterIPs"}, {"spec", "healthCheckNodePort"}},
+}
+
+// ResourceContent returns the part of a resource that is shared: everything but its metadata, status
+// and the fields populated in the cluster
+func ResourceContent(obj *unstructured.Unstructured) map[string]interface{} {
+	content := map[string]interface{}{}
+	for k, v := range obj.UnstructuredContent() {
+		if !unsharedFields[k] {
+			content[k] = runtime.DeepCopyJSONValue(v)
+		}
+	}
+	for _, path := range serverPopulatedFields[obj.GroupVersionKind().GroupKind()] {
+		unstructured.RemoveNestedField(content, path...)
+	}
+	return content
+}
+
+// HashResource returns a stable hash of the shared content of a resource. It fails on content that can't
+// be encoded to JSON, e.g. a NaN float.
+func HashResource(obj *unstructured.Unstructured) (string, error) {
+	// Maps are marshalled with sorted keys, so the encoding is stable
+	b, err := json.Marshal(ResourceContent(obj))
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// BuildResourceCopy returns the copy of source to write. existing is the current copy, or nil when there
+// is none, and keeps its metadata, status and the fields populated in the cluster.
+func BuildResourceCopy(source, existing *unstructured.Unstructured, namespace, name string) *unstructured.Unstructured {
+	var result *unstructured.Unstructured
+	if existing != nil {
+		result = existing.DeepCopy()
+	} else {
+		result = &unstructured.Unstructured{Object: map[string]interface{}{}}
+		result.SetGroupVersionKind(source.GroupVersionKind())
+		result.SetNamespace(namespace)
+		result.SetName(name)
+	}
+
+	for k := range result.Object {
+		if !unsharedFields[k] {
+			delete(result.Object, k)
+		}
+	}
+	for k, v := range ResourceContent(source) {
+		result.Object[k] = v
+	}
+
+	if existing != nil {
+		for _, path := range serverPopulatedFields[existing.GroupVersionKind().GroupKind()] {
+			if v, found, err := unstructured.NestedFieldCopy(existing.Object, path...); err == nil && found {
+				_ = unstructured.SetNestedField(result.Object, v, path...)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,157 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newResource(obj map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: obj}
+}
+
+func newNetworkPolicy() *unstructured.Unstructured {
+	return newResource(map[string]interface{}{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "NetworkPolicy",
+		"metadata": map[string]interface{}{
+			"namespace":       "default",
+			"name":            "deny",
+			"uid":             "1234",
+			"resourceVersion": "42",
+			"labels":          map[string]interface{}{"team": "a"},
+		},
+		"spec": map[string]interface{}{
+			"podSelector": map[string]interface{}{},
+			"policyTypes": []interface{}{"Ingress"},
+		},
+	})
+}
+
+func TestHashResource(t *testing.T) {
+	source := newNetworkPolicy()
+
+	// Only the shared content is hashed
+	tests := []struct {
+		name   string
+		change func(o *unstructured.Unstructured)
+		same   bool
+	}{
+		{
+			name: "metadata and status",
+			change: func(o *unstructured.Unstructured) {
+				o.SetNamespace("team-a")
+				o.SetResourceVersion("7")
+				o.Object["status"] = map[string]interface{}{"ready": true}
+			},
+			same: true,
+		},
+		{
+			name: "spec",
+			change: func(o *unstructured.Unstructured) {
+				o.Object["spec"].(map[string]interface{})["policyTypes"] = []interface{}{"Egress"}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := source.DeepCopy()
+			tt.change(other)
+			otherHash, err := HashResource(other)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sourceHash, err := HashResource(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if same := otherHash == sourceHash; same != tt.same {
+				t.Errorf("same hash = %v, want %v", same, tt.same)
+			}
+		})
+	}
+}
+
+func TestHashResourceError(t *testing.T) {
+	// Content that can't be encoded to JSON fails rather than panics
+	o := newNetworkPolicy()
+	o.Object["spec"].(map[string]interface{})["ratio"] = math.NaN()
+	if _, err := HashResource(o); err == nil {
+		t.Error("HashResource() error = nil, want an error")
+	}
+}
+
+func TestBuildResourceCopy(t *testing.T) {
+	source := newNetworkPolicy()
+
+	// A new copy doesn't keep the server populated metadata of the source
+	copy := BuildResourceCopy(source, nil, "team-a", "deny")
+	if copy.GetNamespace() != "team-a" || copy.GetName() != "deny" {
+		t.Errorf("copy = %s/%s, want team-a/deny", copy.GetNamespace(), copy.GetName())
+	}
+	if copy.GetUID() != "" || copy.GetResourceVersion() != "" {
+		t.Errorf("copy kept the uid %q and resourceVersion %q of the source", copy.GetUID(), copy.GetResourceVersion())
+	}
+	if copy.GetKind() != "NetworkPolicy" {
+		t.Errorf("kind = %q, want NetworkPolicy", copy.GetKind())
+	}
+	if !reflect.DeepEqual(copy.Object["spec"], source.Object["spec"]) {
+		t.Errorf("spec = %v, want %v", copy.Object["spec"], source.Object["spec"])
+	}
+}
+
+func TestBuildResourceCopyExisting(t *testing.T) {
+	sa := newResource(map[string]interface{}{
+		"apiVersion":                   "v1",
+		"kind":                         "ServiceAccount",
+		"metadata":                     map[string]interface{}{"namespace": "default", "name": "builder"},
+		"automountServiceAccountToken": false,
+		"secrets":                      []interface{}{map[string]interface{}{"name": "builder-token-abcde"}},
+	})
+	existing := newResource(map[string]interface{}{
+		"apiVersion":       "v1",
+		"kind":             "ServiceAccount",
+		"metadata":         map[string]interface{}{"namespace": "team-a", "name": "builder", "resourceVersion": "3"},
+		"secrets":          []interface{}{map[string]interface{}{"name": "builder-token-fghij"}},
+		"imagePullSecrets": []interface{}{map[string]interface{}{"name": "stale"}},
+	})
+
+	// An existing copy keeps its own metadata and cluster populated fields
+	copy := BuildResourceCopy(sa, existing, "team-a", "builder")
+	if copy.GetResourceVersion() != "3" {
+		t.Errorf("resourceVersion = %q, want the one of the existing copy", copy.GetResourceVersion())
+	}
+	if copy.Object["automountServiceAccountToken"] != false {
+		t.Errorf("automountServiceAccountToken = %v, want false", copy.Object["automountServiceAccountToken"])
+	}
+	if _, ok := copy.Object["imagePullSecrets"]; ok {
+		t.Error("copy kept imagePullSecrets the source doesn't set")
+	}
+	if !reflect.DeepEqual(copy.Object["secrets"], existing.Object["secrets"]) {
+		t.Errorf("secrets = %v, want those of the existing copy", copy.Object["secrets"])
+	}
+	copyHash, err := HashResource(copy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saHash, _ := HashResource(sa); copyHash != saHash {
+		t.Error("the copy doesn't hash like its source")
+	}
+}
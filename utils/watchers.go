@@ -17,14 +17,19 @@ package utils
 
 import (
 	"os"
+	"sync"
 
 	tattletalev1beta1 "tattletale/api/v1beta1"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
@@ -33,102 +38,212 @@ var (
 	setupLog = ctrl.Log.WithName("setup")
 )
 
-func InitSharedConfigMapWatch(cache *SharedReverseCache) (*source.Kind, *handler.EnqueueRequestsFromMapFunc, *predicate.Funcs) {
+func InitNamespaceWatch(mapper handler.Mapper) (*source.Kind, *handler.EnqueueRequestsFromMapFunc, *predicate.Funcs) {
 
-	sharedConfigMapPredicate := &predicate.Funcs{
+	namespacePredicate := &predicate.Funcs{
 		CreateFunc: func(e event.CreateEvent) bool { return true },
-		UpdateFunc: func(e event.UpdateEvent) bool { return true },
-		DeleteFunc: func(e event.DeleteEvent) bool { return true },
+		DeleteFunc: func(e event.DeleteEvent) bool { return false },
 	}
 
-	return &source.Kind{Type: &tattletalev1beta1.SharedConfigMap{}}, &handler.EnqueueRequestsFromMapFunc{ToRequests: cache}, sharedConfigMapPredicate
+	return &source.Kind{Type: &corev1.Namespace{}}, &handler.EnqueueRequestsFromMapFunc{ToRequests: mapper}, namespacePredicate
 }
 
-func InitSharedSecretWatch(cache *SharedReverseCache) (*source.Kind, *handler.EnqueueRequestsFromMapFunc, *predicate.Funcs) {
+// InitSharedObjectWatch watches changes to the spec of shared objects of the given type, and their deletion
+func InitSharedObjectWatch(obj runtime.Object, mapper handler.Mapper) (*source.Kind, *handler.EnqueueRequestsFromMapFunc, predicate.Predicate) {
+	return &source.Kind{Type: obj}, &handler.EnqueueRequestsFromMapFunc{ToRequests: mapper}, predicate.GenerationChangedPredicate{}
+}
+
+// InitObjectWatch watches every change to objects of the given type, typed or unstructured
+func InitObjectWatch(obj runtime.Object, mapper handler.Mapper) (*source.Kind, *handler.EnqueueRequestsFromMapFunc, *predicate.Funcs) {
 
-	sharedSecretPredicate := &predicate.Funcs{
+	objectPredicate := &predicate.Funcs{
 		CreateFunc: func(e event.CreateEvent) bool { return true },
 		UpdateFunc: func(e event.UpdateEvent) bool { return true },
 		DeleteFunc: func(e event.DeleteEvent) bool { return true },
 	}
 
-	return &source.Kind{Type: &tattletalev1beta1.SharedSecret{}}, &handler.EnqueueRequestsFromMapFunc{ToRequests: cache}, sharedSecretPredicate
+	return &source.Kind{Type: obj}, &handler.EnqueueRequestsFromMapFunc{ToRequests: mapper}, objectPredicate
 }
 
-func InitNamespaceWatch(cache *SharedReverseCache) (*source.Kind, *handler.EnqueueRequestsFromMapFunc, *predicate.Funcs) {
+func InitSharedConfigMapWatchers(mgr manager.Manager, controller controller.Controller, allowedNamespaces []string, patterns *PatternIndex) {
 
-	namespacePredicate := &predicate.Funcs{
-		CreateFunc: func(e event.CreateEvent) bool { return true },
-		DeleteFunc: func(e event.DeleteEvent) bool { return false },
+	if err := RegisterSharedConfigMapIndexes(mgr.GetFieldIndexer()); err != nil {
+		setupLog.Error(err, "problem setting up sharedconfigmap indexes")
+		os.Exit(1)
+	}
+	newList := func() runtime.Object { return &tattletalev1beta1.SharedConfigMapList{} }
+
+	// Namespace Watch, namespaces can only be watched when installed cluster wide. New namespaces are
+	// mapped to the shared objects with a target namespace pattern matching them too.
+	if len(allowedNamespaces) == 0 {
+		if err := controller.Watch(InitNamespaceWatch(MultiMapper{
+			&IndexMapper{Reader: mgr.GetCache(), NewList: newList, Indexes: []string{TargetNamespaceIndex}},
+			&PatternMapper{Index: patterns, Patterns: SharedConfigMapTargetPatterns, Namespaces: true},
+			&PatternMapper{Index: patterns, Patterns: SharedConfigMapCrossKindPatterns, Namespaces: true},
+		})); err != nil {
+			setupLog.Error(err, "problem setting up namespace watcher")
+			os.Exit(1)
+		}
 	}
 
-	return &source.Kind{Type: &corev1.Namespace{}}, &handler.EnqueueRequestsFromMapFunc{ToRequests: cache}, namespacePredicate
-}
-
-func InitConfigMapWatch(cache *SharedReverseCache) (*source.Kind, *handler.EnqueueRequestsFromMapFunc, *predicate.Funcs) {
+	// ConfigMap Watch
+	if err := controller.Watch(InitObjectWatch(&corev1.ConfigMap{}, MultiMapper{
+		&IndexMapper{Reader: mgr.GetCache(), NewList: newList, Indexes: []string{SourceIndex, TargetIndex}},
+		&PatternMapper{Index: patterns, Patterns: SharedConfigMapTargetPatterns},
+	})); err != nil {
+		setupLog.Error(err, "problem setting up configmap watcher")
+		os.Exit(1)
+	}
 
-	configmapPredicate := &predicate.Funcs{
-		CreateFunc: func(e event.CreateEvent) bool { return true },
-		UpdateFunc: func(e event.UpdateEvent) bool { return true },
-		DeleteFunc: func(e event.DeleteEvent) bool { return true },
+	// Secret Watch, for copies written as secrets
+	if err := controller.Watch(InitObjectWatch(&corev1.Secret{}, MultiMapper{
+		&IndexMapper{Reader: mgr.GetCache(), NewList: newList, Indexes: []string{CrossKindTargetIndex}},
+		&PatternMapper{Index: patterns, Patterns: SharedConfigMapCrossKindPatterns},
+	})); err != nil {
+		setupLog.Error(err, "problem setting up secret watcher")
+		os.Exit(1)
 	}
 
-	return &source.Kind{Type: &corev1.ConfigMap{}}, &handler.EnqueueRequestsFromMapFunc{ToRequests: cache}, configmapPredicate
+	// SharedConfigMap and SharedSecret Watch, those that lost a copy to another shared object take it over once it stops
+	// writing it, and those stuck in a cycle sync again once it is broken. Copies can change kind, so
+	// shared objects of both kinds are watched.
+	conditionMapper := &ConditionMapper{
+		Reader:  mgr.GetCache(),
+		NewList: newList,
+		Types:   []tattletalev1beta1.ConditionType{tattletalev1beta1.ConditionConflict, tattletalev1beta1.ConditionCycle},
+	}
+	if err := controller.Watch(InitSharedObjectWatch(&tattletalev1beta1.SharedConfigMap{}, conditionMapper)); err != nil {
+		setupLog.Error(err, "problem setting up sharedconfigmap watcher")
+		os.Exit(1)
+	}
+	if err := controller.Watch(InitSharedObjectWatch(&tattletalev1beta1.SharedSecret{}, conditionMapper)); err != nil {
+		setupLog.Error(err, "problem setting up sharedsecret watcher")
+		os.Exit(1)
+	}
 }
 
-func InitSecretWatch(cache *SharedReverseCache) (*source.Kind, *handler.EnqueueRequestsFromMapFunc, *predicate.Funcs) {
+func InitSharedSecretWatchers(mgr manager.Manager, controller controller.Controller, allowedNamespaces []string, patterns *PatternIndex) {
 
-	secretPredicate := &predicate.Funcs{
-		CreateFunc: func(e event.CreateEvent) bool { return true },
-		UpdateFunc: func(e event.UpdateEvent) bool { return true },
-		DeleteFunc: func(e event.DeleteEvent) bool { return true },
+	if err := RegisterSharedSecretIndexes(mgr.GetFieldIndexer()); err != nil {
+		setupLog.Error(err, "problem setting up sharedsecret indexes")
+		os.Exit(1)
+	}
+	newList := func() runtime.Object { return &tattletalev1beta1.SharedSecretList{} }
+
+	// Namespace Watch, namespaces can only be watched when installed cluster wide. New namespaces are
+	// mapped to the shared objects with a target namespace pattern matching them too.
+	if len(allowedNamespaces) == 0 {
+		if err := controller.Watch(InitNamespaceWatch(MultiMapper{
+			&IndexMapper{Reader: mgr.GetCache(), NewList: newList, Indexes: []string{TargetNamespaceIndex}},
+			&PatternMapper{Index: patterns, Patterns: SharedSecretTargetPatterns, Namespaces: true},
+			&PatternMapper{Index: patterns, Patterns: SharedSecretCrossKindPatterns, Namespaces: true},
+		})); err != nil {
+			setupLog.Error(err, "problem setting up namespace watcher")
+			os.Exit(1)
+		}
 	}
 
-	return &source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{ToRequests: cache}, secretPredicate
-}
-
-func InitSharedConfigMapWatchers(controller controller.Controller) {
+	// Secret Watch
+	if err := controller.Watch(InitObjectWatch(&corev1.Secret{}, MultiMapper{
+		&IndexMapper{Reader: mgr.GetCache(), NewList: newList, Indexes: []string{SourceIndex, TargetIndex}},
+		&PatternMapper{Index: patterns, Patterns: SharedSecretTargetPatterns},
+	})); err != nil {
+		setupLog.Error(err, "problem setting up secret watcher")
+		os.Exit(1)
+	}
 
-	sharedConfigMapCache := InitReverseCache()
+	// ConfigMap Watch, copies are encrypted again when a public key is rotated and encrypted sources are read
+	// again. Copies written as configmaps are watched too.
+	if err := controller.Watch(InitObjectWatch(&corev1.ConfigMap{}, MultiMapper{
+		&IndexMapper{Reader: mgr.GetCache(), NewList: newList, Indexes: []string{EncryptionKeyIndex, SourceConfigMapIndex, CrossKindTargetIndex}},
+		&PatternMapper{Index: patterns, Patterns: SharedSecretEncryptionKeyPatterns},
+		&PatternMapper{Index: patterns, Patterns: SharedSecretCrossKindPatterns},
+	})); err != nil {
+		setupLog.Error(err, "problem setting up configmap watcher")
+		os.Exit(1)
+	}
 
-	// SharedConfigMap Watch
-	if err := controller.Watch(InitSharedConfigMapWatch(sharedConfigMapCache)); err != nil {
+	// SharedSecret and SharedConfigMap Watch, those that lost a copy to another shared object take it over once it stops
+	// writing it, and those stuck in a cycle sync again once it is broken. Copies can change kind, so
+	// shared objects of both kinds are watched.
+	conditionMapper := &ConditionMapper{
+		Reader:  mgr.GetCache(),
+		NewList: newList,
+		Types:   []tattletalev1beta1.ConditionType{tattletalev1beta1.ConditionConflict, tattletalev1beta1.ConditionCycle},
+	}
+	if err := controller.Watch(InitSharedObjectWatch(&tattletalev1beta1.SharedSecret{}, conditionMapper)); err != nil {
+		setupLog.Error(err, "problem setting up sharedsecret watcher")
+		os.Exit(1)
+	}
+	if err := controller.Watch(InitSharedObjectWatch(&tattletalev1beta1.SharedConfigMap{}, conditionMapper)); err != nil {
 		setupLog.Error(err, "problem setting up sharedconfigmap watcher")
 		os.Exit(1)
 	}
+}
 
-	// Namespace Watch
-	if err := controller.Watch(InitNamespaceWatch(sharedConfigMapCache)); err != nil {
-		setupLog.Error(err, "problem setting up namespace watcher")
+func InitSharedResourceWatchers(mgr manager.Manager, controller controller.Controller, allowedNamespaces []string) *DynamicWatcher {
+
+	if err := RegisterSharedResourceIndexes(mgr.GetFieldIndexer()); err != nil {
+		setupLog.Error(err, "problem setting up sharedresource indexes")
 		os.Exit(1)
 	}
+	newList := func() runtime.Object { return &tattletalev1beta1.SharedResourceList{} }
+
+	// Namespace Watch, namespaces can only be watched when installed cluster wide
+	if len(allowedNamespaces) == 0 {
+		if err := controller.Watch(InitNamespaceWatch(&IndexMapper{Reader: mgr.GetCache(), NewList: newList, Indexes: []string{TargetNamespaceIndex}})); err != nil {
+			setupLog.Error(err, "problem setting up namespace watcher")
+			os.Exit(1)
+		}
+	}
 
-	// ConfigMap Watch
-	if err := controller.Watch(InitConfigMapWatch(sharedConfigMapCache)); err != nil {
-		setupLog.Error(err, "problem setting up configmap watcher")
+	// SharedResource Watch, those that lost a copy to another SharedResource take it over once it stops writing it,
+	// and those stuck in a cycle sync again once it is broken
+	conditionMapper := &ConditionMapper{
+		Reader:  mgr.GetCache(),
+		NewList: newList,
+		Types:   []tattletalev1beta1.ConditionType{tattletalev1beta1.ConditionConflict, tattletalev1beta1.ConditionCycle},
+	}
+	if err := controller.Watch(InitSharedObjectWatch(&tattletalev1beta1.SharedResource{}, conditionMapper)); err != nil {
+		setupLog.Error(err, "problem setting up sharedresource watcher")
 		os.Exit(1)
 	}
+
+	// Shared kinds are only known once SharedResources are reconciled, they are watched from there
+	return &DynamicWatcher{
+		Controller: controller,
+		NewMapper: func(gk schema.GroupKind) handler.Mapper {
+			return &IndexMapper{Reader: mgr.GetCache(), NewList: newList, Indexes: []string{SourceIndex, TargetIndex}, GroupKind: gk.String()}
+		},
+	}
 }
 
-func InitSharedSecretWatchers(controller controller.Controller) {
+// DynamicWatcher starts watches on kinds only known at runtime, once per kind
+type DynamicWatcher struct {
+	Controller controller.Controller
+	NewMapper  func(gk schema.GroupKind) handler.Mapper
 
-	sharedSecretCache := InitReverseCache()
+	watched map[schema.GroupVersionKind]bool
+	sync.Mutex
+}
 
-	// SharedSecret Watch
-	if err := controller.Watch(InitSharedSecretWatch(sharedSecretCache)); err != nil {
-		setupLog.Error(err, "problem setting up sharedsecret watcher")
-		os.Exit(1)
+// Watch starts watching a kind unless it is already watched
+func (w *DynamicWatcher) Watch(gvk schema.GroupVersionKind) error {
+	w.Lock()
+	defer w.Unlock()
+	if w.watched[gvk] {
+		return nil
 	}
 
-	// Namespace Watch
-	if err := controller.Watch(InitNamespaceWatch(sharedSecretCache)); err != nil {
-		setupLog.Error(err, "problem setting up namespace watcher")
-		os.Exit(1)
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	if err := w.Controller.Watch(InitObjectWatch(obj, w.NewMapper(gvk.GroupKind()))); err != nil {
+		return err
 	}
-
-	// Secret Watch
-	if err := controller.Watch(InitSecretWatch(sharedSecretCache)); err != nil {
-		setupLog.Error(err, "problem setting up secret watcher")
-		os.Exit(1)
+	if w.watched == nil {
+		w.watched = map[schema.GroupVersionKind]bool{}
 	}
+	w.watched[gvk] = true
+	setupLog.Info("watching shared resource kind", "kind", gvk.String())
+	return nil
 }
@@ -0,0 +1,125 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"strings"
+
+	tattletalev1beta1 "tattletale/api/v1beta1"
+	"tattletale/utils"
+)
+
+// DefaultSharedSecret fills in the settings a SharedSecret leaves out and normalizes its targets
+func DefaultSharedSecret(s *tattletalev1beta1.SharedSecret) {
+	if s.Spec.SourceSecret != "" && s.Spec.SourceNamespace == "" {
+		s.Spec.SourceNamespace = s.Namespace
+	}
+	if s.Spec.DriftPolicy == "" {
+		s.Spec.DriftPolicy = tattletalev1beta1.DriftPolicyOverwrite
+	}
+	defaultImmutable(s.Spec.Immutable)
+	defaultEncryption(s.Spec.Encryption)
+	defaultNotifications(s.Spec.Notifications)
+
+	if s.Spec.Targets == nil {
+		return
+	}
+	defaultName := s.TargetName(tattletalev1beta1.TargetSecret{})
+	seen := map[string]bool{}
+	targets := []tattletalev1beta1.TargetSecret{}
+	for _, t := range s.Spec.Targets {
+		t.Namespace = strings.TrimSpace(t.Namespace)
+		t.NewName = strings.TrimSpace(t.NewName)
+		if t.NewName == defaultName {
+			t.NewName = ""
+		}
+		defaultEncryption(t.Encryption)
+		// The kind of the source is left out, copies of other kinds say so
+		if t.Kind == tattletalev1beta1.TargetKindSecret {
+			t.Kind = ""
+		}
+		// Targets writing the same copy would fight over it, the first one wins
+		key := string(s.TargetKind(t)) + ":" + t.Namespace + "/" + s.TargetName(t)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		targets = append(targets, t)
+	}
+	s.Spec.Targets = targets
+}
+
+// DefaultSharedConfigMap fills in the settings a SharedConfigMap leaves out and normalizes its targets
+func DefaultSharedConfigMap(c *tattletalev1beta1.SharedConfigMap) {
+	if c.Spec.SourceConfigMap != "" && c.Spec.SourceNamespace == "" {
+		c.Spec.SourceNamespace = c.Namespace
+	}
+	if c.Spec.DriftPolicy == "" {
+		c.Spec.DriftPolicy = tattletalev1beta1.DriftPolicyOverwrite
+	}
+	defaultImmutable(c.Spec.Immutable)
+	defaultNotifications(c.Spec.Notifications)
+
+	if c.Spec.Targets == nil {
+		return
+	}
+	defaultName := c.TargetName(tattletalev1beta1.TargetConfigMap{})
+	seen := map[string]bool{}
+	targets := []tattletalev1beta1.TargetConfigMap{}
+	for _, t := range c.Spec.Targets {
+		t.Namespace = strings.TrimSpace(t.Namespace)
+		t.NewName = strings.TrimSpace(t.NewName)
+		if t.NewName == defaultName {
+			t.NewName = ""
+		}
+		// The kind of the source is left out, copies of other kinds say so
+		if t.Kind == tattletalev1beta1.TargetKindConfigMap {
+			t.Kind = ""
+		}
+		// Targets writing the same copy would fight over it, the first one wins
+		key := string(c.TargetKind(t)) + ":" + t.Namespace + "/" + c.TargetName(t)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		targets = append(targets, t)
+	}
+	c.Spec.Targets = targets
+}
+
+func defaultImmutable(immutable *tattletalev1beta1.ImmutableCopies) {
+	if immutable != nil && immutable.KeepGenerations == nil {
+		keep := int32(utils.DefaultKeepGenerations)
+		immutable.KeepGenerations = &keep
+	}
+}
+
+func defaultEncryption(encryption *tattletalev1beta1.SecretEncryption) {
+	if encryption != nil && encryption.PublicKeyKey == "" {
+		encryption.PublicKeyKey = utils.DefaultPublicKeyKey
+	}
+}
+
+func defaultNotifications(notifications *tattletalev1beta1.Notifications) {
+	if notifications == nil {
+		return
+	}
+	for i := range notifications.Sinks {
+		if notifications.Sinks[i].Mode == "" {
+			notifications.Sinks[i].Mode = tattletalev1beta1.CloudEventsModeBinary
+		}
+	}
+}
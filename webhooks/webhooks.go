@@ -0,0 +1,140 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package webhooks serves the defaulting webhooks of SharedSecrets and SharedConfigMaps
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	tattletalev1 "tattletale/api/v1"
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// +kubebuilder:webhook:path=/mutate-tattletale-tattletale-dev-v1beta1-sharedsecret,mutating=true,failurePolicy=fail,groups=tattletale.tattletale.dev,resources=sharedsecrets,verbs=create;update,versions=v1beta1,name=msharedsecret-v1beta1.tattletale.dev
+// +kubebuilder:webhook:path=/mutate-tattletale-tattletale-dev-v1-sharedsecret,mutating=true,failurePolicy=fail,groups=tattletale.tattletale.dev,resources=sharedsecrets,verbs=create;update,versions=v1,name=msharedsecret-v1.tattletale.dev
+// +kubebuilder:webhook:path=/mutate-tattletale-tattletale-dev-v1beta1-sharedconfigmap,mutating=true,failurePolicy=fail,groups=tattletale.tattletale.dev,resources=sharedconfigmaps,verbs=create;update,versions=v1beta1,name=msharedconfigmap-v1beta1.tattletale.dev
+// +kubebuilder:webhook:path=/mutate-tattletale-tattletale-dev-v1-sharedconfigmap,mutating=true,failurePolicy=fail,groups=tattletale.tattletale.dev,resources=sharedconfigmaps,verbs=create;update,versions=v1,name=msharedconfigmap-v1.tattletale.dev
+
+// Register adds the defaulting webhook of every version of SharedSecrets and SharedConfigMaps to server
+func Register(server *webhook.Server) {
+	paths := map[string]func() runtime.Object{
+		"/mutate-tattletale-tattletale-dev-v1beta1-sharedsecret":    func() runtime.Object { return &tattletalev1beta1.SharedSecret{} },
+		"/mutate-tattletale-tattletale-dev-v1-sharedsecret":         func() runtime.Object { return &tattletalev1.SharedSecret{} },
+		"/mutate-tattletale-tattletale-dev-v1beta1-sharedconfigmap": func() runtime.Object { return &tattletalev1beta1.SharedConfigMap{} },
+		"/mutate-tattletale-tattletale-dev-v1-sharedconfigmap":      func() runtime.Object { return &tattletalev1.SharedConfigMap{} },
+	}
+	for path, newObject := range paths {
+		server.Register(path, &webhook.Admission{Handler: &Defaulter{New: newObject}})
+	}
+}
+
+// Defaulter is an admission handler that defaults shared objects and records the user that created them
+type Defaulter struct {
+	// Returns an empty object of the kind and version the handler is registered for
+	New func() runtime.Object
+
+	decoder *admission.Decoder
+}
+
+var _ admission.DecoderInjector = &Defaulter{}
+
+// InjectDecoder injects the decoder of admission requests
+func (d *Defaulter) InjectDecoder(decoder *admission.Decoder) error {
+	d.decoder = decoder
+	return nil
+}
+
+// Handle returns the patch that defaults the object of req
+func (d *Defaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	obj := d.New()
+	if err := d.decoder.Decode(req, obj); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if err := Default(obj); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	// Users can't claim or change who created the object, updates keep what the create recorded
+	createdBy, recorded := req.UserInfo.Username, true
+	if req.Operation != admissionv1beta1.Create {
+		old := d.New()
+		if err := d.decoder.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		oldMeta, err := meta.Accessor(old)
+		if err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		createdBy, recorded = oldMeta.GetAnnotations()[tattletalev1beta1.CreatedByAnnotation]
+	}
+	objMeta, err := meta.Accessor(obj)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	annotations := objMeta.GetAnnotations()
+	if recorded {
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[tattletalev1beta1.CreatedByAnnotation] = createdBy
+	} else {
+		delete(annotations, tattletalev1beta1.CreatedByAnnotation)
+	}
+	objMeta.SetAnnotations(annotations)
+
+	marshaled, err := json.Marshal(obj)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// Default fills in the settings a shared object leaves out. Objects of other versions than v1beta1 are
+// defaulted through their v1beta1 form, so every version gets the same defaults.
+func Default(obj runtime.Object) error {
+	switch o := obj.(type) {
+	case *tattletalev1beta1.SharedSecret:
+		DefaultSharedSecret(o)
+	case *tattletalev1beta1.SharedConfigMap:
+		DefaultSharedConfigMap(o)
+	case *tattletalev1.SharedSecret:
+		var hub tattletalev1beta1.SharedSecret
+		if err := o.ConvertTo(&hub); err != nil {
+			return err
+		}
+		DefaultSharedSecret(&hub)
+		return o.ConvertFrom(&hub)
+	case *tattletalev1.SharedConfigMap:
+		var hub tattletalev1beta1.SharedConfigMap
+		if err := o.ConvertTo(&hub); err != nil {
+			return err
+		}
+		DefaultSharedConfigMap(&hub)
+		return o.ConvertFrom(&hub)
+	default:
+		return fmt.Errorf("can't default %T", obj)
+	}
+	return nil
+}
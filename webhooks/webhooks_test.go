@@ -0,0 +1,249 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	tattletalev1 "tattletale/api/v1"
+	tattletalev1beta1 "tattletale/api/v1beta1"
+
+	"gomodules.xyz/jsonpatch/v2"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestDefaultSharedSecret(t *testing.T) {
+	tests := []struct {
+		name string
+		spec tattletalev1beta1.SharedSecretSpec
+		// Checks the defaulted spec
+		check func(t *testing.T, spec tattletalev1beta1.SharedSecretSpec)
+	}{
+		{
+			name: "defaults",
+			spec: tattletalev1beta1.SharedSecretSpec{
+				SourceSecret: "db-credentials",
+				Targets:      []tattletalev1beta1.TargetSecret{{Namespace: "team-b"}},
+				Immutable:    &tattletalev1beta1.ImmutableCopies{},
+				Encryption:   &tattletalev1beta1.SecretEncryption{PublicKeyConfigMap: "tattletale-key"},
+				Notifications: &tattletalev1beta1.Notifications{Sinks: []tattletalev1beta1.NotificationSink{
+					{URL: "https://events.example.com"},
+				}},
+			},
+			check: func(t *testing.T, spec tattletalev1beta1.SharedSecretSpec) {
+				if spec.SourceNamespace != "team-a" {
+					t.Errorf("source namespace = %q, want the namespace of the shared object", spec.SourceNamespace)
+				}
+				if spec.DriftPolicy != tattletalev1beta1.DriftPolicyOverwrite {
+					t.Errorf("drift policy = %q, want Overwrite", spec.DriftPolicy)
+				}
+				if keep := spec.Immutable.KeepGenerations; keep == nil || *keep != 2 {
+					t.Errorf("keep generations = %v, want 2", keep)
+				}
+				if spec.Encryption.PublicKeyKey != "publicKey" {
+					t.Errorf("public key key = %q, want publicKey", spec.Encryption.PublicKeyKey)
+				}
+				if mode := spec.Notifications.Sinks[0].Mode; mode != tattletalev1beta1.CloudEventsModeBinary {
+					t.Errorf("sink mode = %q, want Binary", mode)
+				}
+			},
+		},
+		{
+			name: "settings that are set",
+			spec: tattletalev1beta1.SharedSecretSpec{
+				SourceSecret:    "db-credentials",
+				SourceNamespace: "platform",
+				DriftPolicy:     tattletalev1beta1.DriftPolicyReport,
+			},
+			check: func(t *testing.T, spec tattletalev1beta1.SharedSecretSpec) {
+				if spec.SourceNamespace != "platform" {
+					t.Errorf("source namespace = %q, want it kept", spec.SourceNamespace)
+				}
+				if spec.DriftPolicy != tattletalev1beta1.DriftPolicyReport {
+					t.Errorf("drift policy = %q, want it kept", spec.DriftPolicy)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &tattletalev1beta1.SharedSecret{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "db"}, Spec: tt.spec}
+			DefaultSharedSecret(s)
+			tt.check(t, s.Spec)
+		})
+	}
+}
+
+func TestDefaultSharedConfigMapTargets(t *testing.T) {
+	c := &tattletalev1beta1.SharedConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "settings"},
+		Spec: tattletalev1beta1.SharedConfigMapSpec{
+			SourceConfigMap: "settings",
+			Targets: []tattletalev1beta1.TargetConfigMap{
+				{Namespace: " team-b "},
+				{Namespace: "team-b", NewName: "settings", DriftPolicy: tattletalev1beta1.DriftPolicyIgnore},
+				{Namespace: "team-b", NewName: "acme-settings"},
+				{Namespace: "team-c"},
+				{Namespace: "team-c", Kind: tattletalev1beta1.TargetKindConfigMap},
+				{Namespace: "team-c", Kind: tattletalev1beta1.TargetKindSecret},
+			},
+		},
+	}
+	DefaultSharedConfigMap(c)
+
+	// Targets are normalized and de-duplicated
+	want := []tattletalev1beta1.TargetConfigMap{
+		{Namespace: "team-b"},
+		{Namespace: "team-b", NewName: "acme-settings"},
+		{Namespace: "team-c"},
+		{Namespace: "team-c", Kind: tattletalev1beta1.TargetKindSecret},
+	}
+	if !reflect.DeepEqual(c.Spec.Targets, want) {
+		t.Errorf("targets = %+v, want %+v", c.Spec.Targets, want)
+	}
+}
+
+func TestDefaultV1(t *testing.T) {
+	s := &tattletalev1.SharedSecret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "db"},
+		Spec: tattletalev1.SharedSecretSpec{
+			SourceRef: &tattletalev1.SourceReference{Name: "db-credentials"},
+			Targets:   []tattletalev1.SecretTarget{{Namespace: "team-b"}, {Namespace: "team-b", Name: "db-credentials"}},
+		},
+	}
+	if err := Default(s); err != nil {
+		t.Fatal(err)
+	}
+
+	// A v1 SharedSecret is defaulted like its v1beta1 form
+	if s.Spec.DriftPolicy != tattletalev1.DriftPolicyOverwrite {
+		t.Errorf("drift policy = %q, want Overwrite", s.Spec.DriftPolicy)
+	}
+	if want := []tattletalev1.SecretTarget{{Namespace: "team-b"}}; !reflect.DeepEqual(s.Spec.Targets, want) {
+		t.Errorf("targets = %+v, want %+v", s.Spec.Targets, want)
+	}
+}
+
+func newSharedSecret(annotations map[string]string) *tattletalev1beta1.SharedSecret {
+	return &tattletalev1beta1.SharedSecret{
+		TypeMeta:   metav1.TypeMeta{APIVersion: tattletalev1beta1.GroupVersion.String(), Kind: "SharedSecret"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "db", Annotations: annotations},
+		Spec: tattletalev1beta1.SharedSecretSpec{
+			SourceSecret: "db-credentials",
+			Targets:      []tattletalev1beta1.TargetSecret{{Namespace: "team-b"}},
+		},
+	}
+}
+
+func TestDefaulter(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := tattletalev1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaulter := &Defaulter{New: func() runtime.Object { return &tattletalev1beta1.SharedSecret{} }}
+	if err := defaulter.InjectDecoder(decoder); err != nil {
+		t.Fatal(err)
+	}
+
+	const createdBy = "/metadata/annotations/tattletale.dev~1created-by"
+	tests := []struct {
+		name      string
+		operation admissionv1beta1.Operation
+		user      string
+		obj, old  *tattletalev1beta1.SharedSecret
+		// The patches expected, by path
+		want map[string]jsonpatch.JsonPatchOperation
+	}{
+		{
+			name:      "create",
+			operation: admissionv1beta1.Create,
+			user:      "alice",
+			obj:       newSharedSecret(nil),
+			want: map[string]jsonpatch.JsonPatchOperation{
+				"/spec/sourceNamespace": {Operation: "add", Path: "/spec/sourceNamespace", Value: "team-a"},
+				"/metadata/annotations": {Operation: "add", Path: "/metadata/annotations", Value: map[string]interface{}{tattletalev1beta1.CreatedByAnnotation: "alice"}},
+			},
+		},
+		{
+			// Users can't claim to have created an object
+			name:      "create claiming a creator",
+			operation: admissionv1beta1.Create,
+			user:      "alice",
+			obj:       newSharedSecret(map[string]string{tattletalev1beta1.CreatedByAnnotation: "bob"}),
+			want: map[string]jsonpatch.JsonPatchOperation{
+				createdBy: {Operation: "replace", Path: createdBy, Value: "alice"},
+			},
+		},
+		{
+			name:      "update",
+			operation: admissionv1beta1.Update,
+			user:      "bob",
+			obj:       newSharedSecret(map[string]string{tattletalev1beta1.CreatedByAnnotation: "bob"}),
+			old:       newSharedSecret(map[string]string{tattletalev1beta1.CreatedByAnnotation: "alice"}),
+			want: map[string]jsonpatch.JsonPatchOperation{
+				createdBy: {Operation: "replace", Path: createdBy, Value: "alice"},
+			},
+		},
+		{
+			// Objects created before the webhook existed have no creator, which users can't fill in
+			name:      "update without a creator",
+			operation: admissionv1beta1.Update,
+			user:      "bob",
+			obj:       newSharedSecret(map[string]string{tattletalev1beta1.CreatedByAnnotation: "bob"}),
+			old:       newSharedSecret(nil),
+			want: map[string]jsonpatch.JsonPatchOperation{
+				"/metadata/annotations": {Operation: "remove", Path: "/metadata/annotations"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := admission.Request{AdmissionRequest: admissionv1beta1.AdmissionRequest{
+				Operation: tt.operation,
+				UserInfo:  authenticationv1.UserInfo{Username: tt.user},
+			}}
+			req.Object.Raw, _ = json.Marshal(tt.obj)
+			if tt.old != nil {
+				req.OldObject.Raw, _ = json.Marshal(tt.old)
+			}
+
+			resp := defaulter.Handle(context.Background(), req)
+			if !resp.Allowed {
+				t.Fatalf("denied: %v", resp.Result)
+			}
+			patches := map[string]jsonpatch.JsonPatchOperation{}
+			for _, p := range resp.Patches {
+				patches[p.Path] = p
+			}
+			for path, want := range tt.want {
+				if got, ok := patches[path]; !ok || !reflect.DeepEqual(got, want) {
+					t.Errorf("patch of %s = %+v, want %+v", path, got, want)
+				}
+			}
+		})
+	}
+}